@@ -0,0 +1,60 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+// Client 表示一个 MNS 账号, 提供队列和主题的管理接口.
+//
+// 通过 Queue 和 Topic 创建的对象和 Client 共享凭证, 调用 SetCredentials 或者 SetCredentialsProvider 之后全部生效.
+type Client struct {
+	config      mns.Config
+	endpoint    string // http://$AccountId.mns.<Region>.aliyuncs.com
+	credentials *mns.RotatingCredentialsProvider
+}
+
+// New 创建一个新的 Client
+//  endpoint: http://$AccountId.mns.<Region>.aliyuncs.com
+func New(endpoint string, config mns.Config) *Client {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+	provider := config.CredentialsProvider
+	if provider == nil {
+		provider = mns.NewStaticCredentialsProvider(config.AccessKeyId, config.AccessKeySecret, config.SecurityToken)
+	}
+	credentials := mns.NewRotatingCredentialsProvider(provider)
+	config.CredentialsProvider = credentials
+	return &Client{
+		config:      config,
+		endpoint:    endpoint,
+		credentials: credentials,
+	}
+}
+
+// Queue 返回名称为 name 的队列, 和 Client 共享凭证.
+func (c *Client) Queue(name string) *queue.Queue {
+	return queue.New(c.endpoint, name, c.config)
+}
+
+// Topic 返回名称为 name 的主题, 和 Client 共享凭证.
+func (c *Client) Topic(name string) *topic.Topic {
+	return topic.New(c.endpoint, name, c.config)
+}
+
+// SetCredentials 原子的替换 Client 以及通过 Client 创建的 Queue 和 Topic 的凭证, securityToken 可以为空.
+// 正在进行的请求继续使用旧的凭证, 之后的请求使用新的凭证.
+func (c *Client) SetCredentials(accessKeyId, accessKeySecret, securityToken string) {
+	c.credentials.SetCredentials(accessKeyId, accessKeySecret, securityToken)
+}
+
+// SetCredentialsProvider 和 SetCredentials 类似, 替换为 provider.
+func (c *Client) SetCredentialsProvider(provider mns.CredentialsProvider) {
+	c.credentials.SetProvider(provider)
+}
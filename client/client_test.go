@@ -0,0 +1,210 @@
+package client
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+func TestClientGetQueueAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/queues/test" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("X-Mns-Request-Id", "request-id")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Queue xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <QueueName>test</QueueName>
+  <CreateTime>1250700979</CreateTime>
+  <LastModifyTime>1250700979</LastModifyTime>
+  <DelaySeconds>0</DelaySeconds>
+  <MaximumMessageSize>65536</MaximumMessageSize>
+  <MessageRetentionPeriod>345600</MessageRetentionPeriod>
+  <VisibilityTimeout>30</VisibilityTimeout>
+  <PollingWaitSeconds>10</PollingWaitSeconds>
+  <ActiveMessages>20</ActiveMessages>
+  <InactiveMessages>3</InactiveMessages>
+  <DelayMessages>1</DelayMessages>
+  <LoggingEnabled>True</LoggingEnabled>
+</Queue>`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	requestId, resp, err := c.GetQueueAttributes("test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if requestId != "request-id" {
+		t.Errorf("have:%s, want:%s", requestId, "request-id")
+		return
+	}
+	if resp.QueueName != "test" || resp.ActiveMessages != 20 || resp.InactiveMessages != 3 || resp.DelayMessages != 1 || !resp.LoggingEnabled {
+		t.Errorf("unexpected response: %+v", resp)
+		return
+	}
+}
+
+func TestClientListQueue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.Header.Get("X-Mns-Prefix"), "tenant-"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		if have, want := r.Header.Get("X-Mns-Marker"), "marker"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		if have, want := r.Header.Get("X-Mns-Ret-Number"), "2"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		w.Write([]byte(`<Queues>
+  <Queue><QueueURL>http://1.mns.cn-hangzhou.aliyuncs.com/queues/tenant-a</QueueURL></Queue>
+  <Queue><QueueURL>http://1.mns.cn-hangzhou.aliyuncs.com/queues/tenant-b</QueueURL></Queue>
+  <NextMarker>next</NextMarker>
+</Queues>`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, resp, err := c.ListQueue("tenant-", "marker", 2)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(resp.Queues) != 2 || resp.NextMarker != "next" {
+		t.Errorf("unexpected response: %+v", resp)
+		return
+	}
+}
+
+func TestClientCreateQueueAlreadyExist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/queues/test" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`<Error><Code>QueueAlreadyExist</Code><Message>The queue you want to create already exist.</Message><RequestId>request-id</RequestId></Error>`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, err := c.CreateQueue("test", &QueueAttributes{VisibilityTimeout: 60})
+	if !mns.IsQueueAlreadyExist(err) {
+		t.Errorf("want QueueAlreadyExist, have:%v", err)
+		return
+	}
+}
+
+// 指针字段可以把 DelaySeconds 设置为 0, 为 nil 的字段不发送.
+func TestClientSetQueueAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/queues/test" || r.URL.RawQuery != "metaoverride=true" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if have, want := string(body), "<Queue><DelaySeconds>0</DelaySeconds></Queue>"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	delaySeconds := 0
+	if _, err := c.SetQueueAttributes("test", &QueueAttributes{DelaySeconds: &delaySeconds}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
+
+func TestClientListTopic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/topics" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if have, want := r.Header.Get("X-Mns-Ret-Number"), "1000"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		w.Write([]byte(`<Topics><Topic><TopicURL>http://1.mns.cn-hangzhou.aliyuncs.com/topics/t1</TopicURL></Topic></Topics>`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, resp, err := c.ListTopic("", "", 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(resp.Topics) != 1 || resp.NextMarker != "" {
+		t.Errorf("unexpected response: %+v", resp)
+		return
+	}
+}
+
+func TestClientSetCredentials(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/queues/slow/messages" {
+			close(started)
+			<-release
+		}
+		// 把签名使用的 AccessKeyId 作为 MessageId 返回
+		accessKeyId := strings.TrimPrefix(r.Header.Get("Authorization"), "MNS ")
+		accessKeyId = accessKeyId[:strings.IndexByte(accessKeyId, ':')]
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`<Message><MessageId>` + accessKeyId + `</MessageId><MessageBodyMD5>` + fmt.Sprintf("%X", md5.Sum([]byte("body"))) + `</MessageBodyMD5></Message>`))
+	}))
+	defer srv.Close()
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id1", AccessKeySecret: "secret1"})
+	q, slow := c.Queue("test"), c.Queue("slow")
+
+	type result struct {
+		messageId string
+		err       error
+	}
+	inflight := make(chan result, 1)
+	go func() {
+		_, resp, err := slow.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body")})
+		if err != nil {
+			inflight <- result{err: err}
+			return
+		}
+		inflight <- result{messageId: resp.MessageId}
+	}()
+	<-started
+
+	c.SetCredentials("id2", "secret2", "")
+	_, resp, err := q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body")})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if resp.MessageId != "id2" {
+		t.Errorf("have:%s, want:%s", resp.MessageId, "id2")
+		return
+	}
+
+	// 正在进行的请求使用旧的凭证
+	releaseOnce.Do(func() { close(release) })
+	r := <-inflight
+	if r.err != nil {
+		t.Error(r.err.Error())
+		return
+	}
+	if r.messageId != "id1" {
+		t.Errorf("have:%s, want:%s", r.messageId, "id1")
+		return
+	}
+}
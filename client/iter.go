@@ -0,0 +1,45 @@
+//go:build go1.23
+
+package client
+
+import (
+	"context"
+	"iter"
+)
+
+// Queues 返回遍历账号下队列的迭代器, 出错时最后一次迭代返回该错误.
+//
+//  for item, err := range c.Queues(ctx, "prefix-") {
+//      if err != nil {
+//          ...
+//      }
+//      ...
+//  }
+func (c *Client) Queues(ctx context.Context, prefix string) iter.Seq2[ListQueueResponseItem, error] {
+	return func(yield func(ListQueueResponseItem, error) bool) {
+		it := c.NewQueueIterator(prefix, 0)
+		for it.Next(ctx) {
+			if !yield(it.Queue(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(ListQueueResponseItem{}, err)
+		}
+	}
+}
+
+// Topics 返回遍历账号下主题的迭代器, 出错时最后一次迭代返回该错误.
+func (c *Client) Topics(ctx context.Context, prefix string) iter.Seq2[ListTopicResponseItem, error] {
+	return func(yield func(ListTopicResponseItem, error) bool) {
+		it := c.NewTopicIterator(prefix, 0)
+		for it.Next(ctx) {
+			if !yield(it.Topic(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(ListTopicResponseItem{}, err)
+		}
+	}
+}
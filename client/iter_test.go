@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestClientQueues(t *testing.T) {
+	srv := newListQueueServer(t, 2500, 1000)
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	var n int
+	for _, err := range c.Queues(context.Background(), "tenant-") {
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		n++
+	}
+	if n != 2500 {
+		t.Errorf("have:%d, want:%d", n, 2500)
+		return
+	}
+}
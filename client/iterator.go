@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+)
+
+// pager 按照 NextMarker 逐页获取列表, 被 QueueIterator 和 TopicIterator 共用.
+type pager struct {
+	// fetch 获取 marker 开始的一页, 返回这一页的元素个数和下一页的 marker.
+	fetch func(ctx context.Context, marker string) (n int, nextMarker string, err error)
+
+	marker  string
+	started bool // 是否已经获取过第一页
+	n       int  // 当前页的元素个数
+	index   int  // 当前元素在当前页的下标
+	err     error
+}
+
+func (p *pager) next(ctx context.Context) bool {
+	if p.err != nil {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		p.err = err
+		return false
+	}
+	if p.index+1 < p.n {
+		p.index++
+		return true
+	}
+	// 当前页已经遍历完了, 获取下一页; 服务端可能返回空页但是 NextMarker 不为空, 所以需要循环.
+	for !p.started || p.marker != "" {
+		p.started = true
+		n, nextMarker, err := p.fetch(ctx, p.marker)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.marker = nextMarker
+		p.n = n
+		p.index = 0
+		if n > 0 {
+			return true
+		}
+		if err = ctx.Err(); err != nil {
+			p.err = err
+			return false
+		}
+	}
+	p.n = 0
+	return false
+}
+
+// QueueIterator 遍历账号下的队列, 自动按照 NextMarker 翻页.
+//
+//  it := c.NewQueueIterator("prefix-", 0)
+//  for it.Next(ctx) {
+//      item := it.Queue()
+//      ...
+//  }
+//  if err := it.Err(); err != nil {
+//      ...
+//  }
+type QueueIterator struct {
+	pager
+	page []ListQueueResponseItem
+}
+
+// NewQueueIterator 创建一个 QueueIterator, prefix 可以为空, retNumber 为每一页的最大个数, 1-1000.
+func (c *Client) NewQueueIterator(prefix string, retNumber int) *QueueIterator {
+	it := &QueueIterator{}
+	it.fetch = func(ctx context.Context, marker string) (n int, nextMarker string, err error) {
+		_, resp, err := c.ListQueueContext(ctx, prefix, marker, retNumber)
+		if err != nil {
+			return
+		}
+		it.page = resp.Queues
+		return len(resp.Queues), resp.NextMarker, nil
+	}
+	return it
+}
+
+// Next 移动到下一个队列, 没有更多队列或者出错时返回 false, 出错的原因可以通过 Err 获取.
+func (it *QueueIterator) Next(ctx context.Context) bool { return it.next(ctx) }
+
+// Queue 返回当前的队列, 只有在 Next 返回 true 之后才能调用.
+func (it *QueueIterator) Queue() ListQueueResponseItem { return it.page[it.index] }
+
+// Err 返回遍历过程中遇到的错误, 包括 ctx 被取消.
+func (it *QueueIterator) Err() error { return it.err }
+
+// TopicIterator 遍历账号下的主题, 自动按照 NextMarker 翻页, 用法同 QueueIterator.
+type TopicIterator struct {
+	pager
+	page []ListTopicResponseItem
+}
+
+// NewTopicIterator 创建一个 TopicIterator, prefix 可以为空, retNumber 为每一页的最大个数, 1-1000.
+func (c *Client) NewTopicIterator(prefix string, retNumber int) *TopicIterator {
+	it := &TopicIterator{}
+	it.fetch = func(ctx context.Context, marker string) (n int, nextMarker string, err error) {
+		_, resp, err := c.ListTopicContext(ctx, prefix, marker, retNumber)
+		if err != nil {
+			return
+		}
+		it.page = resp.Topics
+		return len(resp.Topics), resp.NextMarker, nil
+	}
+	return it
+}
+
+// Next 移动到下一个主题, 没有更多主题或者出错时返回 false, 出错的原因可以通过 Err 获取.
+func (it *TopicIterator) Next(ctx context.Context) bool { return it.next(ctx) }
+
+// Topic 返回当前的主题, 只有在 Next 返回 true 之后才能调用.
+func (it *TopicIterator) Topic() ListTopicResponseItem { return it.page[it.index] }
+
+// Err 返回遍历过程中遇到的错误, 包括 ctx 被取消.
+func (it *TopicIterator) Err() error { return it.err }
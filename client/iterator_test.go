@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+// newListQueueServer 返回一个按照 x-mns-marker 分页返回 total 个队列的测试服务器, 每一页 pageSize 个.
+func newListQueueServer(t *testing.T, total, pageSize int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.Header.Get("X-Mns-Prefix"), "tenant-"; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		start := 0
+		if marker := r.Header.Get("X-Mns-Marker"); marker != "" {
+			start, _ = strconv.Atoi(marker)
+		}
+		end := start + pageSize
+		if end > total {
+			end = total
+		}
+		fmt.Fprint(w, "<Queues>")
+		for i := start; i < end; i++ {
+			fmt.Fprintf(w, "<Queue><QueueURL>http://1.mns.cn-hangzhou.aliyuncs.com/queues/tenant-%d</QueueURL></Queue>", i)
+		}
+		if end < total {
+			fmt.Fprintf(w, "<NextMarker>%d</NextMarker>", end)
+		}
+		fmt.Fprint(w, "</Queues>")
+	}))
+}
+
+func TestQueueIterator(t *testing.T) {
+	srv := newListQueueServer(t, 7, 3)
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	it := c.NewQueueIterator("tenant-", 3)
+	var n int
+	for it.Next(context.Background()) {
+		want := fmt.Sprintf("http://1.mns.cn-hangzhou.aliyuncs.com/queues/tenant-%d", n)
+		if have := it.Queue().QueueURL; have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+			return
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n != 7 {
+		t.Errorf("have:%d, want:%d", n, 7)
+		return
+	}
+	if it.Next(context.Background()) {
+		t.Error("want false after the end")
+		return
+	}
+}
+
+func TestQueueIteratorContextCanceled(t *testing.T) {
+	srv := newListQueueServer(t, 7, 3)
+	defer srv.Close()
+
+	c := New(srv.URL, mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := c.NewQueueIterator("tenant-", 3)
+	var n int
+	for it.Next(ctx) {
+		n++
+		if n == 2 {
+			cancel()
+		}
+	}
+	if n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+	if it.Err() != context.Canceled {
+		t.Errorf("have:%v, want:%v", it.Err(), context.Canceled)
+		return
+	}
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// QueueAttributes 是队列可以设置的属性, 用于 CreateQueue 和 SetQueueAttributes.
+// 零值 (nil) 的字段不会发送给 MNS, 创建队列时使用默认值, 设置属性时保持不变.
+type QueueAttributes struct {
+	XMLName struct{} `xml:"Queue"`
+
+	DelaySeconds           *int  `xml:"DelaySeconds,omitempty"`           // 发送到该队列的所有消息默认将以 DelaySeconds 参数指定的秒数延后可被消费, 单位为秒, 0-604800
+	MaximumMessageSize     int   `xml:"MaximumMessageSize,omitempty"`     // 发送到该队列的消息体的最大长度, 单位为 byte, 1024-65536
+	MessageRetentionPeriod int   `xml:"MessageRetentionPeriod,omitempty"` // 消息在该队列中最长的存活时间, 单位为秒, 60-604800
+	VisibilityTimeout      int   `xml:"VisibilityTimeout,omitempty"`      // 消息从该队列中取出后从 Active 状态变成 Inactive 状态后的持续时间, 单位为秒, 1-43200
+	PollingWaitSeconds     *int  `xml:"PollingWaitSeconds,omitempty"`     // 当队列中没有消息时, 针对该队列的 ReceiveMessage 请求最长的等待时间, 单位为秒, 0-30
+	LoggingEnabled         *bool `xml:"LoggingEnabled,omitempty"`         // 是否开启日志管理功能
+}
+
+// GetQueueAttributesResponse 是 GetQueueAttributes 返回的队列属性.
+type GetQueueAttributesResponse struct {
+	XMLName struct{} `xml:"Queue"`
+
+	QueueName              string `xml:"QueueName"`
+	CreateTime             int64  `xml:"CreateTime"`     // 队列的创建时间, 从 1970-1-1 00:00:00 到现在的秒值
+	LastModifyTime         int64  `xml:"LastModifyTime"` // 修改队列属性信息最近时间, 从 1970-1-1 00:00:00 到现在的秒值
+	DelaySeconds           int    `xml:"DelaySeconds"`
+	MaximumMessageSize     int    `xml:"MaximumMessageSize"`
+	MessageRetentionPeriod int    `xml:"MessageRetentionPeriod"`
+	VisibilityTimeout      int    `xml:"VisibilityTimeout"`
+	PollingWaitSeconds     int    `xml:"PollingWaitSeconds"`
+	ActiveMessages         int64  `xml:"ActiveMessages"`   // 在该队列中处于 Active 状态的消息总数, 为近似值
+	InactiveMessages       int64  `xml:"InactiveMessages"` // 在该队列中处于 Inactive 状态的消息总数, 为近似值
+	DelayMessages          int64  `xml:"DelayMessages"`    // 在该队列中处于 Delayed 状态的消息总数, 为近似值
+	LoggingEnabled         bool   `xml:"LoggingEnabled"`
+}
+
+func (c *Client) CreateQueue(queue string, attrs *QueueAttributes) (requestId string, err error) {
+	return c.CreateQueueContext(context.Background(), queue, attrs)
+}
+
+// CreateQueueContext 创建队列, attrs 可以为 nil.
+// 如果同名队列已经存在并且属性相同, 返回成功; 如果属性不同, 返回 QueueAlreadyExist 错误.
+func (c *Client) CreateQueueContext(ctx context.Context, queue string, attrs *QueueAttributes) (requestId string, err error) {
+	if queue == "" {
+		err = errors.New("the queue must not be empty")
+		return
+	}
+	if attrs == nil {
+		attrs = &QueueAttributes{}
+	}
+	return c.put(ctx, internal.Operation{Name: "CreateQueue", Idempotent: true}, c.endpoint+"/queues/"+queue, attrs)
+}
+
+func (c *Client) SetQueueAttributes(queue string, attrs *QueueAttributes) (requestId string, err error) {
+	return c.SetQueueAttributesContext(context.Background(), queue, attrs)
+}
+
+func (c *Client) SetQueueAttributesContext(ctx context.Context, queue string, attrs *QueueAttributes) (requestId string, err error) {
+	if queue == "" {
+		err = errors.New("the queue must not be empty")
+		return
+	}
+	if attrs == nil {
+		err = errors.New("the attrs must not be nil")
+		return
+	}
+	return c.put(ctx, internal.Operation{Name: "SetQueueAttributes", Idempotent: true}, c.endpoint+"/queues/"+queue+"?metaoverride=true", attrs)
+}
+
+func (c *Client) GetQueueAttributes(queue string) (requestId string, resp *GetQueueAttributesResponse, err error) {
+	return c.GetQueueAttributesContext(context.Background(), queue)
+}
+
+func (c *Client) GetQueueAttributesContext(ctx context.Context, queue string) (requestId string, resp *GetQueueAttributesResponse, err error) {
+	if queue == "" {
+		err = errors.New("the queue must not be empty")
+		return
+	}
+	var result GetQueueAttributesResponse
+	requestId, err = c.get(ctx, internal.Operation{Name: "GetQueueAttributes", Idempotent: true}, c.endpoint+"/queues/"+queue, nil, &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
+
+func (c *Client) DeleteQueue(queue string) (requestId string, err error) {
+	return c.DeleteQueueContext(context.Background(), queue)
+}
+
+func (c *Client) DeleteQueueContext(ctx context.Context, queue string) (requestId string, err error) {
+	if queue == "" {
+		err = errors.New("the queue must not be empty")
+		return
+	}
+	return c.delete(ctx, internal.Operation{Name: "DeleteQueue", Idempotent: true}, c.endpoint+"/queues/"+queue)
+}
+
+type ListQueueResponseItem struct {
+	XMLName struct{} `xml:"Queue"`
+
+	QueueURL string `xml:"QueueURL"` // http://$AccountId.mns.<Region>.aliyuncs.com/queues/$QueueName
+}
+
+type ListQueueResponse struct {
+	XMLName struct{} `xml:"Queues"`
+
+	Queues     []ListQueueResponseItem `xml:"Queue"`
+	NextMarker string                  `xml:"NextMarker"` // 为空表示没有更多的队列了
+}
+
+func (c *Client) ListQueue(prefix, marker string, retNumber int) (requestId string, resp *ListQueueResponse, err error) {
+	return c.ListQueueContext(context.Background(), prefix, marker, retNumber)
+}
+
+// ListQueueContext 列出账号下的队列.
+//  prefix:    按照队列名称的前缀过滤, 可以为空
+//  marker:    分页的起始位置, 为上一次返回的 NextMarker, 第一页为空
+//  retNumber: 单次返回的最大个数, 1-1000
+func (c *Client) ListQueueContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListQueueResponse, err error) {
+	var result ListQueueResponse
+	requestId, err = c.get(ctx, internal.Operation{Name: "ListQueue", Idempotent: true}, c.endpoint+"/queues", internal.ListHeader(prefix, marker, retNumber), &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
+
+// put 发送 PUT 请求, 请求体为 v 编码后的 xml, 成功时没有响应体.
+func (c *Client) put(ctx context.Context, op internal.Operation, rawurl string, v interface{}) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	reqBuffer := pool.Get()
+	defer pool.Put(reqBuffer)
+	reqBuffer.Reset()
+	if err = xml.NewEncoder(reqBuffer).Encode(v); err != nil {
+		return
+	}
+	reqBody := reqBuffer.Bytes()
+
+	pool = mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodPut, _url, nil, reqBody, respBuffer, c.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
+
+// get 发送 GET 请求, 并把响应体解析到 result.
+func (c *Client) get(ctx context.Context, op internal.Operation, rawurl string, header http.Header, result interface{}) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodGet, _url, header, nil, respBuffer, c.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		if err = xml.Unmarshal(respBody, result); err != nil {
+			err = internal.NewXMLUnmarshalError(respBody, result, err)
+			return
+		}
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
+
+// delete 发送 DELETE 请求, 成功时没有响应体.
+func (c *Client) delete(ctx context.Context, op internal.Operation, rawurl string) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodDelete, _url, nil, nil, respBuffer, c.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+type ListTopicResponseItem struct {
+	XMLName struct{} `xml:"Topic"`
+
+	TopicURL string `xml:"TopicURL"` // http://$AccountId.mns.<Region>.aliyuncs.com/topics/$TopicName
+}
+
+type ListTopicResponse struct {
+	XMLName struct{} `xml:"Topics"`
+
+	Topics     []ListTopicResponseItem `xml:"Topic"`
+	NextMarker string                  `xml:"NextMarker"` // 为空表示没有更多的主题了
+}
+
+func (c *Client) ListTopic(prefix, marker string, retNumber int) (requestId string, resp *ListTopicResponse, err error) {
+	return c.ListTopicContext(context.Background(), prefix, marker, retNumber)
+}
+
+// ListTopicContext 列出账号下的主题, 主题的其他管理接口见 topic.Topic.
+//  prefix:    按照主题名称的前缀过滤, 可以为空
+//  marker:    分页的起始位置, 为上一次返回的 NextMarker, 第一页为空
+//  retNumber: 单次返回的最大个数, 1-1000
+func (c *Client) ListTopicContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListTopicResponse, err error) {
+	var result ListTopicResponse
+	requestId, err = c.get(ctx, internal.Operation{Name: "ListTopic", Idempotent: true}, c.endpoint+"/topics", internal.ListHeader(prefix, marker, retNumber), &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
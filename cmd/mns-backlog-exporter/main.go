@@ -0,0 +1,89 @@
+// mns-backlog-exporter 定期获取队列的属性, 在 /metrics 导出队列中的消息数, 用于队列积压的告警.
+//
+//  mns-backlog-exporter -endpoint http://$AccountId.mns.cn-hangzhou.aliyuncs.com -prefix order-
+//
+// 凭证由 -credentials 指定:
+//  env:  从环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID, ALIBABA_CLOUD_ACCESS_KEY_SECRET 和 ALIBABA_CLOUD_SECURITY_TOKEN 读取, 默认
+//  file: 从凭证文件读取, 见 mns.NewFileCredentialsProvider, -profile 指定配置段
+//  ecs:  从 ECS 实例的 RAM 角色获取, -role 指定角色
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/client"
+	"github.com/chanxuehong/mns.aliyun.v20150606/prommns"
+)
+
+func main() {
+	addr := flag.String("addr", ":9765", "listen address")
+	endpoint := flag.String("endpoint", "", "MNS endpoint, e.g. http://$AccountId.mns.cn-hangzhou.aliyuncs.com")
+	queues := flag.String("queues", "", "comma separated queue names")
+	prefix := flag.String("prefix", "", "export queues with this prefix, used when -queues is empty")
+	interval := flag.Duration("interval", time.Minute, "poll interval")
+	credentials := flag.String("credentials", "env", "credentials provider: env, file or ecs")
+	profile := flag.String("profile", "", "profile of the credentials file, used with -credentials file")
+	roleName := flag.String("role", "", "RAM role of the ECS instance, used with -credentials ecs, empty means the attached role")
+	flag.Parse()
+
+	if *endpoint == "" {
+		log.Fatal("-endpoint is required")
+	}
+	config := mns.Config{CredentialsProvider: credentialsProvider(*credentials, *profile, *roleName)}
+	if _, err := config.CredentialsProvider.Credentials(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	backlogConfig := &prommns.BacklogConfig{
+		Prefix:   *prefix,
+		Interval: *interval,
+	}
+	for _, name := range strings.Split(*queues, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			backlogConfig.QueueNames = append(backlogConfig.QueueNames, name)
+		}
+	}
+	exporter := prommns.NewBacklogExporter(client.New(*endpoint, config), backlogConfig)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go exporter.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter.Handler())
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("mns-backlog-exporter listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// credentialsProvider 返回 -credentials 指定的 CredentialsProvider.
+func credentialsProvider(kind, profile, roleName string) mns.CredentialsProvider {
+	switch kind {
+	case "env":
+		return mns.NewEnvCredentialsProvider()
+	case "file":
+		return mns.NewFileCredentialsProvider("", profile)
+	case "ecs":
+		return mns.NewECSRAMRoleCredentialsProvider(roleName, nil)
+	default:
+		log.Fatalf("unsupported -credentials %q", kind)
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+// mns-dlq-replay 把 deadletter.Router 转移到死信队列的消息重新发送回原来的队列.
+//
+//  mns-dlq-replay -endpoint http://$AccountId.mns.cn-hangzhou.aliyuncs.com -dlq orders-dlq
+//  mns-dlq-replay -endpoint http://$AccountId.mns.cn-hangzhou.aliyuncs.com -dlq orders-dlq -queue orders-retry -max 100
+//
+// 凭证由 -credentials 指定:
+//  env:  从环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID, ALIBABA_CLOUD_ACCESS_KEY_SECRET 和 ALIBABA_CLOUD_SECURITY_TOKEN 读取, 默认
+//  file: 从凭证文件读取, 见 mns.NewFileCredentialsProvider, -profile 指定配置段
+//  ecs:  从 ECS 实例的 RAM 角色获取, -role 指定角色
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/deadletter"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "", "MNS endpoint, e.g. http://$AccountId.mns.cn-hangzhou.aliyuncs.com")
+	dlqName := flag.String("dlq", "", "dead-letter queue name")
+	queueName := flag.String("queue", "", "send messages to this queue instead of their source queue")
+	sourceQueue := flag.String("source", "", "only replay messages moved from this source queue")
+	maxMessages := flag.Int("max", 0, "maximum number of messages to replay, 0 means no limit")
+	credentials := flag.String("credentials", "env", "credentials provider: env, file or ecs")
+	profile := flag.String("profile", "", "profile of the credentials file, used with -credentials file")
+	roleName := flag.String("role", "", "RAM role of the ECS instance, used with -credentials ecs, empty means the attached role")
+	flag.Parse()
+
+	if *endpoint == "" || *dlqName == "" {
+		log.Fatal("-endpoint and -dlq are required")
+	}
+	config := mns.Config{CredentialsProvider: credentialsProvider(*credentials, *profile, *roleName)}
+	if _, err := config.CredentialsProvider.Credentials(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	queues := make(map[string]queue.API)
+	target := func(source string) queue.API {
+		name := source
+		if *queueName != "" {
+			name = *queueName
+		}
+		if name == "" {
+			return nil
+		}
+		q, ok := queues[name]
+		if !ok {
+			q = queue.New(*endpoint, name, config)
+			queues[name] = q
+		}
+		return q
+	}
+	replayConfig := &deadletter.ReplayConfig{MaxMessages: *maxMessages}
+	if *sourceQueue != "" {
+		replayConfig.Filter = func(dl *deadletter.DeadLetter) bool { return dl.SourceQueue == *sourceQueue }
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	replayed, err := deadletter.Replay(ctx, queue.New(*endpoint, *dlqName, config), target, replayConfig)
+	log.Printf("replayed %d messages from %s", replayed, *dlqName)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// credentialsProvider 返回 -credentials 指定的 CredentialsProvider.
+func credentialsProvider(kind, profile, roleName string) mns.CredentialsProvider {
+	switch kind {
+	case "env":
+		return mns.NewEnvCredentialsProvider()
+	case "file":
+		return mns.NewFileCredentialsProvider("", profile)
+	case "ecs":
+		return mns.NewECSRAMRoleCredentialsProvider(roleName, nil)
+	default:
+		log.Fatalf("unsupported -credentials %q", kind)
+		return nil
+	}
+}
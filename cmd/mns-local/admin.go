@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+)
+
+type accountInfo struct {
+	AccountId  string `json:"account_id"`
+	Region     string `json:"region"`
+	QueueCount int    `json:"queue_count"`
+	TopicCount int    `json:"topic_count"`
+}
+
+type queueInfo struct {
+	Name             string                  `json:"name"`
+	Attributes       mnstest.QueueAttributes `json:"attributes"`
+	ActiveMessages   int                     `json:"active_messages"`
+	InactiveMessages int                     `json:"inactive_messages"`
+	DelayMessages    int                     `json:"delay_messages"`
+	CreateTime       time.Time               `json:"create_time"`
+	LastModifyTime   time.Time               `json:"last_modify_time"`
+}
+
+// serveAdmin 处理管理接口, 只读, 不需要签名.
+//  GET /admin/accounts
+//  GET /admin/{AccountId}/queues
+//  GET /admin/{AccountId}/queues/{QueueName}/messages
+//  GET /admin/{AccountId}/topics
+//  GET /admin/signing-cert.pem
+func (h *handler) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/"), "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "signing-cert.pem":
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(h.pusher.certPEM)
+		return
+	case len(path) == 1 && path[0] == "accounts":
+		infos := make([]accountInfo, len(h.accounts))
+		for i, a := range h.accounts {
+			snapshot := a.server.Snapshot()
+			infos[i] = accountInfo{
+				AccountId:  a.config.AccountId,
+				Region:     a.config.Region,
+				QueueCount: len(snapshot.Queues),
+				TopicCount: len(snapshot.Topics),
+			}
+		}
+		writeJSON(w, infos)
+		return
+	}
+
+	var a *account
+	for _, v := range h.accounts {
+		if v.config.AccountId == path[0] {
+			a = v
+			break
+		}
+	}
+	if a == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(path) == 2 && path[1] == "queues":
+		snapshot := a.server.Snapshot()
+		now := a.server.Now()
+		infos := make([]queueInfo, len(snapshot.Queues))
+		for i := range snapshot.Queues {
+			q := &snapshot.Queues[i]
+			infos[i] = queueInfo{
+				Name:           q.Name,
+				Attributes:     q.Attributes,
+				CreateTime:     q.CreateTime,
+				LastModifyTime: q.LastModifyTime,
+			}
+			for j := range q.Messages {
+				switch m := &q.Messages[j]; {
+				case !m.NextVisibleTime.After(now):
+					infos[i].ActiveMessages++
+				case m.FirstDequeueTime.IsZero():
+					infos[i].DelayMessages++
+				default:
+					infos[i].InactiveMessages++
+				}
+			}
+		}
+		writeJSON(w, infos)
+	case len(path) == 2 && path[1] == "topics":
+		writeJSON(w, a.server.Snapshot().Topics)
+	case len(path) == 4 && path[1] == "queues" && path[3] == "messages":
+		msgs := a.server.Messages(path[2])
+		if msgs == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, msgs)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
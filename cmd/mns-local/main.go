@@ -0,0 +1,218 @@
+// mns-local 是在本地运行的 MNS 服务, 用于开发和调试.
+//
+// 支持队列, 主题和订阅的 HTTP API, 状态保存在 -data 目录下, 重启之后恢复;
+// 订阅的 HTTP Endpoint 会收到和 MNS 相同格式并且带有签名的推送请求.
+//
+//  mns-local -addr 127.0.0.1:8080 -data ./mns-data
+//  mns-local -config accounts.json
+//
+// accounts.json 的格式:
+//  {
+//      "accounts": [
+//          {
+//              "account_id": "1234567890123456",
+//              "region": "cn-hangzhou",
+//              "access_keys": {"test-access-key-id": "test-access-key-secret"},
+//              "security_token": ""
+//          }
+//      ]
+//  }
+//
+// 管理接口:
+//  GET /admin/accounts
+//  GET /admin/{AccountId}/queues
+//  GET /admin/{AccountId}/queues/{QueueName}/messages
+//  GET /admin/{AccountId}/topics
+//  GET /admin/signing-cert.pem
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+)
+
+type accountConfig struct {
+	AccountId     string            `json:"account_id"`
+	Region        string            `json:"region"`
+	AccessKeys    map[string]string `json:"access_keys"` // map[AccessKeyId]AccessKeySecret
+	SecurityToken string            `json:"security_token"`
+}
+
+type fileConfig struct {
+	Accounts []accountConfig `json:"accounts"`
+}
+
+type account struct {
+	config accountConfig
+	server *mnstest.Server
+	dirty  int32 // 1 表示有未保存的修改
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	dataDir := flag.String("data", "mns-data", "data directory, empty disables persistence")
+	configFile := flag.String("config", "", "accounts config file (JSON), overrides -account-id, -region, -access-key-id and -access-key-secret")
+	publicURL := flag.String("public-url", "", "URL clients use to reach this server, defaults to http://{addr}")
+	accountId := flag.String("account-id", "1234567890123456", "account id")
+	region := flag.String("region", "cn-hangzhou", "region")
+	accessKeyId := flag.String("access-key-id", "test-access-key-id", "access key id")
+	accessKeySecret := flag.String("access-key-secret", "test-access-key-secret", "access key secret")
+	flag.Parse()
+
+	configs := []accountConfig{{
+		AccountId:  *accountId,
+		Region:     *region,
+		AccessKeys: map[string]string{*accessKeyId: *accessKeySecret},
+	}}
+	if *configFile != "" {
+		var err error
+		if configs, err = loadConfig(*configFile); err != nil {
+			log.Fatalf("load config: %v", err)
+		}
+	}
+	if *publicURL == "" {
+		*publicURL = "http://" + *addr
+	}
+	*publicURL = strings.TrimSuffix(*publicURL, "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pusher, err := newPusher(ctx, *dataDir, *publicURL+"/admin/signing-cert.pem")
+	if err != nil {
+		log.Fatalf("init pusher: %v", err)
+	}
+	accounts := make([]*account, len(configs))
+	for i := range configs {
+		accounts[i] = newAccount(&configs[i], *publicURL, pusher)
+		if err = accounts[i].load(*dataDir); err != nil {
+			log.Fatalf("load account %s: %v", configs[i].AccountId, err)
+		}
+	}
+	h := &handler{
+		accounts: accounts,
+		pusher:   pusher,
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: h}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+	log.Printf("mns-local listening on %s, endpoint %s", *addr, *publicURL)
+	for _, a := range accounts {
+		log.Printf("account %s (%s)", a.config.AccountId, a.config.Region)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		flushLoop(ctx, *dataDir, accounts)
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	log.Print("shutting down")
+
+	// 长轮询的请求最多等待 30 秒, 不等待它们结束
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	srv.Shutdown(shutdownCtx)
+	cancel()
+	<-done
+}
+
+func loadConfig(filename string) ([]accountConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config fileConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Accounts) == 0 {
+		return nil, errors.New("no accounts")
+	}
+	seen := make(map[string]bool)
+	for _, a := range config.Accounts {
+		if a.AccountId == "" {
+			return nil, errors.New("account_id is required")
+		}
+		if seen[a.AccountId] {
+			return nil, errors.New("duplicate account_id " + a.AccountId)
+		}
+		seen[a.AccountId] = true
+		if len(a.AccessKeys) == 0 {
+			return nil, errors.New("account " + a.AccountId + " has no access_keys")
+		}
+	}
+	return config.Accounts, nil
+}
+
+func newAccount(config *accountConfig, publicURL string, pusher *pusher) *account {
+	keyIds := make([]string, 0, len(config.AccessKeys))
+	for id := range config.AccessKeys {
+		keyIds = append(keyIds, id)
+	}
+	sort.Strings(keyIds)
+
+	server := mnstest.NewUnstartedServer(&mnstest.Config{
+		AccessKeyId:     keyIds[0],
+		AccessKeySecret: config.AccessKeys[keyIds[0]],
+		AccessKeys:      config.AccessKeys,
+		SecurityToken:   config.SecurityToken,
+		AccountId:       config.AccountId,
+		Region:          config.Region,
+		Push:            pusher.Push,
+	})
+	server.URL = publicURL
+	return &account{
+		config: *config,
+		server: server,
+	}
+}
+
+type handler struct {
+	accounts []*account
+	pusher   *pusher
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		h.serveAdmin(w, r)
+		return
+	}
+	a := h.accountByAuthorization(r.Header.Get("Authorization"))
+	a.server.ServeHTTP(w, r)
+	a.markDirty() // ReceiveMessage 等 GET 请求也会修改状态
+}
+
+// accountByAuthorization 根据 Authorization 中的 AccessKeyId 查找账号, 找不到时返回第一个账号, 由它返回 InvalidAccessKeyId.
+//  Authorization: MNS AccessKeyId:Signature
+func (h *handler) accountByAuthorization(authorization string) *account {
+	authorization = strings.TrimPrefix(authorization, "MNS ")
+	if i := strings.IndexByte(authorization, ':'); i >= 0 {
+		accessKeyId := authorization[:i]
+		for _, a := range h.accounts {
+			if _, ok := a.config.AccessKeys[accessKeyId]; ok {
+				return a
+			}
+		}
+	}
+	return h.accounts[0]
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/client"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+func newTestHandler(t *testing.T, dataDir string) (*handler, *httptest.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := httptest.NewUnstartedServer(nil)
+	pusher, err := newPusher(ctx, dataDir, "http://"+srv.Listener.Addr().String()+"/admin/signing-cert.pem")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	config := accountConfig{
+		AccountId:  "1234567890123456",
+		Region:     "cn-hangzhou",
+		AccessKeys: map[string]string{"id": "secret"},
+	}
+	a := newAccount(&config, "http://"+srv.Listener.Addr().String(), pusher)
+	if err = a.load(dataDir); err != nil {
+		t.Fatal(err.Error())
+	}
+	h := &handler{accounts: []*account{a}, pusher: pusher}
+	srv.Config.Handler = h
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+func TestPush(t *testing.T) {
+	h, srv := newTestHandler(t, "")
+	config := mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"}
+
+	received := make(chan *http.Request, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Md5") != internal.ContentMD5(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		received <- r
+	}))
+	defer endpoint.Close()
+
+	tp := topic.New(srv.URL, "test", config)
+	if _, err := tp.CreateTopic(nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err := tp.Subscribe("http", &topic.SubscribeRequest{Endpoint: topic.HttpEndpoint(endpoint.URL + "/notify?a=b")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, _, err := tp.PublishMessage(&topic.PublishMessageRequest{MessageBody: []byte("hello")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Error("push timeout")
+		return
+	}
+
+	// 通过 x-mns-signing-cert-url 获取证书并验证签名
+	certURL, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Mns-Signing-Cert-Url"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	resp, err := http.Get(string(certURL))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	certPEM, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Errorf("invalid certificate: %s", certPEM)
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("Authorization"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	digest := sha1.Sum(internal.StringToSign(r.Method, r.Header, r.URL.RequestURI()))
+	if err = rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA1, digest[:], signature); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !h.pusher.key.PublicKey.Equal(cert.PublicKey) {
+		t.Error("certificate does not match the signing key")
+		return
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dataDir := t.TempDir()
+	config := mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"}
+
+	h, srv := newTestHandler(t, dataDir)
+	if _, err := client.New(srv.URL, config).CreateQueue("test", nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	_, sendResp, err := queue.New(srv.URL, "test", config).SendMessage(&queue.SendMessageRequest{MessageBody: []byte("hello")})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	flush(dataDir, h.accounts)
+
+	h2, srv2 := newTestHandler(t, dataDir)
+	_, msg, err := queue.New(srv2.URL, "test", config).ReceiveMessage(0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if msg.MessageId != sendResp.MessageId || string(msg.MessageBody) != "hello" {
+		t.Errorf("unexpected message: %+v", msg)
+		return
+	}
+	if !h.pusher.key.Equal(h2.pusher.key) {
+		t.Error("signing key should be reloaded from the data directory")
+		return
+	}
+}
+
+// TestPushHandler 验证 topic.PushHandler 可以接收 mns-local 推送的消息.
+func TestPushHandler(t *testing.T) {
+	h, srv := newTestHandler(t, "")
+	config := mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(h.pusher.certPEM)
+
+	received := make(chan *topic.Notification, 1)
+	endpoint := httptest.NewServer(topic.NewPushHandler(topic.NotificationHandlerFunc(func(ctx context.Context, n *topic.Notification) error {
+		received <- n
+		return nil
+	}), &topic.PushHandlerConfig{
+		Roots:     roots,
+		CertHosts: []string{"127.0.0.1"},
+		AllowHTTP: true,
+		OnError:   func(r *http.Request, err error) { t.Error(err.Error()) },
+	}))
+	defer endpoint.Close()
+
+	tp := topic.New(srv.URL, "test", config)
+	if _, err := tp.CreateTopic(nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err := tp.Subscribe("http", &topic.SubscribeRequest{Endpoint: topic.HttpEndpoint(endpoint.URL + "/notify?a=b")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, _, err := tp.PublishMessage(&topic.PublishMessageRequest{MessageBody: []byte("hello"), MessageTag: "tag"}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	select {
+	case n := <-received:
+		if n.TopicName != "test" || n.SubscriptionName != "http" || n.MessageTag != "tag" || string(n.Message) != "hello" {
+			t.Errorf("unexpected notification: %+v", n)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("push timeout")
+		return
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+// pusher 把发布到主题的消息推送给 HTTP Endpoint.
+//
+// 和 MNS 一样, 推送请求使用 SHA1withRSA 签名, 签名的原文和请求 MNS 时 HMAC-SHA1 签名的原文相同,
+// x-mns-signing-cert-url 是 base64 编码的证书地址, 接收方用证书中的公钥验证 Authorization.
+// 证书是自签名的, 使用 topic.PushHandler 接收时需要把 /admin/signing-cert.pem 加入到 PushHandlerConfig.Roots,
+// 证书地址是 http 的, 还需要设置 PushHandlerConfig.AllowHTTP.
+type pusher struct {
+	ctx     context.Context
+	client  *http.Client
+	key     *rsa.PrivateKey
+	certPEM []byte
+	certURL string
+	seq     int64
+}
+
+// newPusher 创建 pusher, 签名的密钥和证书保存在 dataDir 中, dataDir 为空时每次启动重新生成.
+func newPusher(ctx context.Context, dataDir, certURL string) (*pusher, error) {
+	key, certPEM, err := loadOrCreateSigningKey(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &pusher{
+		ctx:     ctx,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		key:     key,
+		certPEM: certPEM,
+		certURL: certURL,
+	}, nil
+}
+
+func loadOrCreateSigningKey(dataDir string) (key *rsa.PrivateKey, certPEM []byte, err error) {
+	var keyFile, certFile string
+	if dataDir != "" {
+		keyFile = filepath.Join(dataDir, "signing-key.pem")
+		certFile = filepath.Join(dataDir, "signing-cert.pem")
+		keyPEM, err1 := os.ReadFile(keyFile)
+		certPEM, err2 := os.ReadFile(certFile)
+		if err1 == nil && err2 == nil {
+			block, _ := pem.Decode(keyPEM)
+			if block == nil {
+				return nil, nil, errors.New("invalid " + keyFile)
+			}
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, nil, err
+			}
+			return key, certPEM, nil
+		}
+	}
+
+	if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: "mns-local"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if dataDir == "" {
+		return key, certPEM, nil
+	}
+
+	if err = os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return nil, nil, err
+	}
+	if err = os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return nil, nil, err
+	}
+	return key, certPEM, nil
+}
+
+// Push 实现 mnstest.Config.Push, 在新的 goroutine 中推送, 失败时按照 NotifyStrategy 重试.
+func (p *pusher) Push(msg *mnstest.Push) {
+	if !strings.HasPrefix(msg.Endpoint, "http://") && !strings.HasPrefix(msg.Endpoint, "https://") {
+		log.Printf("push %s: endpoint %s is not supported, message %s dropped", msg.SubscriptionName, msg.Endpoint, msg.MessageId)
+		return
+	}
+	go p.deliver(msg)
+}
+
+func (p *pusher) deliver(msg *mnstest.Push) {
+	for attempt := 0; ; attempt++ {
+		err := p.send(msg)
+		if err == nil {
+			return
+		}
+		delay, ok := retryDelay(msg.NotifyStrategy, attempt)
+		if !ok {
+			log.Printf("push %s to %s: %v, message %s dropped after %d attempts", msg.SubscriptionName, msg.Endpoint, err, msg.MessageId, attempt+1)
+			return
+		}
+		log.Printf("push %s to %s: %v, retry in %v", msg.SubscriptionName, msg.Endpoint, err, delay)
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay 返回第 attempt 次 (从 0 开始) 推送失败之后的重试间隔.
+//  BACKOFF_RETRY:           重试 3 次, 每次间隔 10 到 20 秒之间的随机值
+//  EXPONENTIAL_DECAY_RETRY: 重试 176 次, 间隔为 2^attempt 秒, 最大 512 秒, 总共大约 1 天
+func retryDelay(strategy string, attempt int) (delay time.Duration, ok bool) {
+	switch topic.NotifyStrategy(strategy) {
+	case topic.NotifyStrategyExponentialDecayRetry:
+		if attempt >= 176 {
+			return 0, false
+		}
+		if attempt > 9 {
+			attempt = 9
+		}
+		return time.Duration(1<<uint(attempt)) * time.Second, true
+	default:
+		if attempt >= 3 {
+			return 0, false
+		}
+		return 10*time.Second + time.Duration(mathrand.Int63n(int64(10*time.Second))), true
+	}
+}
+
+func (p *pusher) send(msg *mnstest.Push) error {
+	u, err := url.Parse(msg.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, msg.Endpoint, bytes.NewReader(msg.Body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(p.ctx)
+
+	header := req.Header
+	header.Set("Content-Md5", internal.ContentMD5(msg.Body))
+	header.Set("Content-Type", pushContentType(msg.NotifyContentFormat))
+	header.Set("Date", internal.FormatDate(time.Now()))
+	header.Set("X-Mns-Request-Id", fmt.Sprintf("%024X", atomic.AddInt64(&p.seq, 1)))
+	header.Set("X-Mns-Version", internal.Version)
+	header.Set("X-Mns-Signing-Cert-Url", base64.StdEncoding.EncodeToString([]byte(p.certURL)))
+	digest := sha1.Sum(internal.StringToSign(req.Method, header, u.RequestURI()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA1, digest[:])
+	if err != nil {
+		return err
+	}
+	header.Set("Authorization", base64.StdEncoding.EncodeToString(signature))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func pushContentType(notifyContentFormat string) string {
+	switch topic.NotifyContentFormat(notifyContentFormat) {
+	case topic.NotifyContentFormatJSON:
+		return "application/json; charset=utf-8"
+	case topic.NotifyContentFormatSimplified:
+		return "text/plain; charset=utf-8"
+	default:
+		return internal.ContentType
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+)
+
+func (a *account) markDirty() {
+	atomic.StoreInt32(&a.dirty, 1)
+}
+
+// filename 返回账号的数据文件, dataDir 为空时不保存.
+//  {dataDir}/{AccountId}.json
+func (a *account) filename(dataDir string) string {
+	return filepath.Join(dataDir, a.config.AccountId+".json")
+}
+
+// load 从 dataDir 恢复账号的状态, 数据文件不存在时什么都不做.
+func (a *account) load(dataDir string) error {
+	if dataDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.filename(dataDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var snapshot mnstest.Snapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	a.server.Restore(&snapshot)
+	return nil
+}
+
+// save 把账号的状态写入 dataDir, 先写临时文件再重命名, 避免中途退出时损坏数据文件.
+func (a *account) save(dataDir string) error {
+	if dataDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(a.server.Snapshot())
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	filename := a.filename(dataDir)
+	tmp := filename + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// flush 保存有修改的账号.
+func flush(dataDir string, accounts []*account) {
+	for _, a := range accounts {
+		if !atomic.CompareAndSwapInt32(&a.dirty, 1, 0) {
+			continue
+		}
+		if err := a.save(dataDir); err != nil {
+			a.markDirty()
+			log.Printf("save account %s: %v", a.config.AccountId, err)
+		}
+	}
+}
+
+// flushLoop 每秒保存一次有修改的账号, ctx 结束时最后保存一次之后返回.
+func flushLoop(ctx context.Context, dataDir string, accounts []*account) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flush(dataDir, accounts)
+			return
+		case <-ticker.C:
+			flush(dataDir, accounts)
+		}
+	}
+}
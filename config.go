@@ -10,7 +10,12 @@ type Config struct {
 	AccessKeySecret string
 
 	// following is optional
-	Timeout       time.Duration
-	Base64Enabled bool
-	HttpClient    *http.Client
+	SecurityToken       string              // STS 临时凭证的 SecurityToken
+	CredentialsProvider CredentialsProvider // 不为 nil 时每次请求都从这里获取凭证, 忽略上面的 AccessKeyId, AccessKeySecret 和 SecurityToken
+	Timeout             time.Duration
+	Base64Enabled       bool
+	HttpClient          *http.Client
+	RetryPolicy         *RetryPolicy  // 为 nil 时使用默认的重试策略
+	Interceptors        []Interceptor // 按照顺序拦截每一次 HTTP 请求, 第一个在最外层, 见 Interceptor
+	Metrics             MetricsHook   // 不为 nil 时接收每一次请求的指标
 }
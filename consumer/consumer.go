@@ -0,0 +1,203 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+// Handler 处理从队列中接收到的消息.
+//
+// 返回 nil 表示处理成功, 消息会被删除; 返回错误表示处理失败, 消息不会被删除,
+// 在队列的 VisibilityTimeout 之后会被重新消费.
+type Handler interface {
+	HandleMessage(ctx context.Context, msg *queue.Message) error
+}
+
+// HandlerFunc 把普通函数适配成 Handler.
+type HandlerFunc func(ctx context.Context, msg *queue.Message) error
+
+func (fn HandlerFunc) HandleMessage(ctx context.Context, msg *queue.Message) error {
+	return fn(ctx, msg)
+}
+
+type Config struct {
+	// following is optional
+	Receivers   int // 长轮询接收消息的 goroutine 个数, 默认为 1
+	Concurrency int // 处理消息的 goroutine 个数, 也是已经接收但是还没有处理完成的消息的最大个数, 默认为 16
+	BatchSize   int // 每次接收消息的最大个数, 1-16, 默认为 16
+	WaitSeconds int // 长轮询的等待时间, 1-30, 默认为 30
+
+	// VisibilityTimeout 大于 0 时, 处理消息期间通过 queue.Heartbeat 自动延长消息的不可见时间,
+	// 每次延长 VisibilityTimeout 秒, 用于处理时间可能超过队列 VisibilityTimeout 的 Handler.
+	VisibilityTimeout int
+
+	OnReceiveError func(err error)                     // 接收消息出错时调用, 队列中没有消息不算错误
+	OnHandleError  func(msg *queue.Message, err error) // Handler 返回错误时调用
+	OnDeleteError  func(msg *queue.Message, err error) // 处理成功后删除消息出错时调用
+}
+
+// receiveErrorBackoff 是接收消息出错后再次接收之前的等待时间.
+const receiveErrorBackoff = time.Second
+
+// Consumer 并发的从队列中接收并处理消息.
+type Consumer struct {
+	queue   queue.API
+	handler Handler
+	config  Config
+}
+
+// New 创建一个新的 Consumer, q 可以是 *queue.Queue 或者 queue.Decorator 等任意的 queue.API, config 可以为 nil.
+func New(q queue.API, handler Handler, config *Config) *Consumer {
+	c := &Consumer{
+		queue:   q,
+		handler: handler,
+	}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.Receivers <= 0 {
+		c.config.Receivers = 1
+	}
+	if c.config.Concurrency <= 0 {
+		c.config.Concurrency = 16
+	}
+	if c.config.BatchSize < 1 || c.config.BatchSize > 16 {
+		c.config.BatchSize = 16
+	}
+	if c.config.WaitSeconds < 1 || c.config.WaitSeconds > 30 {
+		c.config.WaitSeconds = 30
+	}
+	return c
+}
+
+// Run 开始接收并处理消息, 一直阻塞到 ctx 被取消, 返回 ctx.Err().
+//
+// ctx 被取消后不再接收新的消息, 已经接收到的消息会继续处理完成, 然后 Run 才返回.
+// 传给 Handler 的 ctx 包含 Run 的 ctx 的 values, 但是不会随着 Run 的 ctx 被取消.
+//
+// 已经接收但是还没有处理完成的消息最多 Concurrency 条, 避免消息在等待处理期间耗尽不可见时间.
+func (c *Consumer) Run(ctx context.Context) error {
+	msgs := make(chan *queue.Message)
+	slots := make(chan struct{}, c.config.Concurrency) // 信号量, 每条已经接收但是还没有处理完成的消息占用一个
+
+	var workers sync.WaitGroup
+	workers.Add(c.config.Concurrency)
+	handlerCtx := detachedContext{ctx}
+	for i := 0; i < c.config.Concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for msg := range msgs {
+				c.handle(handlerCtx, msg)
+				<-slots
+			}
+		}()
+	}
+
+	var receivers sync.WaitGroup
+	receivers.Add(c.config.Receivers)
+	for i := 0; i < c.config.Receivers; i++ {
+		go func() {
+			defer receivers.Done()
+			c.receive(ctx, msgs, slots)
+		}()
+	}
+
+	receivers.Wait()
+	close(msgs)
+	workers.Wait()
+	return ctx.Err()
+}
+
+// receive 循环接收消息并发送到 msgs, 直到 ctx 被取消, 每次最多接收 slots 中空闲的个数.
+func (c *Consumer) receive(ctx context.Context, msgs chan<- *queue.Message, slots chan struct{}) {
+	for ctx.Err() == nil {
+		n := acquire(ctx, slots, c.config.BatchSize)
+		if n == 0 {
+			return
+		}
+		_, batch, err := c.queue.BatchReceiveMessageContext(ctx, n, c.config.WaitSeconds)
+		for i := len(batch); i < n; i++ {
+			<-slots
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if mns.IsMessageNotExist(err) {
+				continue
+			}
+			if c.config.OnReceiveError != nil {
+				c.config.OnReceiveError(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(receiveErrorBackoff):
+			}
+			continue
+		}
+		// 已经接收到的消息必须交给 worker 处理, 即使 ctx 已经被取消, 否则要等 VisibilityTimeout 之后才能被重新消费.
+		for i := range batch {
+			if i >= n {
+				slots <- struct{}{} // 返回的消息多于请求的个数
+			}
+			msgs <- &batch[i]
+		}
+	}
+}
+
+// acquire 阻塞到 slots 中至少有一个空闲, 然后最多占用 max 个, 返回占用的个数, ctx 被取消时返回 0.
+func acquire(ctx context.Context, slots chan struct{}, max int) (n int) {
+	select {
+	case <-ctx.Done():
+		return 0
+	case slots <- struct{}{}:
+		n = 1
+	}
+	for n < max {
+		select {
+		case slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func (c *Consumer) handle(ctx context.Context, msg *queue.Message) {
+	lease := queue.NewLease(c.queue, msg)
+	var err error
+	if c.config.VisibilityTimeout > 0 {
+		heartbeat := lease.StartHeartbeat(ctx, c.config.VisibilityTimeout)
+		err = c.handler.HandleMessage(ctx, msg)
+		heartbeat.Stop()
+	} else {
+		err = c.handler.HandleMessage(ctx, msg)
+	}
+	if err != nil {
+		if c.config.OnHandleError != nil {
+			c.config.OnHandleError(msg, err)
+		}
+		return
+	}
+	if err = lease.Ack(ctx); err != nil {
+		if c.config.OnDeleteError != nil {
+			c.config.OnDeleteError(msg, err)
+		}
+	}
+}
+
+// detachedContext 保留 parent 的 values, 但是不会被 parent 取消.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key interface{}) interface{}     { return c.parent.Value(key) }
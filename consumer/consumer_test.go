@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+// testQueueServer 第一次接收返回 bodies 对应的消息, 之后返回队列为空, 并记录被删除的 ReceiptHandle.
+type testQueueServer struct {
+	mu       sync.Mutex
+	bodies   []string
+	received bool
+	deleted  []string
+}
+
+func (s *testQueueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.received {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>MessageNotExist</Code><Message>Message not exist.</Message></Error>`)
+			return
+		}
+		s.received = true
+		fmt.Fprint(w, "<Messages>")
+		for i, body := range s.bodies {
+			fmt.Fprintf(w, "<Message><MessageId>%d</MessageId><ReceiptHandle>handle-%s</ReceiptHandle><MessageBody>%s</MessageBody><MessageBodyMD5>%s</MessageBodyMD5></Message>",
+				i, body, body, internal.MessageBodyMD5([]byte(body)))
+		}
+		fmt.Fprint(w, "</Messages>")
+	case http.MethodDelete:
+		s.deleted = append(s.deleted, r.URL.Query().Get("ReceiptHandle"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	s := &testQueueServer{bodies: []string{"a", "bad", "b", "c"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.bodies))
+	handler := HandlerFunc(func(ctx context.Context, msg *queue.Message) error {
+		defer wg.Done()
+		if string(msg.MessageBody) == "bad" {
+			return errors.New("bad message")
+		}
+		return nil
+	})
+	var handleErrors int
+	c := New(q, handler, &Config{
+		Concurrency: 2,
+		OnHandleError: func(msg *queue.Message, err error) {
+			handleErrors++
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	wg.Wait()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("have:%v, want:%v", err, context.Canceled)
+		return
+	}
+
+	sort.Strings(s.deleted)
+	if have, want := strings.Join(s.deleted, ","), "handle-a,handle-b,handle-c"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if handleErrors != 1 {
+		t.Errorf("have:%d, want:%d", handleErrors, 1)
+		return
+	}
+}
+
+func TestConsumerDrainsOnShutdown(t *testing.T) {
+	s := &testQueueServer{bodies: []string{"a", "b"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := HandlerFunc(func(hctx context.Context, msg *queue.Message) error {
+		cancel() // 模拟处理过程中开始关闭
+		time.Sleep(20 * time.Millisecond)
+		return hctx.Err()
+	})
+	// Consumer 可以使用任意的 queue.API
+	if err := New(queue.Decorator{Next: q}, handler, &Config{Concurrency: 1}).Run(ctx); err != context.Canceled {
+		t.Errorf("have:%v, want:%v", err, context.Canceled)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.deleted) != 2 {
+		t.Errorf("have:%d, want:%d", len(s.deleted), 2)
+		return
+	}
+}
+
+// TestConsumerPrefetch 验证已经接收但是还没有处理完成的消息不超过 Concurrency 条.
+func TestConsumerPrefetch(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		n := r.URL.Query().Get("numOfMessages")
+		mu.Lock()
+		requested = append(requested, n)
+		mu.Unlock()
+		fmt.Fprint(w, "<Messages>")
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(w, "<Message><MessageId>%d</MessageId><ReceiptHandle>handle</ReceiptHandle><MessageBody>a</MessageBody><MessageBodyMD5>%s</MessageBodyMD5></Message>", i, internal.MessageBodyMD5([]byte("a")))
+		}
+		fmt.Fprint(w, "</Messages>")
+	}))
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled int32
+	handler := HandlerFunc(func(hctx context.Context, msg *queue.Message) error {
+		if atomic.AddInt32(&handled, 1) == 2 {
+			time.Sleep(50 * time.Millisecond) // 第二批请求必须等到有空闲
+			cancel()
+		}
+		return nil
+	})
+	New(q, handler, &Config{Concurrency: 2, BatchSize: 16}).Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, n := range requested {
+		if n != "2" && n != "1" {
+			t.Errorf("have:%v, want numOfMessages <= 2", requested)
+			return
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package mns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Credentials 是访问 MNS 的凭证, SecurityToken 不为空时表示 STS 临时凭证.
+type Credentials struct {
+	AccessKeyId     string
+	AccessKeySecret string
+	SecurityToken   string
+}
+
+// CredentialsProvider 提供访问 MNS 的凭证, 每次请求都会调用 Credentials, 实现需要并发安全, 并自行缓存.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (*Credentials, error)
+}
+
+type staticCredentialsProvider struct {
+	credentials Credentials
+}
+
+// NewStaticCredentialsProvider 返回固定凭证的 CredentialsProvider, securityToken 可以为空.
+func NewStaticCredentialsProvider(accessKeyId, accessKeySecret, securityToken string) CredentialsProvider {
+	return &staticCredentialsProvider{
+		credentials: Credentials{
+			AccessKeyId:     accessKeyId,
+			AccessKeySecret: accessKeySecret,
+			SecurityToken:   securityToken,
+		},
+	}
+}
+
+func (p *staticCredentialsProvider) Credentials(ctx context.Context) (*Credentials, error) {
+	credentials := p.credentials
+	return &credentials, nil
+}
+
+// RotatingCredentialsProvider 是可以在运行时替换的 CredentialsProvider, 用于不重新创建 Queue 和 Topic 的情况下轮换凭证.
+//
+// 多个 mns.Config 共享同一个 RotatingCredentialsProvider 时, 替换立即对所有的 Queue 和 Topic 生效:
+// 已经签名的请求继续使用旧的凭证, 之后的请求 (包括重试) 使用新的凭证.
+type RotatingCredentialsProvider struct {
+	v atomic.Value // rotatingCredentials
+}
+
+type rotatingCredentials struct {
+	provider CredentialsProvider
+}
+
+// NewRotatingCredentialsProvider 创建 RotatingCredentialsProvider, provider 为初始的 CredentialsProvider.
+func NewRotatingCredentialsProvider(provider CredentialsProvider) *RotatingCredentialsProvider {
+	p := &RotatingCredentialsProvider{}
+	p.SetProvider(provider)
+	return p
+}
+
+// SetProvider 原子的替换为 provider.
+func (p *RotatingCredentialsProvider) SetProvider(provider CredentialsProvider) {
+	if provider == nil {
+		panic("nil CredentialsProvider")
+	}
+	p.v.Store(rotatingCredentials{provider: provider})
+}
+
+// SetCredentials 原子的替换为固定的凭证, securityToken 可以为空.
+func (p *RotatingCredentialsProvider) SetCredentials(accessKeyId, accessKeySecret, securityToken string) {
+	p.SetProvider(NewStaticCredentialsProvider(accessKeyId, accessKeySecret, securityToken))
+}
+
+func (p *RotatingCredentialsProvider) Credentials(ctx context.Context) (*Credentials, error) {
+	return p.v.Load().(rotatingCredentials).provider.Credentials(ctx)
+}
+
+const (
+	EnvAccessKeyId     = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	EnvAccessKeySecret = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	EnvSecurityToken   = "ALIBABA_CLOUD_SECURITY_TOKEN"
+)
+
+type envCredentialsProvider struct{}
+
+// NewEnvCredentialsProvider 返回从环境变量读取凭证的 CredentialsProvider, 每次请求都会重新读取.
+//  ALIBABA_CLOUD_ACCESS_KEY_ID:     必须
+//  ALIBABA_CLOUD_ACCESS_KEY_SECRET: 必须
+//  ALIBABA_CLOUD_SECURITY_TOKEN:    可选
+func NewEnvCredentialsProvider() CredentialsProvider {
+	return envCredentialsProvider{}
+}
+
+func (envCredentialsProvider) Credentials(ctx context.Context) (*Credentials, error) {
+	credentials := &Credentials{
+		AccessKeyId:     os.Getenv(EnvAccessKeyId),
+		AccessKeySecret: os.Getenv(EnvAccessKeySecret),
+		SecurityToken:   os.Getenv(EnvSecurityToken),
+	}
+	if credentials.AccessKeyId == "" || credentials.AccessKeySecret == "" {
+		return nil, errors.New("mns: environment variable " + EnvAccessKeyId + " or " + EnvAccessKeySecret + " is not set")
+	}
+	return credentials, nil
+}
+
+type fileCredentialsProvider struct {
+	filename string
+	profile  string
+
+	mu          sync.Mutex
+	modTime     time.Time
+	credentials *Credentials
+}
+
+// NewFileCredentialsProvider 返回从凭证文件读取凭证的 CredentialsProvider, 文件被修改之后会重新读取.
+//  filename: 凭证文件的路径, 为空时使用环境变量 ALIBABA_CLOUD_CREDENTIALS_FILE, 还为空使用 ~/.alibabacloud/credentials
+//  profile:  使用的配置段, 为空时使用环境变量 ALIBABA_CLOUD_PROFILE, 还为空使用 default
+//
+// 凭证文件的格式为:
+//  [default]
+//  type = access_key           # access_key 或者 sts, 可以省略
+//  access_key_id = foo
+//  access_key_secret = bar
+//  security_token = baz        # type 为 sts 时需要
+func NewFileCredentialsProvider(filename, profile string) CredentialsProvider {
+	if filename == "" {
+		filename = os.Getenv("ALIBABA_CLOUD_CREDENTIALS_FILE")
+	}
+	if filename == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			filename = filepath.Join(home, ".alibabacloud", "credentials")
+		}
+	}
+	if profile == "" {
+		profile = os.Getenv("ALIBABA_CLOUD_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	return &fileCredentialsProvider{
+		filename: filename,
+		profile:  profile,
+	}
+}
+
+func (p *fileCredentialsProvider) Credentials(ctx context.Context) (*Credentials, error) {
+	fi, err := os.Stat(p.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.credentials == nil || !fi.ModTime().Equal(p.modTime) {
+		credentials, err := p.load()
+		if err != nil {
+			return nil, err
+		}
+		p.credentials = credentials
+		p.modTime = fi.ModTime()
+	}
+	credentials := *p.credentials
+	return &credentials, nil
+}
+
+func (p *fileCredentialsProvider) load() (*Credentials, error) {
+	file, err := os.Open(p.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		found       bool
+		section     string
+		typ         string
+		credentials Credentials
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == p.profile {
+				found = true
+			}
+			continue
+		}
+		if section != p.profile {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+		k, v := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if j := strings.Index(v, " #"); j >= 0 {
+			v = strings.TrimSpace(v[:j])
+		}
+		switch k {
+		case "type":
+			typ = v
+		case "access_key_id":
+			credentials.AccessKeyId = v
+		case "access_key_secret":
+			credentials.AccessKeySecret = v
+		case "security_token":
+			credentials.SecurityToken = v
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !found:
+		return nil, errors.New("mns: profile " + p.profile + " not found in " + p.filename)
+	case typ != "" && typ != "access_key" && typ != "sts":
+		return nil, errors.New("mns: unsupported credentials type " + typ + " in profile " + p.profile)
+	case credentials.AccessKeyId == "" || credentials.AccessKeySecret == "":
+		return nil, errors.New("mns: access_key_id or access_key_secret is empty in profile " + p.profile)
+	}
+	return &credentials, nil
+}
+
+const defaultECSRAMRoleEndpoint = "http://100.100.100.200/latest/meta-data/ram/security-credentials/"
+
+type ECSRAMRoleCredentialsConfig struct {
+	// following is optional
+	Endpoint      string        // 元数据服务的地址, 默认为 http://100.100.100.200/latest/meta-data/ram/security-credentials/
+	HttpClient    *http.Client  // 默认为超时时间 5s 的 http.Client
+	RefreshBefore time.Duration // 在凭证过期之前多久刷新, 默认为 5 分钟
+}
+
+// ECSRAMRoleCredentialsProvider 从 ECS 实例的元数据服务获取 RAM 角色的 STS 临时凭证.
+//
+// 凭证会被缓存, 在过期之前 RefreshBefore 刷新; 刷新失败时如果缓存的凭证还没有过期, 继续使用缓存的凭证.
+type ECSRAMRoleCredentialsProvider struct {
+	roleName string
+	config   ECSRAMRoleCredentialsConfig
+
+	mu          sync.Mutex
+	credentials *Credentials
+	expiration  time.Time
+	refreshing  chan struct{} // 正在刷新时不为 nil, 刷新结束后关闭
+}
+
+// NewECSRAMRoleCredentialsProvider 创建 ECSRAMRoleCredentialsProvider, config 可以为 nil.
+// roleName 为空时从元数据服务获取实例绑定的 RAM 角色.
+func NewECSRAMRoleCredentialsProvider(roleName string, config *ECSRAMRoleCredentialsConfig) *ECSRAMRoleCredentialsProvider {
+	p := &ECSRAMRoleCredentialsProvider{
+		roleName: roleName,
+	}
+	if config != nil {
+		p.config = *config
+	}
+	if p.config.Endpoint == "" {
+		p.config.Endpoint = defaultECSRAMRoleEndpoint
+	}
+	if !strings.HasSuffix(p.config.Endpoint, "/") {
+		p.config.Endpoint += "/"
+	}
+	if p.config.HttpClient == nil {
+		p.config.HttpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if p.config.RefreshBefore <= 0 {
+		p.config.RefreshBefore = 5 * time.Minute
+	}
+	return p
+}
+
+// Credentials 返回缓存的凭证, 需要刷新时只有一个 goroutine 请求元数据服务,
+// 刷新期间其他的 goroutine 继续使用还没有过期的凭证, 缓存的凭证已经过期时等待刷新完成.
+func (p *ECSRAMRoleCredentialsProvider) Credentials(ctx context.Context) (*Credentials, error) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		if p.credentials != nil && now.Add(p.config.RefreshBefore).Before(p.expiration) {
+			credentials := *p.credentials
+			p.mu.Unlock()
+			return &credentials, nil
+		}
+		if p.refreshing == nil {
+			p.refreshing = make(chan struct{})
+			p.mu.Unlock()
+			return p.refresh(ctx)
+		}
+		if p.credentials != nil && now.Before(p.expiration) {
+			credentials := *p.credentials
+			p.mu.Unlock()
+			return &credentials, nil
+		}
+		refreshing := p.refreshing
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-refreshing:
+		}
+	}
+}
+
+// refresh 在不持有 p.mu 的情况下请求元数据服务, 结束后更新缓存并关闭 p.refreshing.
+func (p *ECSRAMRoleCredentialsProvider) refresh(ctx context.Context) (*Credentials, error) {
+	credentials, expiration, err := p.fetch(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.refreshing)
+	p.refreshing = nil
+	if err != nil {
+		if p.credentials != nil && time.Now().Before(p.expiration) {
+			credentials := *p.credentials
+			return &credentials, nil
+		}
+		return nil, err
+	}
+	p.credentials = credentials
+	p.expiration = expiration
+	result := *credentials
+	return &result, nil
+}
+
+func (p *ECSRAMRoleCredentialsProvider) fetch(ctx context.Context) (credentials *Credentials, expiration time.Time, err error) {
+	roleName := p.roleName
+	if roleName == "" {
+		var body []byte
+		if body, err = p.get(ctx, p.config.Endpoint); err != nil {
+			return
+		}
+		if roleName = strings.TrimSpace(string(body)); roleName == "" {
+			err = errors.New("mns: no RAM role attached to the ECS instance")
+			return
+		}
+		p.roleName = roleName
+	}
+
+	body, err := p.get(ctx, p.config.Endpoint+roleName)
+	if err != nil {
+		return
+	}
+	var result struct {
+		Code            string `json:"Code"`
+		AccessKeyId     string `json:"AccessKeyId"`
+		AccessKeySecret string `json:"AccessKeySecret"`
+		SecurityToken   string `json:"SecurityToken"`
+		Expiration      string `json:"Expiration"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return
+	}
+	if result.Code != "Success" {
+		err = errors.New("mns: failed to get credentials of RAM role " + roleName + ", code: " + result.Code)
+		return
+	}
+	if expiration, err = time.Parse(time.RFC3339, result.Expiration); err != nil {
+		return
+	}
+	credentials = &Credentials{
+		AccessKeyId:     result.AccessKeyId,
+		AccessKeySecret: result.AccessKeySecret,
+		SecurityToken:   result.SecurityToken,
+	}
+	return
+}
+
+func (p *ECSRAMRoleCredentialsProvider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.config.HttpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("mns: unexpected status " + resp.Status + " from " + url)
+	}
+	return body, nil
+}
@@ -0,0 +1,279 @@
+package mns
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticCredentialsProvider(t *testing.T) {
+	p := NewStaticCredentialsProvider("id", "secret", "token")
+	have, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	want := Credentials{AccessKeyId: "id", AccessKeySecret: "secret", SecurityToken: "token"}
+	if *have != want {
+		t.Errorf("have:%+v, want:%+v", *have, want)
+		return
+	}
+}
+
+func TestEnvCredentialsProvider(t *testing.T) {
+	t.Setenv(EnvAccessKeyId, "")
+	t.Setenv(EnvAccessKeySecret, "")
+	t.Setenv(EnvSecurityToken, "")
+	p := NewEnvCredentialsProvider()
+	if _, err := p.Credentials(context.Background()); err == nil {
+		t.Error("want error when environment variables are not set")
+		return
+	}
+
+	t.Setenv(EnvAccessKeyId, "id")
+	t.Setenv(EnvAccessKeySecret, "secret")
+	t.Setenv(EnvSecurityToken, "token")
+	have, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	want := Credentials{AccessKeyId: "id", AccessKeySecret: "secret", SecurityToken: "token"}
+	if *have != want {
+		t.Errorf("have:%+v, want:%+v", *have, want)
+		return
+	}
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	content := `
+# comment
+[default]
+type = access_key
+access_key_id = id
+access_key_secret = secret
+
+[sts]
+type = sts
+access_key_id = sts-id
+access_key_secret = sts-secret
+security_token = sts-token # comment
+
+[ecs]
+type = ecs_ram_role
+role_name = role
+`
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tests := []struct {
+		profile string
+		want    *Credentials
+	}{
+		{"", &Credentials{AccessKeyId: "id", AccessKeySecret: "secret"}},
+		{"sts", &Credentials{AccessKeyId: "sts-id", AccessKeySecret: "sts-secret", SecurityToken: "sts-token"}},
+		{"ecs", nil},
+		{"missing", nil},
+	}
+	for _, v := range tests {
+		have, err := NewFileCredentialsProvider(filename, v.profile).Credentials(context.Background())
+		if v.want == nil {
+			if err == nil {
+				t.Errorf("profile %q: want error", v.profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("profile %q: %s", v.profile, err.Error())
+			continue
+		}
+		if *have != *v.want {
+			t.Errorf("profile %q: have:%+v, want:%+v", v.profile, *have, *v.want)
+		}
+	}
+}
+
+func TestFileCredentialsProviderReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(filename, []byte("[default]\naccess_key_id = id1\naccess_key_secret = secret1\n"), 0600); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	p := NewFileCredentialsProvider(filename, "")
+	if have, err := p.Credentials(context.Background()); err != nil || have.AccessKeyId != "id1" {
+		t.Errorf("have:%+v, %v, want:id1", have, err)
+		return
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("[default]\naccess_key_id = id2\naccess_key_secret = secret2\n"), 0600); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	modTime := time.Now().Add(time.Second)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, err := p.Credentials(context.Background()); err != nil || have.AccessKeyId != "id2" {
+		t.Errorf("have:%+v, %v, want:id2", have, err)
+		return
+	}
+}
+
+func newECSMetadataServer(t *testing.T, expiration *atomic.Value, fail *int32) (srv *httptest.Server, fetches *int32) {
+	fetches = new(int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/meta-data/ram/security-credentials/":
+			w.Write([]byte("role"))
+		case "/latest/meta-data/ram/security-credentials/role":
+			if atomic.LoadInt32(fail) != 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			n := atomic.AddInt32(fetches, 1)
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"STS.id` + string(rune('0'+n)) + `","AccessKeySecret":"secret","SecurityToken":"token","Expiration":"` + expiration.Load().(time.Time).UTC().Format(time.RFC3339) + `","LastUpdated":"2020-01-01T00:00:00Z"}`))
+		default:
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return
+}
+
+func TestECSRAMRoleCredentialsProvider(t *testing.T) {
+	var expiration atomic.Value
+	var fail int32
+	expiration.Store(time.Now().Add(time.Hour))
+	srv, fetches := newECSMetadataServer(t, &expiration, &fail)
+	defer srv.Close()
+
+	p := NewECSRAMRoleCredentialsProvider("", &ECSRAMRoleCredentialsConfig{
+		Endpoint:      srv.URL + "/latest/meta-data/ram/security-credentials",
+		RefreshBefore: 10 * time.Minute,
+	})
+
+	// 第一次请求获取凭证, 之后使用缓存的凭证
+	for i := 0; i < 3; i++ {
+		have, err := p.Credentials(context.Background())
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if have.AccessKeyId != "STS.id1" || have.SecurityToken != "token" {
+			t.Errorf("have:%+v, want:STS.id1", *have)
+			return
+		}
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("have:%d, want:%d", n, 1)
+		return
+	}
+
+	// 快要过期时刷新
+	p.mu.Lock()
+	p.expiration = time.Now().Add(5 * time.Minute)
+	p.mu.Unlock()
+	have, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have.AccessKeyId != "STS.id2" {
+		t.Errorf("have:%s, want:%s", have.AccessKeyId, "STS.id2")
+		return
+	}
+
+	// 刷新失败时继续使用还没有过期的凭证
+	atomic.StoreInt32(&fail, 1)
+	p.mu.Lock()
+	p.expiration = time.Now().Add(5 * time.Minute)
+	p.mu.Unlock()
+	if have, err = p.Credentials(context.Background()); err != nil || have.AccessKeyId != "STS.id2" {
+		t.Errorf("have:%+v, %v, want:STS.id2", have, err)
+		return
+	}
+
+	// 已经过期并且刷新失败时返回错误
+	p.mu.Lock()
+	p.expiration = time.Now().Add(-time.Second)
+	p.mu.Unlock()
+	if _, err = p.Credentials(context.Background()); err == nil {
+		t.Error("want error when credentials expired and refresh failed")
+		return
+	}
+}
+
+func TestECSRAMRoleCredentialsProviderConcurrentRefresh(t *testing.T) {
+	var fetches int32
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fetches, 1)
+		if n == 2 {
+			close(started)
+			<-release
+		}
+		w.Write([]byte(`{"Code":"Success","AccessKeyId":"STS.id` + string(rune('0'+n)) + `","AccessKeySecret":"secret","SecurityToken":"token","Expiration":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`))
+	}))
+	defer srv.Close()
+
+	p := NewECSRAMRoleCredentialsProvider("role", &ECSRAMRoleCredentialsConfig{
+		Endpoint:      srv.URL,
+		RefreshBefore: 10 * time.Minute,
+	})
+	if _, err := p.Credentials(context.Background()); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	p.mu.Lock()
+	p.expiration = time.Now().Add(5 * time.Minute)
+	p.mu.Unlock()
+
+	refreshed := make(chan string, 1)
+	go func() {
+		have, err := p.Credentials(context.Background())
+		if err != nil {
+			refreshed <- err.Error()
+			return
+		}
+		refreshed <- have.AccessKeyId
+	}()
+	<-started
+
+	// 刷新期间不阻塞, 返回缓存的凭证, 也不会再次请求元数据服务
+	cached := make(chan string, 1)
+	go func() {
+		have, err := p.Credentials(context.Background())
+		if err != nil {
+			cached <- err.Error()
+			return
+		}
+		cached <- have.AccessKeyId
+	}()
+	select {
+	case have := <-cached:
+		if have != "STS.id1" {
+			t.Errorf("have:%s, want:%s", have, "STS.id1")
+		}
+	case <-time.After(time.Second):
+		t.Error("Credentials blocked while refreshing")
+	}
+	close(release)
+	if have := <-refreshed; have != "STS.id2" {
+		t.Errorf("have:%s, want:%s", have, "STS.id2")
+		return
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+}
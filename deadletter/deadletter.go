@@ -0,0 +1,184 @@
+// Package deadletter 把多次消费失败的消息转移到死信队列, 并且可以把死信队列中的消息重新发送回原来的队列.
+//
+// 这个版本的 MNS 队列没有死信队列的功能, 一直处理失败的消息会被无限次的重新消费.
+// Router 在 Message.DequeueCount 超过 MaxDequeueCount 时把消息发送到死信队列并删除原来的消息,
+// 死信队列中的消息使用 mns.EncodeEnvelope 的信封格式, header 中记录原来的队列, MessageId, 入队时间和最后一次的错误等信息.
+//
+//  router := deadletter.New(q, "orders", dlq, &deadletter.Config{MaxDequeueCount: 5})
+//  c := consumer.New(q, router.Handler(handler), nil)
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/consumer"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+// 死信消息的信封 header
+const (
+	HeaderSourceQueue  = "mns-dead-letter-source-queue"  // 原来的队列名称
+	HeaderMessageId    = "mns-dead-letter-message-id"    // 原来的 MessageId
+	HeaderEnqueueTime  = "mns-dead-letter-enqueue-time"  // 原来的消息的入队时间, 从 1970-1-1 00:00:00 到现在的毫秒值
+	HeaderDequeueCount = "mns-dead-letter-dequeue-count" // 原来的消息被消费的次数
+	HeaderError        = "mns-dead-letter-error"         // 最后一次处理的错误
+	HeaderTime         = "mns-dead-letter-time"          // 转移到死信队列的时间, 从 1970-1-1 00:00:00 到现在的毫秒值
+)
+
+// ErrMaxDequeueCountExceeded 是消息在处理之前 DequeueCount 就已经超过 MaxDequeueCount 时记录的错误,
+// 比如处理消息时进程崩溃或者超时, 没有机会返回错误.
+var ErrMaxDequeueCountExceeded = errors.New("the DequeueCount of the message exceeds MaxDequeueCount")
+
+// ErrDeadLetterTooLarge 表示消息加上信封之后超过了 MaxMessageSize, 不能发送到死信队列.
+var ErrDeadLetterTooLarge = errors.New("the dead letter is larger than MaxMessageSize")
+
+type Config struct {
+	MaxDequeueCount int // 消息被消费超过 MaxDequeueCount 次之后转移到死信队列, 默认为 5
+
+	// following is optional
+	MaxMessageSize int                                 // 死信队列的 MaximumMessageSize, 默认为 queue.MaxMessageBodyBytes
+	OnMoveError    func(msg *queue.Message, err error) // Handler 转移消息出错时调用, 比如 ErrDeadLetterTooLarge, 消息会在 VisibilityTimeout 之后被重新消费
+}
+
+const (
+	defaultMaxDequeueCount = 5
+	maxErrorBytes          = 1024 // HeaderError 的最大字节数, 超过的部分被截断
+)
+
+// Router 把消息转移到死信队列.
+type Router struct {
+	source     queue.API
+	sourceName string
+	dlq        queue.API
+	config     Config
+}
+
+// New 创建 Router, source 是消费的队列, sourceName 是它的名称, dlq 是死信队列, config 可以为 nil.
+func New(source queue.API, sourceName string, dlq queue.API, config *Config) *Router {
+	r := &Router{
+		source:     source,
+		sourceName: sourceName,
+		dlq:        dlq,
+	}
+	if config != nil {
+		r.config = *config
+	}
+	if r.config.MaxDequeueCount <= 0 {
+		r.config.MaxDequeueCount = defaultMaxDequeueCount
+	}
+	if r.config.MaxMessageSize <= 0 || r.config.MaxMessageSize > queue.MaxMessageBodyBytes {
+		r.config.MaxMessageSize = queue.MaxMessageBodyBytes
+	}
+	return r
+}
+
+// Handler 返回包装了 next 的 consumer.Handler:
+//  处理之前 DequeueCount 已经超过 MaxDequeueCount 时, 不调用 next, 直接转移到死信队列;
+//  next 返回错误并且 DequeueCount 已经达到 MaxDequeueCount 时, 转移到死信队列, 记录 next 返回的错误.
+// 转移成功之后返回 nil, 由 consumer.Consumer 删除原来的消息; 转移失败时返回错误, 消息之后会被重新消费.
+func (r *Router) Handler(next consumer.Handler) consumer.Handler {
+	return consumer.HandlerFunc(func(ctx context.Context, msg *queue.Message) error {
+		if msg.DequeueCount > r.config.MaxDequeueCount {
+			return r.send(ctx, msg, ErrMaxDequeueCountExceeded)
+		}
+		err := next.HandleMessage(ctx, msg)
+		if err == nil || msg.DequeueCount < r.config.MaxDequeueCount {
+			return err
+		}
+		return r.send(ctx, msg, err)
+	})
+}
+
+func (r *Router) send(ctx context.Context, msg *queue.Message, cause error) error {
+	if err := r.Send(ctx, msg, cause); err != nil {
+		if r.config.OnMoveError != nil {
+			r.config.OnMoveError(msg, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Move 把 msg 发送到死信队列, 然后从原来的队列中删除, cause 是最后一次处理的错误, 可以为 nil.
+// 不使用 consumer.Consumer 的调用方在 DequeueCount 超过阈值时调用.
+func (r *Router) Move(ctx context.Context, msg *queue.Message, cause error) error {
+	if err := r.Send(ctx, msg, cause); err != nil {
+		return err
+	}
+	_, err := r.source.DeleteMessageContext(ctx, msg.ReceiptHandle)
+	return err
+}
+
+// Send 只把 msg 发送到死信队列, 不删除原来的消息, cause 可以为 nil.
+// cause 的错误信息超过 1024 字节时被截断; 加上信封之后超过 MaxMessageSize 时不发送, 返回 ErrDeadLetterTooLarge.
+func (r *Router) Send(ctx context.Context, msg *queue.Message, cause error) error {
+	header := map[string]string{
+		HeaderSourceQueue:  r.sourceName,
+		HeaderMessageId:    msg.MessageId,
+		HeaderEnqueueTime:  strconv.FormatInt(msg.EnqueueTime, 10),
+		HeaderDequeueCount: strconv.Itoa(msg.DequeueCount),
+		HeaderTime:         strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+	}
+	if cause != nil {
+		header[HeaderError] = truncate(cause.Error(), maxErrorBytes)
+	}
+	req := &queue.SendMessageRequest{
+		MessageBody: mns.EncodeEnvelope(header, msg.MessageBody),
+		Priority:    msg.Priority,
+	}
+	if size := queue.EstimateMessageBodySize(r.dlq, req); size > r.config.MaxMessageSize {
+		return fmt.Errorf("%w: the message %s is %d bytes, the limit is %d bytes", ErrDeadLetterTooLarge, msg.MessageId, size, r.config.MaxMessageSize)
+	}
+	_, _, err := r.dlq.SendMessageContext(ctx, req)
+	return err
+}
+
+// truncate 把 s 截断到最多 n 个字节, 不截断 UTF-8 字符, 截断时以 "..." 结尾.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	n -= len("...")
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// DeadLetter 是死信队列中的一条消息, 见 Decode.
+type DeadLetter struct {
+	SourceQueue  string
+	MessageId    string
+	EnqueueTime  int64 // 毫秒
+	DequeueCount int
+	Error        string
+	Time         int64  // 转移到死信队列的时间, 毫秒
+	Body         []byte // 原来的消息体
+}
+
+// Decode 解码 Router 发送到死信队列的消息体, 不是死信消息时返回 false.
+func Decode(body []byte) (dl *DeadLetter, ok bool) {
+	header, payload, ok := mns.DecodeEnvelope(body)
+	if !ok {
+		return nil, false
+	}
+	if _, ok = header[HeaderSourceQueue]; !ok {
+		return nil, false
+	}
+	dl = &DeadLetter{
+		SourceQueue: header[HeaderSourceQueue],
+		MessageId:   header[HeaderMessageId],
+		Error:       header[HeaderError],
+		Body:        payload,
+	}
+	dl.EnqueueTime, _ = strconv.ParseInt(header[HeaderEnqueueTime], 10, 64)
+	dl.DequeueCount, _ = strconv.Atoi(header[HeaderDequeueCount])
+	dl.Time, _ = strconv.ParseInt(header[HeaderTime], 10, 64)
+	return dl, true
+}
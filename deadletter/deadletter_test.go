@@ -0,0 +1,194 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/consumer"
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+func TestRouter(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("orders", nil)
+	s.CreateQueue("orders-dlq", nil)
+	source := queue.New(s.URL, "orders", s.Config())
+	dlq := queue.New(s.URL, "orders-dlq", s.Config())
+	router := New(source, "orders", dlq, &Config{MaxDequeueCount: 2})
+
+	var calls int
+	handler := router.Handler(consumer.HandlerFunc(func(ctx context.Context, msg *queue.Message) error {
+		calls++
+		return errors.New("poison")
+	}))
+
+	// 没有达到 MaxDequeueCount 时返回 handler 的错误
+	msg := &queue.Message{MessageId: "1", MessageBody: []byte("first"), EnqueueTime: 1000, DequeueCount: 1}
+	if err := handler.HandleMessage(context.Background(), msg); err == nil || err.Error() != "poison" {
+		t.Errorf("have:%v, want:%s", err, "poison")
+		return
+	}
+	// 达到 MaxDequeueCount 之后转移到死信队列并返回 nil
+	msg.DequeueCount = 2
+	if err := handler.HandleMessage(context.Background(), msg); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	// 超过 MaxDequeueCount 时不调用 handler
+	if err := handler.HandleMessage(context.Background(), &queue.Message{MessageId: "2", MessageBody: []byte("second"), DequeueCount: 3}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if calls != 2 {
+		t.Errorf("have:%d, want:%d", calls, 2)
+		return
+	}
+
+	msgs := s.Messages("orders-dlq")
+	if len(msgs) != 2 {
+		t.Errorf("have:%d, want:%d", len(msgs), 2)
+		return
+	}
+	dl, ok := Decode(msgs[0].MessageBody)
+	if !ok {
+		t.Errorf("invalid dead letter: %s", msgs[0].MessageBody)
+		return
+	}
+	if dl.SourceQueue != "orders" || dl.MessageId != "1" || dl.EnqueueTime != 1000 || dl.DequeueCount != 2 || dl.Error != "poison" || dl.Time == 0 || string(dl.Body) != "first" {
+		t.Errorf("unexpected dead letter: %+v", dl)
+		return
+	}
+	if dl, _ = Decode(msgs[1].MessageBody); dl == nil || dl.Error != ErrMaxDequeueCountExceeded.Error() {
+		t.Errorf("unexpected dead letter: %+v", dl)
+		return
+	}
+
+	// Move 删除原来的消息
+	if _, _, err := source.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("third")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	_, received, err := source.ReceiveMessage(0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = router.Move(context.Background(), received, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := len(s.Messages("orders")); n != 0 {
+		t.Errorf("have:%d, want:%d", n, 0)
+		return
+	}
+	if n := len(s.Messages("orders-dlq")); n != 3 {
+		t.Errorf("have:%d, want:%d", n, 3)
+		return
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("orders", nil)
+	s.CreateQueue("payments", nil)
+	s.CreateQueue("dlq", nil)
+	dlq := queue.New(s.URL, "dlq", s.Config())
+	queues := map[string]queue.API{
+		"orders":   queue.New(s.URL, "orders", s.Config()),
+		"payments": queue.New(s.URL, "payments", s.Config()),
+	}
+	for name, q := range queues {
+		router := New(q, name, dlq, nil)
+		if err := router.Send(context.Background(), &queue.Message{MessageId: name, MessageBody: []byte(name + "-body")}, errors.New("poison")); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+	if _, _, err := dlq.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("not a dead letter")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	target := func(sourceQueue string) queue.API { return queues[sourceQueue] }
+	replayed, err := Replay(context.Background(), dlq, target, &ReplayConfig{
+		Filter: func(dl *DeadLetter) bool { return dl.SourceQueue == "orders" },
+	})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if replayed != 1 {
+		t.Errorf("have:%d, want:%d", replayed, 1)
+		return
+	}
+	msgs := s.Messages("orders")
+	if len(msgs) != 1 || string(msgs[0].MessageBody) != "orders-body" {
+		t.Errorf("unexpected messages: %+v", msgs)
+		return
+	}
+	if n := len(s.Messages("payments")); n != 0 {
+		t.Errorf("have:%d, want:%d", n, 0)
+		return
+	}
+	// 没有重新发送的消息留在死信队列中
+	if n := len(s.Messages("dlq")); n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+}
+
+func TestRouterLimits(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("orders", nil)
+	s.CreateQueue("orders-dlq", nil)
+	dlq := queue.New(s.URL, "orders-dlq", s.Config())
+
+	var moveErrors []error
+	router := New(queue.New(s.URL, "orders", s.Config()), "orders", dlq, &Config{
+		MaxDequeueCount: 1,
+		MaxMessageSize:  2048,
+		OnMoveError:     func(msg *queue.Message, err error) { moveErrors = append(moveErrors, err) },
+	})
+	handler := router.Handler(consumer.HandlerFunc(func(ctx context.Context, msg *queue.Message) error {
+		return errors.New(strings.Repeat("错", 1000))
+	}))
+
+	// 错误信息被截断
+	if err := handler.HandleMessage(context.Background(), &queue.Message{MessageId: "1", MessageBody: []byte("small"), DequeueCount: 1}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	msgs := s.Messages("orders-dlq")
+	if len(msgs) != 1 {
+		t.Errorf("have:%d, want:%d", len(msgs), 1)
+		return
+	}
+	dl, _ := Decode(msgs[0].MessageBody)
+	if dl == nil || len(dl.Error) > maxErrorBytes || !utf8.ValidString(dl.Error) || !strings.HasSuffix(dl.Error, "...") {
+		t.Errorf("unexpected dead letter: %+v", dl)
+		return
+	}
+
+	// 超过 MaxMessageSize 时不发送, 调用 OnMoveError
+	err := handler.HandleMessage(context.Background(), &queue.Message{MessageId: "2", MessageBody: bytes.Repeat([]byte("x"), 2048), DequeueCount: 1})
+	if !errors.Is(err, ErrDeadLetterTooLarge) {
+		t.Errorf("have:%v, want:%v", err, ErrDeadLetterTooLarge)
+		return
+	}
+	if len(moveErrors) != 1 || moveErrors[0] != err {
+		t.Errorf("unexpected move errors: %v", moveErrors)
+		return
+	}
+	if n := len(s.Messages("orders-dlq")); n != 1 {
+		t.Errorf("have:%d, want:%d", n, 1)
+		return
+	}
+}
@@ -0,0 +1,75 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+type ReplayConfig struct {
+	// following is optional
+	MaxMessages int                       // 最多重新发送的消息数, 默认不限制
+	WaitSeconds int                       // 接收死信队列的长轮询等待时间, 1-30, 默认为 1, 死信队列为空时 Replay 返回
+	Filter      func(dl *DeadLetter) bool // 返回 false 的消息不重新发送, 留在死信队列中
+}
+
+// Replay 从死信队列 dlq 中接收消息, 把原来的消息体发送到 target(dl.SourceQueue) 返回的队列, 然后从 dlq 中删除.
+//
+// 不是死信格式的消息, target 返回 nil 或者 Filter 返回 false 的消息留在 dlq 中, 在 VisibilityTimeout 之后可以被重新接收,
+// 再次接收到同一条消息时 Replay 返回, 所以一次 Replay 最多处理一遍死信队列.
+// 发送成功但是从 dlq 删除失败时, 消息会在下一次 Replay 时被重复发送.
+func Replay(ctx context.Context, dlq queue.API, target func(sourceQueue string) queue.API, config *ReplayConfig) (replayed int, err error) {
+	if config == nil {
+		config = &ReplayConfig{}
+	}
+	waitSeconds := config.WaitSeconds
+	if waitSeconds < 1 || waitSeconds > 30 {
+		waitSeconds = 1
+	}
+
+	seen := make(map[string]bool)
+	for {
+		numOfMessages := queue.MaxBatchMessageCount
+		if config.MaxMessages > 0 && config.MaxMessages-replayed < numOfMessages {
+			if numOfMessages = config.MaxMessages - replayed; numOfMessages <= 0 {
+				return
+			}
+		}
+		var msgs []queue.Message
+		if _, msgs, err = dlq.BatchReceiveMessageContext(ctx, numOfMessages, waitSeconds); err != nil {
+			if mns.IsMessageNotExist(err) {
+				err = nil
+			}
+			return
+		}
+		done := false
+		for i := range msgs {
+			msg := &msgs[i]
+			if seen[msg.MessageId] {
+				done = true
+				continue
+			}
+			seen[msg.MessageId] = true
+
+			dl, ok := Decode(msg.MessageBody)
+			if !ok || (config.Filter != nil && !config.Filter(dl)) {
+				continue
+			}
+			q := target(dl.SourceQueue)
+			if q == nil {
+				continue
+			}
+			if _, _, err = q.SendMessageContext(ctx, &queue.SendMessageRequest{MessageBody: dl.Body, Priority: msg.Priority}); err != nil {
+				return
+			}
+			if _, err = dlq.DeleteMessageContext(ctx, msg.ReceiptHandle); err != nil {
+				return
+			}
+			replayed++
+		}
+		if done {
+			return
+		}
+	}
+}
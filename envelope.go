@@ -0,0 +1,49 @@
+package mns
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// EnvelopePrefix 是信封格式的消息体的前缀.
+//
+// MNS 的消息没有属性, 信封格式把 header 和消息一起放在消息体中, 用于传递 traceparent 等信息:
+//  mns-envelope/1\n
+//  {"traceparent":"00-...","tracestate":"...","baggage":"...","custom-key":"..."}\n
+//  payload
+// 第二行是 JSON 编码的 header, 不包含换行符; 之后是原始的消息, 可以是任意内容.
+const EnvelopePrefix = "mns-envelope/1\n"
+
+// EncodeEnvelope 把 header 和 payload 编码为信封格式的消息体.
+func EncodeEnvelope(header map[string]string, payload []byte) []byte {
+	if header == nil {
+		header = map[string]string{}
+	}
+	headerJSON, _ := json.Marshal(header) // map[string]string 不会编码失败
+	buf := make([]byte, 0, len(EnvelopePrefix)+len(headerJSON)+1+len(payload))
+	buf = append(buf, EnvelopePrefix...)
+	buf = append(buf, headerJSON...)
+	buf = append(buf, '\n')
+	return append(buf, payload...)
+}
+
+// DecodeEnvelope 解码 EncodeEnvelope 编码的消息体.
+// body 不是信封格式时 ok 为 false, payload 为 body 本身, 所以不使用信封格式的消息可以原样处理.
+// 返回的 payload 和 body 共享底层的数组.
+func DecodeEnvelope(body []byte) (header map[string]string, payload []byte, ok bool) {
+	if !bytes.HasPrefix(body, []byte(EnvelopePrefix)) {
+		return nil, body, false
+	}
+	rest := body[len(EnvelopePrefix):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return nil, body, false
+	}
+	if err := json.Unmarshal(rest[:i], &header); err != nil {
+		return nil, body, false
+	}
+	if header == nil {
+		header = map[string]string{}
+	}
+	return header, rest[i+1:], true
+}
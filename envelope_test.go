@@ -0,0 +1,28 @@
+package mns
+
+import "testing"
+
+func TestEnvelope(t *testing.T) {
+	body := EncodeEnvelope(map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "key": "a\nb"}, []byte("line1\nline2"))
+	header, payload, ok := DecodeEnvelope(body)
+	if !ok {
+		t.Errorf("have:%t, want:%t", ok, true)
+		return
+	}
+	if string(payload) != "line1\nline2" {
+		t.Errorf("have:%q, want:%q", payload, "line1\nline2")
+		return
+	}
+	if header["traceparent"] != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" || header["key"] != "a\nb" {
+		t.Errorf("unexpected header: %v", header)
+		return
+	}
+
+	for _, body := range []string{"", "plain body", EnvelopePrefix + "not json\npayload", EnvelopePrefix + "{}"} {
+		header, payload, ok := DecodeEnvelope([]byte(body))
+		if ok || header != nil || string(payload) != body {
+			t.Errorf("%q: have:%v/%q/%t, want:nil/%q/false", body, header, payload, ok, body)
+			return
+		}
+	}
+}
@@ -9,6 +9,11 @@ const (
 	ErrorHttpStatusCodeTopicNotExist      = 404
 	ErrorHttpStatusCodeMessageNotExist    = 404
 	ErrorHttpStatusCodeReceiptHandleError = 400
+	ErrorHttpStatusCodeQueueAlreadyExist  = 409
+	ErrorHttpStatusCodeTopicAlreadyExist  = 409
+
+	ErrorHttpStatusCodeSubscriptionNotExist     = 404
+	ErrorHttpStatusCodeSubscriptionAlreadyExist = 409
 )
 
 const (
@@ -16,8 +21,31 @@ const (
 	ErrorCodeTopicNotExist      = "TopicNotExist"
 	ErrorCodeMessageNotExist    = "MessageNotExist"
 	ErrorCodeReceiptHandleError = "ReceiptHandleError"
+	ErrorCodeQueueAlreadyExist  = "QueueAlreadyExist"
+	ErrorCodeTopicAlreadyExist  = "TopicAlreadyExist"
+
+	ErrorCodeSubscriptionNotExist     = "SubscriptionNotExist"
+	ErrorCodeSubscriptionAlreadyExist = "SubscriptionAlreadyExist"
+)
+
+// 下面的错误码表示服务端临时的错误, 重试可能会成功.
+const (
+	ErrorCodeInternalError      = "InternalError"
+	ErrorCodeServiceUnavailable = "ServiceUnavailable"
+	ErrorCodeThrottling         = "Throttling"
+	ErrorCodeQPSLimitExceeded   = "QPSLimitExceeded"
 )
 
+// IsRetryableErrorCode 判断错误码是否表示服务端临时的错误, 包括服务端内部错误和限流.
+func IsRetryableErrorCode(code string) bool {
+	switch code {
+	case ErrorCodeInternalError, ErrorCodeServiceUnavailable, ErrorCodeThrottling, ErrorCodeQPSLimitExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
 func IsQueueNotExist(err error) bool {
 	v, ok := err.(*Error)
 	if !ok {
@@ -62,6 +90,50 @@ func IsReceiptHandleError(err error) bool {
 	return v.HttpStatusCode == ErrorHttpStatusCodeReceiptHandleError && v.Code == ErrorCodeReceiptHandleError
 }
 
+func IsQueueAlreadyExist(err error) bool {
+	v, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	if v == nil {
+		return false
+	}
+	return v.HttpStatusCode == ErrorHttpStatusCodeQueueAlreadyExist && v.Code == ErrorCodeQueueAlreadyExist
+}
+
+func IsTopicAlreadyExist(err error) bool {
+	v, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	if v == nil {
+		return false
+	}
+	return v.HttpStatusCode == ErrorHttpStatusCodeTopicAlreadyExist && v.Code == ErrorCodeTopicAlreadyExist
+}
+
+func IsSubscriptionNotExist(err error) bool {
+	v, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	if v == nil {
+		return false
+	}
+	return v.HttpStatusCode == ErrorHttpStatusCodeSubscriptionNotExist && v.Code == ErrorCodeSubscriptionNotExist
+}
+
+func IsSubscriptionAlreadyExist(err error) bool {
+	v, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	if v == nil {
+		return false
+	}
+	return v.HttpStatusCode == ErrorHttpStatusCodeSubscriptionAlreadyExist && v.Code == ErrorCodeSubscriptionAlreadyExist
+}
+
 var _ error = (*Error)(nil)
 
 // Error 表示 MNS 的错误响应.
@@ -233,3 +233,250 @@ func TestIsTopicNotExist(t *testing.T) {
 		return
 	}
 }
+
+func TestIsQueueAlreadyExist(t *testing.T) {
+	have := IsQueueAlreadyExist(nil)
+	want := false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	var err *Error
+	have = IsQueueAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{}
+	have = IsQueueAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeQueueAlreadyExist,
+		Code:           ErrorCodeQueueNotExist,
+	}
+	have = IsQueueAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeQueueAlreadyExist + 1,
+		Code:           ErrorCodeQueueAlreadyExist,
+	}
+	have = IsQueueAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeQueueAlreadyExist,
+		Code:           ErrorCodeQueueAlreadyExist,
+	}
+	have = IsQueueAlreadyExist(err)
+	want = true
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+}
+
+func TestIsTopicAlreadyExist(t *testing.T) {
+	have := IsTopicAlreadyExist(nil)
+	want := false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	var err *Error
+	have = IsTopicAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{}
+	have = IsTopicAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeTopicAlreadyExist,
+		Code:           ErrorCodeTopicNotExist,
+	}
+	have = IsTopicAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeTopicAlreadyExist + 1,
+		Code:           ErrorCodeTopicAlreadyExist,
+	}
+	have = IsTopicAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeTopicAlreadyExist,
+		Code:           ErrorCodeTopicAlreadyExist,
+	}
+	have = IsTopicAlreadyExist(err)
+	want = true
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+}
+
+func TestIsSubscriptionNotExist(t *testing.T) {
+	have := IsSubscriptionNotExist(nil)
+	want := false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	var err *Error
+	have = IsSubscriptionNotExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{}
+	have = IsSubscriptionNotExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionNotExist,
+		Code:           ErrorCodeTopicNotExist,
+	}
+	have = IsSubscriptionNotExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionNotExist + 1,
+		Code:           ErrorCodeSubscriptionNotExist,
+	}
+	have = IsSubscriptionNotExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionNotExist,
+		Code:           ErrorCodeSubscriptionNotExist,
+	}
+	have = IsSubscriptionNotExist(err)
+	want = true
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+}
+
+func TestIsSubscriptionAlreadyExist(t *testing.T) {
+	have := IsSubscriptionAlreadyExist(nil)
+	want := false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	var err *Error
+	have = IsSubscriptionAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{}
+	have = IsSubscriptionAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionAlreadyExist,
+		Code:           ErrorCodeTopicAlreadyExist,
+	}
+	have = IsSubscriptionAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionAlreadyExist + 1,
+		Code:           ErrorCodeSubscriptionAlreadyExist,
+	}
+	have = IsSubscriptionAlreadyExist(err)
+	want = false
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+
+	err = &Error{
+		HttpStatusCode: ErrorHttpStatusCodeSubscriptionAlreadyExist,
+		Code:           ErrorCodeSubscriptionAlreadyExist,
+	}
+	have = IsSubscriptionAlreadyExist(err)
+	want = true
+	if have != want {
+		t.Errorf("have:%t, want:%t", have, want)
+		return
+	}
+}
+
+func TestIsRetryableErrorCode(t *testing.T) {
+	for _, code := range []string{ErrorCodeInternalError, ErrorCodeServiceUnavailable, ErrorCodeThrottling, ErrorCodeQPSLimitExceeded} {
+		if !IsRetryableErrorCode(code) {
+			t.Errorf("want %s retryable", code)
+			return
+		}
+	}
+	for _, code := range []string{"", ErrorCodeQueueNotExist, ErrorCodeMessageNotExist, "InvalidArgument"} {
+		if IsRetryableErrorCode(code) {
+			t.Errorf("want %s not retryable", code)
+			return
+		}
+	}
+}
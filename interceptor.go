@@ -0,0 +1,61 @@
+package mns
+
+import (
+	"context"
+	"net/http"
+)
+
+// Request 是 Interceptor 看到的一次 HTTP 请求, 每次重试都是一个新的 Request.
+type Request struct {
+	Operation  string // 接口名称, 比如 SendMessage
+	Idempotent bool   // 重复执行是否安全
+	QueueName  string // 队列相关的接口不为空
+	TopicName  string // 主题和订阅相关的接口不为空
+	Attempt    int    // 第几次请求, 从 1 开始
+
+	// HttpRequest 在调用 Invoker 之前是还没有签名的请求, 可以修改 URL 的 query 和 Header, 以 x-mns- 开头的 Header 会参与签名,
+	// 不能修改请求体; Invoker 返回之后是签名之后实际发送的请求, 包含 Authorization.
+	HttpRequest *http.Request
+}
+
+// Response 是 Interceptor 看到的一次 HTTP 响应.
+type Response struct {
+	StatusCode int
+	RequestId  string
+	Header     http.Header
+	Body       []byte // 只在本次请求返回之前有效, 重试时会被覆盖
+	Error      *Error // MNS 返回的错误, 2xx 或者响应体不是 MNS 的标准错误时为 nil; Interceptor 直接返回时可以只设置 Error, 不设置 Body
+}
+
+// Invoker 签名并发送 Request, 网络错误等没有得到响应的情况返回 error, MNS 返回的错误在 Response.Error 中.
+type Invoker func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor 拦截每一次 HTTP 请求, 包括重试.
+//
+// Interceptor 通常在调用 invoker 之前修改请求, 之后记录或者修改响应, 也可以不调用 invoker 直接返回, 比如用于故障注入.
+// 返回的 Response 和 error 作为请求的结果, 决定是否重试以及接口的返回值.
+type Interceptor func(ctx context.Context, req *Request, invoker Invoker) (*Response, error)
+
+// ChainInterceptors 把 interceptors 组合成一个 Interceptor, interceptors[0] 在最外层.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	switch len(interceptors) {
+	case 0:
+		return func(ctx context.Context, req *Request, invoker Invoker) (*Response, error) {
+			return invoker(ctx, req)
+		}
+	case 1:
+		return interceptors[0]
+	}
+	return func(ctx context.Context, req *Request, invoker Invoker) (*Response, error) {
+		return interceptors[0](ctx, req, chainInvoker(interceptors[1:], invoker))
+	}
+}
+
+func chainInvoker(interceptors []Interceptor, invoker Invoker) Invoker {
+	if len(interceptors) == 0 {
+		return invoker
+	}
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		return interceptors[0](ctx, req, chainInvoker(interceptors[1:], invoker))
+	}
+}
@@ -3,8 +3,11 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/xml"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -16,22 +19,140 @@ import (
 	"github.com/chanxuehong/mns.aliyun.v20150606"
 )
 
-func DoHTTP(ctx context.Context, httpMethod string, _url *url.URL, header http.Header, reqBody []byte, respBuffer *bytes.Buffer, config mns.Config) (requestId string, statusCode int, respBody []byte, err error) {
+// Operation 描述一次 MNS 接口调用.
+type Operation struct {
+	Name       string // 接口名称, 比如 SendMessage
+	Idempotent bool   // 重复执行是否安全, 只有幂等的接口在请求超时之后才会重试
+
+	// DoneErrorCode 不为空时, 重试的请求返回这个错误码表示之前的请求已经成功, DoHTTP 返回 204,
+	// 比如 DeleteMessage 第一次请求已经删除了消息但是没有收到响应, 重试时返回 ReceiptHandleError.
+	DoneErrorCode string
+}
+
+func DoHTTP(ctx context.Context, op Operation, httpMethod string, _url *url.URL, header http.Header, reqBody []byte, respBuffer *bytes.Buffer, config mns.Config) (requestId string, statusCode int, respBody []byte, err error) {
 	logger, _ := log.FromContext(ctx)
-	for i := 0; i < 3; i++ {
+	policy := config.RetryPolicy
+	if policy == nil {
+		policy = &mns.RetryPolicy{}
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
 		respBuffer.Reset()
-		requestId, statusCode, respBody, err = doHTTP(ctx, httpMethod, _url, header, reqBody, respBuffer, config)
-		if err == nil {
-			return
+		start := time.Now()
+		requestId, statusCode, respBody, err = doHTTP(ctx, op, attempt, httpMethod, _url, header, reqBody, respBuffer, config)
+		if config.Metrics != nil {
+			observeRequest(config.Metrics, op, attempt, _url, time.Since(start), len(reqBody), requestId, statusCode, respBody, err)
 		}
-		if logger != nil {
-			logger.Error("mns: DoHTTP encountered an error", "error-type", reflect.TypeOf(err).String(), "error", err.Error())
+		if err != nil && logger != nil {
+			logger.Error("mns: DoHTTP encountered an error", "operation", op.Name, "attempt", attempt, "error-type", reflect.TypeOf(err).String(), "error", err.Error())
 		}
-		if !shouldRetryRequest(err) {
+		if attempt > 1 && op.DoneErrorCode != "" && err == nil && statusCode/100 != 2 {
+			if v, ok := UnmarshalErrorResponse(requestId, statusCode, respBody).(*mns.Error); ok && v.Code == op.DoneErrorCode {
+				statusCode, respBody = http.StatusNoContent, nil
+				return
+			}
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil || !shouldRetry(op, policy, err, requestId, statusCode, respBody) {
 			return
 		}
+
+		timer := time.NewTimer(Backoff(policy, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
 	}
-	return
+}
+
+func observeRequest(hook mns.MetricsHook, op Operation, attempt int, _url *url.URL, duration time.Duration, bytesSent int, requestId string, statusCode int, respBody []byte, err error) {
+	m := &mns.RequestMetrics{
+		Operation:     op.Name,
+		Attempt:       attempt,
+		Duration:      duration,
+		StatusCode:    statusCode,
+		Err:           err,
+		BytesSent:     bytesSent,
+		BytesReceived: len(respBody),
+	}
+	m.QueueName, m.TopicName = resourceNames(_url.Path)
+	if err == nil && statusCode/100 != 2 {
+		if v, ok := UnmarshalErrorResponse(requestId, statusCode, respBody).(*mns.Error); ok {
+			m.ErrorCode = v.Code
+		}
+	}
+	hook.ObserveRequest(m)
+}
+
+// NewMessageBodyMD5MismatchErrorWithMetrics 返回 NewMessageBodyMD5MismatchError, 并且通知 config.Metrics.
+func NewMessageBodyMD5MismatchErrorWithMetrics(config mns.Config, operation string, _url *url.URL, messageBody []byte, have, want string) error {
+	if config.Metrics != nil {
+		queueName, topicName := resourceNames(_url.Path)
+		config.Metrics.ObserveMessageBodyMD5Mismatch(operation, queueName, topicName)
+	}
+	return NewMessageBodyMD5MismatchError(messageBody, have, want)
+}
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+)
+
+// Backoff 返回第 attempt 次请求失败之后, 重试之前的等待时间.
+//
+// 等待时间为 InitialBackoff * 2^(attempt-1), 不超过 MaxBackoff, 并在 [d/2, d) 之间随机取值, 避免大量客户端同时重试.
+func Backoff(policy *mns.RetryPolicy, attempt int) time.Duration {
+	d, max := policy.InitialBackoff, policy.MaxBackoff
+	if d <= 0 {
+		d = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// shouldRetry 根据一次请求的结果判断是否需要重试.
+func shouldRetry(op Operation, policy *mns.RetryPolicy, err error, requestId string, statusCode int, respBody []byte) bool {
+	if err != nil {
+		if shouldRetryRequest(err) {
+			return true
+		}
+		if v, ok := err.(net.Error); ok && v.Timeout() {
+			return op.Idempotent
+		}
+		return false
+	}
+	if statusCode/100 == 2 {
+		return false
+	}
+	// BatchSendMessage 部分失败时返回 500 和 <Messages>, 不是 MNS 的标准错误, 不在这里重试;
+	// SLB 或者代理返回的 502, 503, 504 的响应体是 HTML 或者为空, 也不是 MNS 的标准错误, 需要重试.
+	var mnsErr *mns.Error
+	if v, ok := UnmarshalErrorResponse(requestId, statusCode, respBody).(*mns.Error); ok {
+		mnsErr = v
+	} else {
+		switch statusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if policy.ShouldRetry != nil {
+		return policy.ShouldRetry(mnsErr)
+	}
+	return mns.DefaultShouldRetry(mnsErr)
 }
 
 // shouldRetryRequest 根据 err 判断是否需要重试
@@ -50,12 +171,15 @@ func shouldRetryRequest(err error) bool {
 		if uerr.Err == io.EOF {
 			return true
 		}
+		if _, ok := uerr.Err.(*net.OpError); ok {
+			return strings.Contains(uerr.Err.Error(), "connection reset by peer")
+		}
 		return false
 	}
 	return false
 }
 
-func doHTTP(ctx context.Context, httpMethod string, _url *url.URL, header http.Header, reqBody []byte, respBuffer *bytes.Buffer, config mns.Config) (requestId string, statusCode int, respBody []byte, err error) {
+func doHTTP(ctx context.Context, op Operation, attempt int, httpMethod string, _url *url.URL, header http.Header, reqBody []byte, respBuffer *bytes.Buffer, config mns.Config) (requestId string, statusCode int, respBody []byte, err error) {
 	if httpMethod == "" {
 		httpMethod = http.MethodGet
 	}
@@ -66,13 +190,18 @@ func doHTTP(ctx context.Context, httpMethod string, _url *url.URL, header http.H
 		respBuffer = bytes.NewBuffer(make([]byte, 0, 16<<10))
 	}
 
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
 	header.Set("Date", FormatDate(time.Now()))
 	header.Set("X-Mns-Version", Version)
 	header.Set("Content-Type", ContentType)
 	if len(reqBody) > 0 {
 		header.Set("Content-Md5", ContentMD5(reqBody))
 	}
-	header.Set("Authorization", Authorization(config.AccessKeyId, Sign(httpMethod, header, _url.RequestURI(), config.AccessKeySecret)))
 
 	req := &http.Request{
 		Method:        httpMethod,
@@ -87,13 +216,83 @@ func doHTTP(ctx context.Context, httpMethod string, _url *url.URL, header http.H
 			return ioutil.NopCloser(bytes.NewReader(reqBody)), nil
 		}
 	}
+	if ctx != context.Background() {
+		req = req.WithContext(ctx)
+	}
 
-	if config.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
-		defer cancel()
+	if len(config.Interceptors) == 0 {
+		requestId, statusCode, _, respBody, err = send(ctx, req, respBuffer, config)
+		return
 	}
-	if ctx != context.Background() {
+
+	r := &mns.Request{
+		Operation:   op.Name,
+		Idempotent:  op.Idempotent,
+		Attempt:     attempt,
+		HttpRequest: req,
+	}
+	r.QueueName, r.TopicName = resourceNames(_url.Path)
+	invoker := func(ctx context.Context, r *mns.Request) (*mns.Response, error) {
+		var resp mns.Response
+		var err error
+		resp.RequestId, resp.StatusCode, resp.Header, resp.Body, err = send(ctx, r.HttpRequest, respBuffer, config)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			if v, ok := UnmarshalErrorResponse(resp.RequestId, resp.StatusCode, resp.Body).(*mns.Error); ok {
+				resp.Error = v
+			}
+		}
+		return &resp, nil
+	}
+	resp, err := mns.ChainInterceptors(config.Interceptors...)(ctx, r, invoker)
+	if err != nil {
+		return
+	}
+	if resp == nil {
+		err = errors.New("mns: the Interceptor returned a nil Response without an error")
+		return
+	}
+	requestId, statusCode, respBody = resp.RequestId, resp.StatusCode, resp.Body
+	if resp.Error != nil {
+		// Interceptor 可能只设置了 Error 而没有响应体, 比如故障注入, 把 Error 编码为响应体, 由 shouldRetry 和调用方解析
+		if statusCode == 0 {
+			statusCode = resp.Error.HttpStatusCode
+		}
+		if statusCode/100 != 2 {
+			respBuffer.Reset()
+			if err = xml.NewEncoder(respBuffer).Encode(resp.Error); err != nil {
+				return
+			}
+			respBody = respBuffer.Bytes()
+		}
+	}
+	return
+}
+
+// send 签名并发送请求.
+func send(ctx context.Context, req *http.Request, respBuffer *bytes.Buffer, config mns.Config) (requestId string, statusCode int, respHeader http.Header, respBody []byte, err error) {
+	credentials := &mns.Credentials{
+		AccessKeyId:     config.AccessKeyId,
+		AccessKeySecret: config.AccessKeySecret,
+		SecurityToken:   config.SecurityToken,
+	}
+	if config.CredentialsProvider != nil {
+		if credentials, err = config.CredentialsProvider.Credentials(ctx); err != nil {
+			return
+		}
+	}
+
+	header := req.Header
+	if credentials.SecurityToken != "" {
+		header.Set("X-Mns-Security-Token", credentials.SecurityToken) // 作为 CanonicalizedMNSHeaders 的一部分参与签名
+	} else {
+		header.Del("X-Mns-Security-Token")
+	}
+	header.Set("Authorization", Authorization(credentials.AccessKeyId, Sign(req.Method, header, req.URL.RequestURI(), credentials.AccessKeySecret)))
+
+	if ctx != req.Context() && ctx != context.Background() {
 		req = req.WithContext(ctx)
 	}
 	resp, err := config.HttpClient.Do(req)
@@ -102,9 +301,27 @@ func doHTTP(ctx context.Context, httpMethod string, _url *url.URL, header http.H
 	}
 	defer resp.Body.Close()
 
+	respBuffer.Reset()
 	if _, err = respBuffer.ReadFrom(resp.Body); err != nil {
 		return
 	}
 	requestId = resp.Header.Get("X-Mns-Request-Id")
-	return requestId, resp.StatusCode, respBuffer.Bytes(), nil
+	return requestId, resp.StatusCode, resp.Header, respBuffer.Bytes(), nil
+}
+
+// resourceNames 返回 path 中的队列名称或者主题名称.
+//  /queues/{QueueName}/...
+//  /topics/{TopicName}/...
+func resourceNames(path string) (queueName, topicName string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(parts) < 2 {
+		return
+	}
+	switch parts[0] {
+	case "queues":
+		queueName = parts[1]
+	case "topics":
+		topicName = parts[1]
+	}
+	return
 }
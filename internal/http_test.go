@@ -0,0 +1,460 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestDoHTTPRetry5xx(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>ServiceUnavailable</Code><Message>service unavailable</Message></Error>`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages")
+	config := mns.Config{
+		HttpClient:  http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+	_, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "SendMessage"}, http.MethodPost, _url, nil, []byte("body"), &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if statusCode != http.StatusNoContent {
+		t.Errorf("have:%d, want:%d", statusCode, http.StatusNoContent)
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("have:%d, want:%d", n, 3)
+		return
+	}
+}
+
+func TestDoHTTPNoRetryForPartialBatchSend(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<Messages><Message><ErrorCode>InternalError</ErrorCode><ErrorMessage>internal error</ErrorMessage></Message></Messages>`))
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages")
+	config := mns.Config{
+		HttpClient:  http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+	_, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "BatchSendMessage"}, http.MethodPost, _url, nil, []byte("body"), &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); statusCode != http.StatusInternalServerError || n != 1 {
+		t.Errorf("have:%d/%d, want:%d/%d", statusCode, n, http.StatusInternalServerError, 1)
+		return
+	}
+}
+
+func TestDoHTTPRetryGatewayError(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html><body><h1>502 Bad Gateway</h1></body></html>`))
+		case 2:
+			w.WriteHeader(http.StatusGatewayTimeout)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages")
+	config := mns.Config{
+		HttpClient:  http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+	_, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "SendMessage"}, http.MethodPost, _url, nil, []byte("body"), &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); statusCode != http.StatusNoContent || n != 3 {
+		t.Errorf("have:%d/%d, want:%d/%d", statusCode, n, http.StatusNoContent, 3)
+		return
+	}
+}
+
+func TestDoHTTPShouldRetryHook(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<Error><Code>InternalError</Code><Message>internal error</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test")
+	config := mns.Config{
+		HttpClient: http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Millisecond,
+			ShouldRetry:    func(err *mns.Error) bool { return false },
+		},
+	}
+	DoHTTP(context.Background(), Operation{Name: "GetQueueAttributes", Idempotent: true}, http.MethodGet, _url, nil, nil, &bytes.Buffer{}, config)
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("have:%d, want:%d", n, 1)
+		return
+	}
+}
+
+func TestDoHTTPRetryTimeoutIdempotentOnly(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages")
+	config := mns.Config{
+		Timeout:     20 * time.Millisecond,
+		HttpClient:  http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+
+	_, _, _, err := DoHTTP(context.Background(), Operation{Name: "SendMessage"}, http.MethodPost, _url, nil, []byte("body"), &bytes.Buffer{}, config)
+	if n := atomic.LoadInt32(&attempts); err == nil || n != 1 {
+		t.Errorf("want timeout without retry, have:%v, attempts:%d", err, n)
+		return
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	_, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "PeekMessage", Idempotent: true}, http.MethodGet, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); statusCode != http.StatusNoContent || n != 2 {
+		t.Errorf("have:%d/%d, want:%d/%d", statusCode, n, http.StatusNoContent, 2)
+		return
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &mns.RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			if d := Backoff(policy, attempt); d < max/2 || d > max {
+				t.Errorf("attempt %d: have:%v, want:[%v, %v]", attempt, d, max/2, max)
+				return
+			}
+		}
+	}
+}
+
+func TestDoHTTPSecurityToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have := r.Header.Get("X-Mns-Security-Token"); have != "token" {
+			t.Errorf("have:%q, want:%q", have, "token")
+		}
+		signature := Sign(r.Method, r.Header, r.URL.RequestURI(), "secret")
+		if have, want := r.Header.Get("Authorization"), Authorization("id", signature); have != want {
+			t.Errorf("have:%q, want:%q", have, want)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test")
+	config := mns.Config{
+		AccessKeyId:         "ignored",
+		AccessKeySecret:     "ignored",
+		CredentialsProvider: mns.NewStaticCredentialsProvider("id", "secret", "token"),
+		HttpClient:          http.DefaultClient,
+	}
+	_, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "GetQueueAttributes", Idempotent: true}, http.MethodGet, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if statusCode != http.StatusNoContent {
+		t.Errorf("have:%d, want:%d", statusCode, http.StatusNoContent)
+		return
+	}
+
+	// 签名必须包含 x-mns-security-token
+	header := http.Header{}
+	header.Set("Date", "Thu, 01 Jan 1970 00:00:00 GMT")
+	withoutToken := Sign(http.MethodGet, header, "/queues/test", "secret")
+	header.Set("X-Mns-Security-Token", "token")
+	if Sign(http.MethodGet, header, "/queues/test", "secret") == withoutToken {
+		t.Error("the signature must include x-mns-security-token")
+		return
+	}
+}
+
+func TestDoHTTPInterceptors(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 拦截器添加的 x-mns- header 参与签名
+		if have := r.Header.Get("X-Mns-Audit"); have != "yes" {
+			t.Errorf("have:%q, want:%q", have, "yes")
+		}
+		if have, want := r.Header.Get("Authorization"), Authorization("id", Sign(r.Method, r.Header, r.URL.RequestURI(), "secret")); have != want {
+			t.Errorf("have:%q, want:%q", have, want)
+		}
+		w.Header().Set("X-Mns-Request-Id", "request-id")
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>ServiceUnavailable</Code><Message>service unavailable</Message></Error>`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var trace []string
+	record := func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		if req.Operation != "DeleteMessage" || req.QueueName != "test" || req.TopicName != "" {
+			t.Errorf("unexpected request: %+v", req)
+		}
+		if req.HttpRequest.Header.Get("X-Mns-Audit") != "" {
+			t.Error("the outer interceptor should run first")
+		}
+		resp, err := invoker(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if req.HttpRequest.Header.Get("Authorization") == "" {
+			t.Error("the request should be signed after invoker returns")
+		}
+		code := ""
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		trace = append(trace, fmt.Sprintf("%d:%d:%s:%s", req.Attempt, resp.StatusCode, resp.RequestId, code))
+		return resp, nil
+	}
+	audit := func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		req.HttpRequest.Header.Set("X-Mns-Audit", "yes")
+		return invoker(ctx, req)
+	}
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages?ReceiptHandle=handle")
+	config := mns.Config{
+		AccessKeyId:     "id",
+		AccessKeySecret: "secret",
+		HttpClient:      http.DefaultClient,
+		RetryPolicy:     &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+		Interceptors:    []mns.Interceptor{record, audit},
+	}
+	requestId, statusCode, _, err := DoHTTP(context.Background(), Operation{Name: "DeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if requestId != "request-id" || statusCode != http.StatusNoContent {
+		t.Errorf("have:%s/%d, want:%s/%d", requestId, statusCode, "request-id", http.StatusNoContent)
+		return
+	}
+	if want := []string{"1:503:request-id:ServiceUnavailable", "2:204:request-id:"}; len(trace) != 2 || trace[0] != want[0] || trace[1] != want[1] {
+		t.Errorf("have:%v, want:%v", trace, want)
+		return
+	}
+
+	// 拦截器不调用 invoker 直接返回
+	config.Interceptors = []mns.Interceptor{func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		return &mns.Response{StatusCode: http.StatusNotFound, RequestId: "injected", Body: []byte(`<Error><Code>MessageNotExist</Code></Error>`)}, nil
+	}}
+	requestId, statusCode, respBody, err := DoHTTP(context.Background(), Operation{Name: "DeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if requestId != "injected" || statusCode != http.StatusNotFound || !mns.IsMessageNotExist(UnmarshalErrorResponse(requestId, statusCode, respBody)) {
+		t.Errorf("unexpected response: %s/%d/%s", requestId, statusCode, respBody)
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+
+	// 拦截器只设置 Error, 没有响应体, 同样需要重试
+	var injected int32
+	config.Interceptors = []mns.Interceptor{func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		if atomic.AddInt32(&injected, 1) < 3 {
+			return &mns.Response{StatusCode: http.StatusServiceUnavailable, Error: &mns.Error{Code: "ServiceUnavailable"}}, nil
+		}
+		req.HttpRequest.Header.Set("X-Mns-Audit", "yes")
+		return invoker(ctx, req)
+	}}
+	if _, statusCode, _, err = DoHTTP(context.Background(), Operation{Name: "DeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&injected); statusCode != http.StatusNoContent || n != 3 {
+		t.Errorf("have:%d/%d, want:%d/%d", statusCode, n, http.StatusNoContent, 3)
+		return
+	}
+	config.RetryPolicy = &mns.RetryPolicy{MaxAttempts: 1}
+	config.Interceptors = []mns.Interceptor{func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		return &mns.Response{StatusCode: http.StatusForbidden, RequestId: "injected", Error: &mns.Error{Code: "AccessDenied"}}, nil
+	}}
+	requestId, statusCode, respBody, err = DoHTTP(context.Background(), Operation{Name: "DeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if v, ok := UnmarshalErrorResponse(requestId, statusCode, respBody).(*mns.Error); !ok || v.Code != "AccessDenied" || v.HttpStatusCode != http.StatusForbidden || v.RequestId != "injected" {
+		t.Errorf("unexpected response: %s/%d/%s", requestId, statusCode, respBody)
+		return
+	}
+
+	// 拦截器返回 nil, nil
+	config.Interceptors = []mns.Interceptor{func(ctx context.Context, req *mns.Request, invoker mns.Invoker) (*mns.Response, error) {
+		return nil, nil
+	}}
+	if _, _, _, err = DoHTTP(context.Background(), Operation{Name: "DeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config); err == nil {
+		t.Error("want error")
+		return
+	}
+}
+
+// 第一次请求已经成功但是没有收到响应, 重试时返回 DoneErrorCode 作为成功.
+func TestDoHTTPDoneErrorCode(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>ReceiptHandleError</Code><Message>receipt handle error</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	_url, _ := ParseURL(srv.URL + "/queues/test/messages?ReceiptHandle=handle")
+	config := mns.Config{
+		HttpClient:  http.DefaultClient,
+		RetryPolicy: &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+	}
+	op := Operation{Name: "DeleteMessage", Idempotent: true, DoneErrorCode: mns.ErrorCodeReceiptHandleError}
+	_, statusCode, _, err := DoHTTP(context.Background(), op, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := atomic.LoadInt32(&attempts); statusCode != http.StatusNoContent || n != 2 {
+		t.Errorf("have:%d/%d, want:%d/%d", statusCode, n, http.StatusNoContent, 2)
+		return
+	}
+
+	// 第一次请求返回的 DoneErrorCode 是错误
+	atomic.StoreInt32(&attempts, 1)
+	_, statusCode, _, err = DoHTTP(context.Background(), op, http.MethodDelete, _url, nil, nil, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("have:%d, want:%d", statusCode, http.StatusNotFound)
+		return
+	}
+}
+
+type recordMetrics struct {
+	requests   []mns.RequestMetrics
+	mismatches []string
+}
+
+func (r *recordMetrics) ObserveRequest(m *mns.RequestMetrics) {
+	r.requests = append(r.requests, *m)
+}
+
+func (r *recordMetrics) ObserveMessageBodyMD5Mismatch(operation, queueName, topicName string) {
+	r.mismatches = append(r.mismatches, operation+":"+queueName+":"+topicName)
+}
+
+func TestDoHTTPMetrics(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Mns-Request-Id", "request-id")
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>ServiceUnavailable</Code><Message>service unavailable</Message></Error>`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`<Message><MessageId>id</MessageId></Message>`))
+	}))
+	defer srv.Close()
+
+	metrics := &recordMetrics{}
+	_url, _ := ParseURL(srv.URL + "/topics/test/messages")
+	config := mns.Config{
+		AccessKeyId:     "id",
+		AccessKeySecret: "secret",
+		HttpClient:      http.DefaultClient,
+		RetryPolicy:     &mns.RetryPolicy{InitialBackoff: time.Millisecond},
+		Metrics:         metrics,
+	}
+	reqBody := []byte(`<Message><MessageBody>body</MessageBody></Message>`)
+	_, _, _, err := DoHTTP(context.Background(), Operation{Name: "PublishMessage", Idempotent: true}, http.MethodPost, _url, nil, reqBody, &bytes.Buffer{}, config)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(metrics.requests) != 2 {
+		t.Errorf("have:%d, want:%d", len(metrics.requests), 2)
+		return
+	}
+	for i, m := range metrics.requests {
+		if m.Operation != "PublishMessage" || m.QueueName != "" || m.TopicName != "test" || m.Attempt != i+1 || m.BytesSent != len(reqBody) || m.Duration <= 0 {
+			t.Errorf("unexpected metrics: %+v", m)
+			return
+		}
+	}
+	if m := metrics.requests[0]; m.StatusCode != http.StatusServiceUnavailable || m.ErrorCode != "ServiceUnavailable" {
+		t.Errorf("have:%d/%s, want:%d/%s", m.StatusCode, m.ErrorCode, http.StatusServiceUnavailable, "ServiceUnavailable")
+		return
+	}
+	if m := metrics.requests[1]; m.StatusCode != http.StatusCreated || m.ErrorCode != "" || m.BytesReceived == 0 {
+		t.Errorf("unexpected metrics: %+v", m)
+		return
+	}
+
+	err = NewMessageBodyMD5MismatchErrorWithMetrics(config, "PublishMessage", _url, []byte("body"), "have", "want")
+	if err == nil {
+		t.Error("want non-nil error")
+		return
+	}
+	if want := []string{"PublishMessage::test"}; len(metrics.mismatches) != 1 || metrics.mismatches[0] != want[0] {
+		t.Errorf("have:%v, want:%v", metrics.mismatches, want)
+		return
+	}
+}
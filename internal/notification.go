@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+)
+
+// 主题推送的消息的格式, 和 topic.NotifyContentFormat 的值相同.
+const (
+	NotifyContentFormatXML        = "XML"
+	NotifyContentFormatJSON       = "JSON"
+	NotifyContentFormatSimplified = "SIMPLIFIED"
+)
+
+// Notification 是主题推送给 HTTP Endpoint 或者队列的消息, topic.Notification 和 queue.Notification 都从它转换.
+type Notification struct {
+	XMLName struct{} `xml:"Notification" json:"-"`
+
+	Format string `xml:"-" json:"-"`
+
+	TopicOwner       string `xml:"TopicOwner" json:"TopicOwner"`
+	TopicName        string `xml:"TopicName" json:"TopicName"`
+	Subscriber       string `xml:"Subscriber" json:"Subscriber"`
+	SubscriptionName string `xml:"SubscriptionName" json:"SubscriptionName"`
+	MessageId        string `xml:"MessageId" json:"MessageId"`
+	MessageMD5       string `xml:"MessageMD5" json:"MessageMD5"`
+	MessageTag       string `xml:"MessageTag" json:"MessageTag"`
+	PublishTime      int64  `xml:"PublishTime" json:"PublishTime"`
+	Message          []byte `xml:"Message" json:"-"`
+}
+
+// DecodeNotification 识别 body 的格式并解码, 见 topic.DecodeNotification.
+// XML 和 JSON 格式的消息会校验 MessageMD5, base64Enabled 为 true 时 Message 在校验之后被 base64 解码, MessageMD5 更新为解码之后的 MD5.
+func DecodeNotification(body []byte, base64Enabled bool) (n *Notification, err error) {
+	n, ok := decodeNotificationXML(body)
+	if !ok {
+		n, ok = decodeNotificationJSON(body)
+	}
+	if !ok {
+		n = &Notification{
+			Format:  NotifyContentFormatSimplified,
+			Message: body,
+		}
+	} else if want := MessageBodyMD5(n.Message); strings.ToUpper(n.MessageMD5) != want {
+		return nil, NewMessageBodyMD5MismatchError(n.Message, n.MessageMD5, want)
+	}
+
+	if base64Enabled && len(n.Message) > 0 {
+		if n.Message, err = Base64Decode(n.Message); err != nil {
+			return nil, err
+		}
+	}
+	if n.Format != NotifyContentFormatSimplified {
+		n.MessageMD5 = MessageBodyMD5(n.Message)
+	}
+	return n, nil
+}
+
+func decodeNotificationXML(body []byte) (n *Notification, ok bool) {
+	trimmed := bytes.TrimSpace(body)
+	if !bytes.HasPrefix(trimmed, []byte("<?xml")) && !bytes.HasPrefix(trimmed, []byte("<Notification")) {
+		return nil, false
+	}
+	var result Notification
+	if err := xml.Unmarshal(body, &result); err != nil || result.MessageId == "" {
+		return nil, false // 不是 Notification, 按照 SIMPLIFIED 处理
+	}
+	result.Format = NotifyContentFormatXML
+	return &result, true
+}
+
+func decodeNotificationJSON(body []byte) (n *Notification, ok bool) {
+	trimmed := bytes.TrimSpace(body)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return nil, false
+	}
+	var result struct {
+		Notification
+		Message *string `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.MessageId == "" || result.Message == nil {
+		return nil, false
+	}
+	n = &result.Notification
+	n.Format = NotifyContentFormatJSON
+	n.Message = []byte(*result.Message)
+	return n, true
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -21,7 +22,21 @@ func Sign(httpMethod string, header http.Header, canonicalizedResource string, a
 
 	h := hmac.New(sha1.New, []byte(accessKeySecret))
 	bufw := bufio.NewWriterSize(h, 256)
+	writeStringToSign(bufw, httpMethod, header, canonicalizedResource)
+	bufw.Flush()
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
 
+// StringToSign 返回 Sign 中参与签名的原文, MNS 推送消息到 HTTP Endpoint 时对相同格式的原文做 RSA 签名.
+func StringToSign(httpMethod string, header http.Header, canonicalizedResource string) []byte {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriterSize(&buf, 256)
+	writeStringToSign(bufw, httpMethod, header, canonicalizedResource)
+	bufw.Flush()
+	return buf.Bytes()
+}
+
+func writeStringToSign(bufw *bufio.Writer, httpMethod string, header http.Header, canonicalizedResource string) {
 	bufw.WriteString(httpMethod)
 	bufw.WriteByte('\n')
 
@@ -58,9 +73,6 @@ func Sign(httpMethod string, header http.Header, canonicalizedResource string, a
 
 	// 写入 CanonicalizedResource
 	bufw.WriteString(canonicalizedResource)
-
-	bufw.Flush()
-	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
 var _ sort.Interface = (CanonicalizedMNSHeaders)(nil)
@@ -5,6 +5,8 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
+	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -32,3 +34,19 @@ func MessageBodyMD5(b []byte) string {
 	hex.Encode(hexSum[:], sum[:])
 	return string(bytes.ToUpper(hexSum[:]))
 }
+
+// ListHeader 返回 ListQueue, ListTopic 等列表类接口的分页请求头, retNumber 不在 1-1000 之间时为 1000.
+func ListHeader(prefix, marker string, retNumber int) http.Header {
+	if retNumber < 1 || retNumber > 1000 {
+		retNumber = 1000
+	}
+	header := make(http.Header, 8)
+	header.Set("X-Mns-Ret-Number", strconv.Itoa(retNumber))
+	if prefix != "" {
+		header.Set("X-Mns-Prefix", prefix)
+	}
+	if marker != "" {
+		header.Set("X-Mns-Marker", marker)
+	}
+	return header
+}
@@ -40,3 +40,19 @@ func TestMessageBodyMD5(t *testing.T) {
 		return
 	}
 }
+
+func TestListHeader(t *testing.T) {
+	header := ListHeader("prefix-", "marker", 0)
+	if have, want := header.Get("X-Mns-Ret-Number"), "1000"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if header.Get("X-Mns-Prefix") != "prefix-" || header.Get("X-Mns-Marker") != "marker" {
+		t.Errorf("unexpected header: %v", header)
+		return
+	}
+	if header = ListHeader("", "", 10); len(header) != 1 || header.Get("X-Mns-Ret-Number") != "10" {
+		t.Errorf("unexpected header: %v", header)
+		return
+	}
+}
@@ -0,0 +1,26 @@
+package mns
+
+import "time"
+
+// MetricsHook 接收客户端请求的指标, 比如 prommns.Collector, 所有的方法都可能被并发调用, 不能阻塞.
+type MetricsHook interface {
+	// ObserveRequest 在每一次 HTTP 请求结束之后调用, 包括重试的请求.
+	ObserveRequest(m *RequestMetrics)
+
+	// ObserveMessageBodyMD5Mismatch 在 MNS 返回的 MessageBodyMD5 和消息体不一致时调用.
+	ObserveMessageBodyMD5Mismatch(operation, queueName, topicName string)
+}
+
+// RequestMetrics 是一次 HTTP 请求的指标.
+type RequestMetrics struct {
+	Operation     string        // 接口名称, 比如 SendMessage
+	QueueName     string        // 队列相关的接口不为空
+	TopicName     string        // 主题和订阅相关的接口不为空
+	Attempt       int           // 第几次请求, 从 1 开始, 大于 1 表示重试
+	Duration      time.Duration // 包括签名和 Interceptor 的时间
+	StatusCode    int           // 没有得到响应时为 0
+	ErrorCode     string        // MNS 返回的错误码, 2xx 或者没有得到响应时为空
+	Err           error         // 网络错误等没有得到响应的错误
+	BytesSent     int           // 请求体的字节数
+	BytesReceived int           // 响应体的字节数
+}
@@ -0,0 +1,755 @@
+package mnstest
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// QueueAttributes 是队列的属性, 零值的字段使用 MNS 的默认值.
+type QueueAttributes struct {
+	DelaySeconds           int // 默认为 0
+	MaximumMessageSize     int // 默认为 65536
+	MessageRetentionPeriod int // 默认为 345600
+	VisibilityTimeout      int // 默认为 30
+	PollingWaitSeconds     int // 默认为 0
+}
+
+type queueState struct {
+	name           string
+	attrs          QueueAttributes
+	loggingEnabled bool
+	createTime     time.Time
+	lastModifyTime time.Time
+
+	messages []*message // 按照发送的顺序排列
+}
+
+type message struct {
+	id               string
+	body             []byte
+	md5              string
+	priority         int
+	enqueueTime      time.Time
+	nextVisibleTime  time.Time
+	firstDequeueTime time.Time
+	dequeueCount     int
+	receiptHandle    string // 最近一次接收或者修改不可见时间返回的 ReceiptHandle, 之前的都失效
+}
+
+// Message 是队列中的一条消息的快照, 由 Server.Messages 返回.
+type Message struct {
+	MessageId        string
+	MessageBody      []byte
+	Priority         int
+	EnqueueTime      time.Time
+	NextVisibleTime  time.Time
+	FirstDequeueTime time.Time // 零值表示还没有被接收过
+	DequeueCount     int
+	ReceiptHandle    string // 最新的 ReceiptHandle, 为空表示还没有被接收过
+}
+
+// CreateQueue 直接创建队列, 不需要通过 HTTP 请求, attrs 可以为 nil. 队列已经存在时什么都不做.
+func (s *Server) CreateQueue(name string, attrs *QueueAttributes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queues[name] != nil {
+		return
+	}
+	var a QueueAttributes
+	if attrs != nil {
+		a = *attrs
+	}
+	now := s.nowLocked()
+	s.queues[name] = &queueState{
+		name:           name,
+		attrs:          withQueueDefaults(a),
+		createTime:     now,
+		lastModifyTime: now,
+	}
+}
+
+func withQueueDefaults(attrs QueueAttributes) QueueAttributes {
+	if attrs.MaximumMessageSize <= 0 {
+		attrs.MaximumMessageSize = 65536
+	}
+	if attrs.MessageRetentionPeriod <= 0 {
+		attrs.MessageRetentionPeriod = 345600
+	}
+	if attrs.VisibilityTimeout <= 0 {
+		attrs.VisibilityTimeout = 30
+	}
+	return attrs
+}
+
+// Messages 返回队列中所有消息的快照, 包括延时的和不可见的消息, 按照发送的顺序排列; 队列不存在时返回 nil.
+func (s *Server) Messages(queue string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[queue]
+	if q == nil {
+		return nil
+	}
+	q.expireLocked(s.nowLocked())
+	msgs := make([]Message, len(q.messages))
+	for i, m := range q.messages {
+		msgs[i] = m.snapshot()
+	}
+	return msgs
+}
+
+func (m *message) snapshot() Message {
+	return Message{
+		MessageId:        m.id,
+		MessageBody:      append([]byte(nil), m.body...),
+		Priority:         m.priority,
+		EnqueueTime:      m.enqueueTime,
+		NextVisibleTime:  m.nextVisibleTime,
+		FirstDequeueTime: m.firstDequeueTime,
+		DequeueCount:     m.dequeueCount,
+		ReceiptHandle:    m.receiptHandle,
+	}
+}
+
+// expireLocked 删除超过 MessageRetentionPeriod 的消息.
+func (q *queueState) expireLocked(now time.Time) {
+	retention := time.Duration(q.attrs.MessageRetentionPeriod) * time.Second
+	messages := q.messages[:0]
+	for _, m := range q.messages {
+		if now.Sub(m.enqueueTime) < retention {
+			messages = append(messages, m)
+		}
+	}
+	for i := len(messages); i < len(q.messages); i++ {
+		q.messages[i] = nil
+	}
+	q.messages = messages
+}
+
+// enqueueLocked 把消息加入到队列, delaySeconds 小于 0 时使用队列的 DelaySeconds, priority 为 0 时使用默认的 8.
+func (s *Server) enqueueLocked(q *queueState, body []byte, delaySeconds, priority int) *message {
+	if delaySeconds < 0 {
+		delaySeconds = q.attrs.DelaySeconds
+	}
+	if priority == 0 {
+		priority = 8
+	}
+	now := s.nowLocked()
+	m := &message{
+		id:              s.newMessageIdLocked(),
+		body:            append([]byte(nil), body...),
+		md5:             internal.MessageBodyMD5(body),
+		priority:        priority,
+		enqueueTime:     now,
+		nextVisibleTime: now.Add(time.Duration(delaySeconds) * time.Second),
+	}
+	q.messages = append(q.messages, m)
+	s.notifyLocked()
+	return m
+}
+
+func (s *Server) queueLocked(req *request) *queueState {
+	q := s.queues[req.queue]
+	if q == nil {
+		req.writeError(mns.ErrorHttpStatusCodeQueueNotExist, mns.ErrorCodeQueueNotExist, "The queue name you provided is not exist.")
+		return nil
+	}
+	q.expireLocked(s.nowLocked())
+	return q
+}
+
+type queueAttributesRequest struct {
+	XMLName struct{} `xml:"Queue"`
+
+	DelaySeconds           *int  `xml:"DelaySeconds"`
+	MaximumMessageSize     *int  `xml:"MaximumMessageSize"`
+	MessageRetentionPeriod *int  `xml:"MessageRetentionPeriod"`
+	VisibilityTimeout      *int  `xml:"VisibilityTimeout"`
+	PollingWaitSeconds     *int  `xml:"PollingWaitSeconds"`
+	LoggingEnabled         *bool `xml:"LoggingEnabled"`
+}
+
+func (v *queueAttributesRequest) apply(attrs *QueueAttributes, loggingEnabled *bool) {
+	if v.DelaySeconds != nil {
+		attrs.DelaySeconds = *v.DelaySeconds
+	}
+	if v.MaximumMessageSize != nil {
+		attrs.MaximumMessageSize = *v.MaximumMessageSize
+	}
+	if v.MessageRetentionPeriod != nil {
+		attrs.MessageRetentionPeriod = *v.MessageRetentionPeriod
+	}
+	if v.VisibilityTimeout != nil {
+		attrs.VisibilityTimeout = *v.VisibilityTimeout
+	}
+	if v.PollingWaitSeconds != nil {
+		attrs.PollingWaitSeconds = *v.PollingWaitSeconds
+	}
+	if v.LoggingEnabled != nil {
+		*loggingEnabled = *v.LoggingEnabled
+	}
+}
+
+func (s *Server) putQueue(req *request) {
+	var body queueAttributesRequest
+	if len(req.body) > 0 {
+		if err := xml.Unmarshal(req.body, &body); err != nil {
+			req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.nowLocked()
+	q := s.queues[req.queue]
+	if req.op == "SetQueueAttributes" {
+		if q = s.queueLocked(req); q == nil {
+			return
+		}
+		body.apply(&q.attrs, &q.loggingEnabled)
+		q.attrs = withQueueDefaults(q.attrs)
+		q.lastModifyTime = now
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+
+	var attrs QueueAttributes
+	var loggingEnabled bool
+	body.apply(&attrs, &loggingEnabled)
+	attrs = withQueueDefaults(attrs)
+	if q != nil {
+		if q.attrs != attrs || q.loggingEnabled != loggingEnabled {
+			req.writeError(mns.ErrorHttpStatusCodeQueueAlreadyExist, mns.ErrorCodeQueueAlreadyExist, "The queue you want to create already exist.")
+			return
+		}
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+	s.queues[req.queue] = &queueState{
+		name:           req.queue,
+		attrs:          attrs,
+		loggingEnabled: loggingEnabled,
+		createTime:     now,
+		lastModifyTime: now,
+	}
+	req.w.Header().Set("Location", "http://"+req.r.Host+"/queues/"+req.queue)
+	req.writeStatus(http.StatusCreated)
+}
+
+type queueAttributesResponse struct {
+	XMLName struct{} `xml:"Queue"`
+
+	QueueName              string `xml:"QueueName"`
+	CreateTime             int64  `xml:"CreateTime"`
+	LastModifyTime         int64  `xml:"LastModifyTime"`
+	DelaySeconds           int    `xml:"DelaySeconds"`
+	MaximumMessageSize     int    `xml:"MaximumMessageSize"`
+	MessageRetentionPeriod int    `xml:"MessageRetentionPeriod"`
+	VisibilityTimeout      int    `xml:"VisibilityTimeout"`
+	PollingWaitSeconds     int    `xml:"PollingWaitSeconds"`
+	ActiveMessages         int64  `xml:"ActiveMessages"`
+	InactiveMessages       int64  `xml:"InactiveMessages"`
+	DelayMessages          int64  `xml:"DelayMessages"`
+	LoggingEnabled         bool   `xml:"LoggingEnabled"`
+}
+
+func (s *Server) getQueueAttributes(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	resp := &queueAttributesResponse{
+		QueueName:              q.name,
+		CreateTime:             q.createTime.Unix(),
+		LastModifyTime:         q.lastModifyTime.Unix(),
+		DelaySeconds:           q.attrs.DelaySeconds,
+		MaximumMessageSize:     q.attrs.MaximumMessageSize,
+		MessageRetentionPeriod: q.attrs.MessageRetentionPeriod,
+		VisibilityTimeout:      q.attrs.VisibilityTimeout,
+		PollingWaitSeconds:     q.attrs.PollingWaitSeconds,
+		LoggingEnabled:         q.loggingEnabled,
+	}
+	now := s.nowLocked()
+	for _, m := range q.messages {
+		switch {
+		case !m.nextVisibleTime.After(now):
+			resp.ActiveMessages++
+		case m.dequeueCount == 0:
+			resp.DelayMessages++
+		default:
+			resp.InactiveMessages++
+		}
+	}
+	req.writeXML(http.StatusOK, resp)
+}
+
+func (s *Server) deleteQueue(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queues, req.queue)
+	s.notifyLocked()
+	req.writeStatus(http.StatusNoContent)
+}
+
+type listQueueResponse struct {
+	XMLName struct{} `xml:"Queues"`
+
+	Queues []struct {
+		QueueURL string `xml:"QueueURL"`
+	} `xml:"Queue"`
+	NextMarker string `xml:"NextMarker,omitempty"`
+}
+
+func (s *Server) listQueue(req *request) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	page, nextMarker := list(req, names)
+	resp := &listQueueResponse{NextMarker: nextMarker}
+	resp.Queues = make([]struct {
+		QueueURL string `xml:"QueueURL"`
+	}, len(page))
+	for i, name := range page {
+		resp.Queues[i].QueueURL = "http://" + req.r.Host + "/queues/" + name
+	}
+	req.writeXML(http.StatusOK, resp)
+}
+
+type sendMessageRequest struct {
+	MessageBody  []byte `xml:"MessageBody"`
+	DelaySeconds *int   `xml:"DelaySeconds"`
+	Priority     int    `xml:"Priority"` // 1-16, 0 表示使用默认的 8
+}
+
+// validate 检查消息, 返回错误信息.
+func (m *sendMessageRequest) validate(q *queueState) string {
+	switch {
+	case len(m.MessageBody) == 0:
+		return "the MessageBody must not be empty"
+	case len(m.MessageBody) > q.attrs.MaximumMessageSize:
+		return "the MessageBody is larger than MaximumMessageSize " + strconv.Itoa(q.attrs.MaximumMessageSize)
+	case m.DelaySeconds != nil && (*m.DelaySeconds < 0 || *m.DelaySeconds > 604800):
+		return "the DelaySeconds must be between 0 and 604800"
+	case m.Priority < 0 || m.Priority > 16:
+		return "the Priority must be between 1 and 16, or 0 for the default 8"
+	}
+	return ""
+}
+
+func (m *sendMessageRequest) delaySeconds() int {
+	if m.DelaySeconds == nil {
+		return -1
+	}
+	return *m.DelaySeconds
+}
+
+type sendMessageResponse struct {
+	XMLName struct{} `xml:"Message"`
+
+	ErrorCode    string `xml:"ErrorCode,omitempty"`
+	ErrorMessage string `xml:"ErrorMessage,omitempty"`
+
+	MessageId      string `xml:"MessageId,omitempty"`
+	MessageBodyMD5 string `xml:"MessageBodyMD5,omitempty"`
+}
+
+func (s *Server) sendMessage(req *request) {
+	var body struct {
+		XMLName struct{} `xml:"Message"`
+		sendMessageRequest
+	}
+	if err := xml.Unmarshal(req.body, &body); err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	if message := body.validate(q); message != "" {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", message)
+		return
+	}
+	m := s.enqueueLocked(q, body.MessageBody, body.delaySeconds(), body.Priority)
+	req.writeXML(http.StatusCreated, &sendMessageResponse{
+		MessageId:      m.id,
+		MessageBodyMD5: req.md5(m.md5),
+	})
+}
+
+// md5 返回响应中的 MessageBodyMD5, 注入了 CorruptMD5 时返回错误的值.
+func (req *request) md5(sum string) string {
+	if req.corruptMD5() {
+		return internal.MessageBodyMD5([]byte(sum))
+	}
+	return sum
+}
+
+func (s *Server) batchSendMessage(req *request) {
+	var body struct {
+		XMLName struct{} `xml:"Messages"`
+
+		Messages []sendMessageRequest `xml:"Message"`
+	}
+	if err := xml.Unmarshal(req.body, &body); err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if len(body.Messages) < 1 || len(body.Messages) > 16 {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the count of messages must be between 1 and 16")
+		return
+	}
+
+	failed := make(map[int]bool)
+	if req.fault != nil {
+		for _, i := range req.fault.FailIndexes {
+			failed[i] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	resp := struct {
+		XMLName struct{} `xml:"Messages"`
+
+		Messages []sendMessageResponse `xml:"Message"`
+	}{
+		Messages: make([]sendMessageResponse, len(body.Messages)),
+	}
+	statusCode := http.StatusCreated
+	for i := range body.Messages {
+		item := &resp.Messages[i]
+		if failed[i] {
+			item.ErrorCode, item.ErrorMessage = req.fault.Code, req.fault.Message
+			statusCode = http.StatusInternalServerError
+			continue
+		}
+		if message := body.Messages[i].validate(q); message != "" {
+			item.ErrorCode, item.ErrorMessage = "InvalidArgument", message
+			statusCode = http.StatusInternalServerError
+			continue
+		}
+		m := s.enqueueLocked(q, body.Messages[i].MessageBody, body.Messages[i].delaySeconds(), body.Messages[i].Priority)
+		item.MessageId, item.MessageBodyMD5 = m.id, req.md5(m.md5)
+	}
+	req.writeXML(statusCode, &resp)
+}
+
+type receiveMessageResponse struct {
+	XMLName struct{} `xml:"Message"`
+
+	MessageId        string `xml:"MessageId"`
+	ReceiptHandle    string `xml:"ReceiptHandle,omitempty"`
+	MessageBody      []byte `xml:"MessageBody"`
+	MessageBodyMD5   string `xml:"MessageBodyMD5"`
+	EnqueueTime      int64  `xml:"EnqueueTime"`
+	NextVisibleTime  int64  `xml:"NextVisibleTime,omitempty"`
+	FirstDequeueTime int64  `xml:"FirstDequeueTime"`
+	DequeueCount     int    `xml:"DequeueCount"`
+	Priority         int    `xml:"Priority"`
+}
+
+func (req *request) messageResponse(m *message, peek bool) receiveMessageResponse {
+	resp := receiveMessageResponse{
+		MessageId:      m.id,
+		MessageBody:    m.body,
+		MessageBodyMD5: req.md5(m.md5),
+		EnqueueTime:    unixMillisecond(m.enqueueTime),
+		DequeueCount:   m.dequeueCount,
+		Priority:       m.priority,
+	}
+	if !m.firstDequeueTime.IsZero() {
+		resp.FirstDequeueTime = unixMillisecond(m.firstDequeueTime)
+	}
+	if !peek {
+		resp.ReceiptHandle = m.receiptHandle
+		resp.NextVisibleTime = unixMillisecond(m.nextVisibleTime)
+	}
+	return resp
+}
+
+// visibleLocked 返回最多 n 条可见的消息, 按照优先级和发送的顺序排列, 以及下一条消息可见的时间.
+func (q *queueState) visibleLocked(now time.Time, n int) (msgs []*message, wakeup time.Time) {
+	for _, m := range q.messages {
+		if m.nextVisibleTime.After(now) {
+			if wakeup.IsZero() || m.nextVisibleTime.Before(wakeup) {
+				wakeup = m.nextVisibleTime
+			}
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].priority < msgs[j].priority })
+	if len(msgs) > n {
+		msgs = msgs[:n]
+	}
+	return
+}
+
+// numOfMessages 返回 Batch 接口的 numOfMessages 参数, 非 Batch 接口返回 1.
+func numOfMessages(req *request) (int, bool) {
+	if req.op != "BatchReceiveMessage" && req.op != "BatchPeekMessage" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(req.r.URL.Query().Get("numOfMessages"))
+	if err != nil || n < 1 || n > 16 {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the numOfMessages must be between 1 and 16")
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *Server) receiveMessage(req *request) {
+	n, ok := numOfMessages(req)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	waitSeconds := q.attrs.PollingWaitSeconds
+	if v := req.r.URL.Query().Get("waitseconds"); v != "" {
+		var err error
+		if waitSeconds, err = strconv.Atoi(v); err != nil || waitSeconds < 0 || waitSeconds > 30 {
+			req.writeError(http.StatusBadRequest, "InvalidArgument", "the waitseconds must be between 0 and 30")
+			return
+		}
+	}
+	wait := time.Duration(waitSeconds) * time.Second
+	deadline, realDeadline := s.nowLocked().Add(wait), time.Now().Add(wait)
+
+	for {
+		now := s.nowLocked()
+		msgs, wakeup := q.visibleLocked(now, n)
+		if len(msgs) > 0 {
+			resp := struct {
+				XMLName struct{} `xml:"Messages"`
+
+				Messages []receiveMessageResponse `xml:"Message"`
+			}{
+				Messages: make([]receiveMessageResponse, len(msgs)),
+			}
+			for i, m := range msgs {
+				if m.firstDequeueTime.IsZero() {
+					m.firstDequeueTime = now
+				}
+				m.dequeueCount++
+				m.nextVisibleTime = now.Add(time.Duration(q.attrs.VisibilityTimeout) * time.Second)
+				s.renewReceiptHandleLocked(m)
+				resp.Messages[i] = req.messageResponse(m, false)
+			}
+			if req.op == "ReceiveMessage" {
+				req.writeXML(http.StatusOK, &resp.Messages[0])
+				return
+			}
+			req.writeXML(http.StatusOK, &resp)
+			return
+		}
+		if !now.Before(deadline) || !time.Now().Before(realDeadline) {
+			break
+		}
+		if !s.waitLocked(req.r.Context(), realDeadline, wakeup) {
+			return
+		}
+		if q = s.queues[req.queue]; q == nil {
+			s.queueLocked(req)
+			return
+		}
+		q.expireLocked(s.nowLocked())
+	}
+	req.writeError(mns.ErrorHttpStatusCodeMessageNotExist, mns.ErrorCodeMessageNotExist, "Message not exist.")
+}
+
+func (s *Server) renewReceiptHandleLocked(m *message) {
+	s.seq++
+	m.receiptHandle = m.id + "." + strconv.FormatInt(s.seq, 16)
+}
+
+func (s *Server) peekMessage(req *request) {
+	n, ok := numOfMessages(req)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	msgs, _ := q.visibleLocked(s.nowLocked(), n)
+	if len(msgs) == 0 {
+		req.writeError(mns.ErrorHttpStatusCodeMessageNotExist, mns.ErrorCodeMessageNotExist, "Message not exist.")
+		return
+	}
+	resp := struct {
+		XMLName struct{} `xml:"Messages"`
+
+		Messages []receiveMessageResponse `xml:"Message"`
+	}{
+		Messages: make([]receiveMessageResponse, len(msgs)),
+	}
+	for i, m := range msgs {
+		resp.Messages[i] = req.messageResponse(m, true)
+	}
+	if req.op == "PeekMessage" {
+		req.writeXML(http.StatusOK, &resp.Messages[0])
+		return
+	}
+	req.writeXML(http.StatusOK, &resp)
+}
+
+// findLocked 根据 receiptHandle 查找消息, 返回消息在队列中的下标, 失败时返回错误码和错误信息.
+//
+// receiptHandle 只有是消息最新的 ReceiptHandle 并且消息还没有重新可见时才有效.
+func (s *Server) findLocked(q *queueState, receiptHandle string) (index int, statusCode int, code, message string) {
+	i := strings.LastIndexByte(receiptHandle, '.')
+	if i < 0 {
+		return -1, mns.ErrorHttpStatusCodeReceiptHandleError, mns.ErrorCodeReceiptHandleError, "The receipt handle you provide is not valid."
+	}
+	id := receiptHandle[:i]
+	for index, m := range q.messages {
+		if m.id != id {
+			continue
+		}
+		if m.receiptHandle != receiptHandle || !m.nextVisibleTime.After(s.nowLocked()) {
+			return -1, mns.ErrorHttpStatusCodeReceiptHandleError, mns.ErrorCodeReceiptHandleError, "The receipt handle you provide is not valid."
+		}
+		return index, 0, "", ""
+	}
+	return -1, mns.ErrorHttpStatusCodeMessageNotExist, mns.ErrorCodeMessageNotExist, "Message not exist."
+}
+
+func (q *queueState) removeLocked(index int) {
+	copy(q.messages[index:], q.messages[index+1:])
+	q.messages[len(q.messages)-1] = nil
+	q.messages = q.messages[:len(q.messages)-1]
+}
+
+func (s *Server) deleteMessage(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	index, statusCode, code, message := s.findLocked(q, req.r.URL.Query().Get("ReceiptHandle"))
+	if index < 0 {
+		req.writeError(statusCode, code, message)
+		return
+	}
+	q.removeLocked(index)
+	req.writeStatus(http.StatusNoContent)
+}
+
+type batchDeleteMessageErrorItem struct {
+	XMLName struct{} `xml:"Error"`
+
+	ErrorCode     string `xml:"ErrorCode"`
+	ErrorMessage  string `xml:"ErrorMessage"`
+	ReceiptHandle string `xml:"ReceiptHandle"`
+}
+
+func (s *Server) batchDeleteMessage(req *request) {
+	var body struct {
+		XMLName struct{} `xml:"ReceiptHandles"`
+
+		ReceiptHandles []string `xml:"ReceiptHandle"`
+	}
+	if err := xml.Unmarshal(req.body, &body); err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if len(body.ReceiptHandles) < 1 || len(body.ReceiptHandles) > 16 {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the count of receipt handles must be between 1 and 16")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	var resp struct {
+		XMLName struct{} `xml:"Errors"`
+
+		Errors []batchDeleteMessageErrorItem `xml:"Error"`
+	}
+	for _, receiptHandle := range body.ReceiptHandles {
+		index, _, code, message := s.findLocked(q, receiptHandle)
+		if index < 0 {
+			resp.Errors = append(resp.Errors, batchDeleteMessageErrorItem{
+				ErrorCode:     code,
+				ErrorMessage:  message,
+				ReceiptHandle: receiptHandle,
+			})
+			continue
+		}
+		q.removeLocked(index)
+	}
+	if len(resp.Errors) > 0 {
+		req.writeXML(http.StatusNotFound, &resp)
+		return
+	}
+	req.writeStatus(http.StatusNoContent)
+}
+
+func (s *Server) changeMessageVisibility(req *request) {
+	query := req.r.URL.Query()
+	visibilityTimeout, err := strconv.Atoi(query.Get("visibilityTimeout"))
+	if err != nil || visibilityTimeout < 1 || visibilityTimeout > 43200 {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the visibilityTimeout must be between 1 and 43200")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queueLocked(req)
+	if q == nil {
+		return
+	}
+	index, statusCode, code, message := s.findLocked(q, query.Get("receiptHandle"))
+	if index < 0 {
+		req.writeError(statusCode, code, message)
+		return
+	}
+	m := q.messages[index]
+	m.nextVisibleTime = s.nowLocked().Add(time.Duration(visibilityTimeout) * time.Second)
+	s.renewReceiptHandleLocked(m)
+	s.notifyLocked()
+	req.writeXML(http.StatusOK, &struct {
+		XMLName struct{} `xml:"ChangeVisibility"`
+
+		ReceiptHandle   string `xml:"ReceiptHandle"`
+		NextVisibleTime int64  `xml:"NextVisibleTime"`
+	}{
+		ReceiptHandle:   m.receiptHandle,
+		NextVisibleTime: unixMillisecond(m.nextVisibleTime),
+	})
+}
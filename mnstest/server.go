@@ -0,0 +1,551 @@
+// Package mnstest 提供一个内存中的 MNS 服务, 用于测试基于 queue.Queue, topic.Topic 和 client.Client 的代码.
+//
+// Server 使用 2015-06-06 版本的 XML 协议, 校验请求的签名, 支持队列和主题的管理接口, 消息的发送, 接收, 删除,
+// 修改不可见时间, 以及主题的消息推送到队列订阅. 另外可以控制 Server 的时间和注入错误.
+package mnstest
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+type Config struct {
+	// following is optional
+	AccessKeyId     string // 默认为 test-access-key-id
+	AccessKeySecret string // 默认为 test-access-key-secret
+	SecurityToken   string // 不为空时要求请求携带相同的 x-mns-security-token
+	AccountId       string // 默认为 1234567890123456
+	Region          string // 默认为 cn-hangzhou
+
+	AccessKeys map[string]string // 除了 AccessKeyId 之外可以访问 Server 的 AccessKeyId 和 AccessKeySecret
+
+	// Push 不为 nil 时, 发布到主题的消息通过 Push 推送给队列以外的 Endpoint (HTTP, 邮件, 短信), 为 nil 时丢弃这些消息.
+	// Push 在处理 PublishMessage 请求的 goroutine 中调用, 不能阻塞.
+	Push func(p *Push)
+}
+
+// Server 是内存中的 MNS 服务, 所有方法都可以并发调用.
+type Server struct {
+	URL string // http://127.0.0.1:port, 作为 queue.New, topic.New 和 client.New 的 endpoint
+
+	config Config
+	srv    *httptest.Server
+
+	mu       sync.Mutex
+	changed  chan struct{} // 状态变化时被关闭并替换, 用于唤醒等待消息的请求
+	now      time.Time     // 零值表示使用真实的时间
+	seq      int64
+	queues   map[string]*queueState
+	topics   map[string]*topicState
+	faults   []*Fault
+	requests map[string]int // map[operation]count
+}
+
+// NewServer 创建并启动一个新的 Server, config 可以为 nil, 使用完毕后需要调用 Close.
+func NewServer(config *Config) *Server {
+	s := NewUnstartedServer(config)
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// NewUnstartedServer 创建一个没有启动 HTTP 服务的 Server, 调用方通过 Server.ServeHTTP 自行提供服务,
+// 此时需要自行设置 URL.
+func NewUnstartedServer(config *Config) *Server {
+	s := &Server{
+		changed:  make(chan struct{}),
+		queues:   make(map[string]*queueState),
+		topics:   make(map[string]*topicState),
+		requests: make(map[string]int),
+	}
+	if config != nil {
+		s.config = *config
+	}
+	if s.config.AccessKeyId == "" {
+		s.config.AccessKeyId = "test-access-key-id"
+	}
+	if s.config.AccessKeySecret == "" {
+		s.config.AccessKeySecret = "test-access-key-secret"
+	}
+	if s.config.AccountId == "" {
+		s.config.AccountId = "1234567890123456"
+	}
+	if s.config.Region == "" {
+		s.config.Region = "cn-hangzhou"
+	}
+	return s
+}
+
+// Close 关闭 NewServer 启动的 HTTP 服务.
+func (s *Server) Close() {
+	if s.srv != nil {
+		s.srv.Close()
+	}
+}
+
+// Config 返回访问 Server 的 mns.Config.
+func (s *Server) Config() mns.Config {
+	config := mns.Config{
+		AccessKeyId:     s.config.AccessKeyId,
+		AccessKeySecret: s.config.AccessKeySecret,
+		SecurityToken:   s.config.SecurityToken,
+	}
+	if s.srv != nil {
+		config.HttpClient = s.srv.Client()
+	}
+	return config
+}
+
+// Now 返回 Server 当前的时间.
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nowLocked()
+}
+
+func (s *Server) nowLocked() time.Time {
+	if s.now.IsZero() {
+		return time.Now()
+	}
+	return s.now
+}
+
+// SetNow 把 Server 的时间设置为 t, 之后 Server 的时间不再流逝, 只能通过 SetNow 和 Advance 修改.
+//
+// 使用虚拟时间之后, 延时消息, 不可见时间和消息的过期时间都按照虚拟时间计算;
+// ReceiveMessage 的 waitseconds 在虚拟时间或者真实时间到达时结束, 避免没有推进时间时请求一直阻塞.
+func (s *Server) SetNow(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = t
+	s.notifyLocked()
+}
+
+// Advance 把 Server 的时间向前推进 d, 如果还没有使用虚拟时间, 从当前的真实时间开始.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.nowLocked().Add(d)
+	s.notifyLocked()
+}
+
+// notifyLocked 唤醒所有等待状态变化的请求, 调用方必须持有 s.mu.
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// RequestCount 返回接口 operation 被请求的次数, 包括注入错误的请求, 不包括签名错误的请求.
+// operation 和 internal.Operation.Name 一致, 比如 SendMessage, BatchReceiveMessage.
+func (s *Server) RequestCount(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[operation]
+}
+
+// Fault 描述注入的错误, 匹配的请求按照 Fault 的描述返回.
+type Fault struct {
+	Operation string // 匹配的接口, 比如 SendMessage, 为空匹配所有的接口
+	Resource  string // 匹配的队列名称或者主题名称, 为空匹配所有的队列和主题
+	Times     int    // 生效的次数, 0 表示一直生效直到 ClearFaults
+
+	Delay time.Duration // 处理请求之前等待的时间, 用于模拟网络延迟和超时
+
+	// StatusCode 不为 0 时直接返回错误, 不处理请求; Code 默认为 InternalError.
+	StatusCode int
+	Code       string
+	Message    string
+
+	// 下面的字段在 StatusCode 为 0 时生效
+	FailIndexes []int // BatchSendMessage 中发送失败的消息的下标, 返回 500 和每条消息的结果, 错误码为 Code
+	CorruptMD5  bool  // 返回错误的 MessageBodyMD5, 作用于发送, 接收, 查看和发布消息的接口
+}
+
+// AddFault 注入错误, 多个 Fault 匹配同一个请求时使用最先加入的.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults 清除所有注入的错误.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// takeFaultLocked 返回匹配 req 的 Fault, 并减少其剩余的次数, 调用方必须持有 s.mu.
+func (s *Server) takeFaultLocked(req *request) *Fault {
+	for i, f := range s.faults {
+		if f.Operation != "" && f.Operation != req.op {
+			continue
+		}
+		if f.Resource != "" && f.Resource != req.resource() {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		fault := *f
+		if fault.Code == "" {
+			fault.Code = mns.ErrorCodeInternalError
+		}
+		if fault.Message == "" {
+			fault.Message = "injected fault"
+		}
+		return &fault
+	}
+	return nil
+}
+
+// request 是一次 HTTP 请求的上下文.
+type request struct {
+	w         http.ResponseWriter
+	r         *http.Request
+	body      []byte
+	requestId string
+
+	op           string // 接口名称, 和 internal.Operation.Name 一致
+	queue        string
+	topic        string
+	subscription string
+
+	fault *Fault
+}
+
+func (req *request) resource() string {
+	if req.queue != "" {
+		return req.queue
+	}
+	return req.topic
+}
+
+func (req *request) corruptMD5() bool {
+	return req.fault != nil && req.fault.CorruptMD5
+}
+
+func (req *request) writeXML(statusCode int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		req.writeError(http.StatusInternalServerError, mns.ErrorCodeInternalError, err.Error())
+		return
+	}
+	req.w.Header().Set("Content-Type", internal.ContentType)
+	req.w.WriteHeader(statusCode)
+	req.w.Write([]byte(xml.Header))
+	req.w.Write(b)
+}
+
+func (req *request) writeStatus(statusCode int) {
+	req.w.WriteHeader(statusCode)
+}
+
+func (req *request) writeError(statusCode int, code, message string) {
+	req.writeXML(statusCode, &errorResponse{
+		Code:      code,
+		Message:   message,
+		RequestId: req.requestId,
+		HostId:    "http://" + req.r.Host,
+	})
+}
+
+type errorResponse struct {
+	XMLName struct{} `xml:"Error"`
+
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+	RequestId string `xml:"RequestId"`
+	HostId    string `xml:"HostId"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.seq++
+	requestId := fmt.Sprintf("%024X", s.seq)
+	s.mu.Unlock()
+	w.Header().Set("X-Mns-Request-Id", requestId)
+
+	req := &request{
+		w:         w,
+		r:         r,
+		requestId: requestId,
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	req.body = body
+
+	if code, message := s.authenticate(r, body); code != "" {
+		req.writeError(http.StatusForbidden, code, message)
+		return
+	}
+	if !route(req) {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "unsupported request: "+r.Method+" "+r.URL.Path)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[req.op]++
+	req.fault = s.takeFaultLocked(req)
+	s.mu.Unlock()
+
+	if req.fault != nil {
+		if req.fault.Delay > 0 {
+			timer := time.NewTimer(req.fault.Delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if req.fault.StatusCode != 0 {
+			req.writeError(req.fault.StatusCode, req.fault.Code, req.fault.Message)
+			return
+		}
+	}
+	s.handle(req)
+}
+
+// authenticate 校验请求的签名, 失败时返回错误码和错误信息.
+func (s *Server) authenticate(r *http.Request, body []byte) (code, message string) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "MNS ") {
+		return "AccessDenied", "the Authorization header is missing or invalid"
+	}
+	authorization = authorization[len("MNS "):]
+	i := strings.IndexByte(authorization, ':')
+	if i < 0 {
+		return "AccessDenied", "the Authorization header is invalid"
+	}
+	accessKeyId, signature := authorization[:i], authorization[i+1:]
+	accessKeySecret, ok := s.config.AccessKeys[accessKeyId]
+	if accessKeyId == s.config.AccessKeyId {
+		accessKeySecret, ok = s.config.AccessKeySecret, true
+	}
+	if !ok {
+		return "InvalidAccessKeyId", "the AccessKeyId " + accessKeyId + " does not exist"
+	}
+	if s.config.SecurityToken != "" && r.Header.Get("X-Mns-Security-Token") != s.config.SecurityToken {
+		return "InvalidSecurityToken", "the security token is invalid"
+	}
+	if len(body) > 0 && r.Header.Get("Content-Md5") != internal.ContentMD5(body) {
+		return "InvalidDigest", "the Content-MD5 does not match the request body"
+	}
+	if want := internal.Sign(r.Method, r.Header, r.URL.RequestURI(), accessKeySecret); signature != want {
+		return "SignatureDoesNotMatch", "the request signature does not match"
+	}
+	return "", ""
+}
+
+// route 根据请求的方法, 路径, 参数和请求体确定请求的接口, 不支持的请求返回 false.
+func route(req *request) bool {
+	r, query := req.r, req.r.URL.Query()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "queues" && r.Method == http.MethodGet:
+		req.op = "ListQueue"
+	case len(parts) == 2 && parts[0] == "queues":
+		req.queue = parts[1]
+		switch r.Method {
+		case http.MethodPut:
+			req.op = "CreateQueue"
+			if query.Get("metaoverride") == "true" {
+				req.op = "SetQueueAttributes"
+			}
+		case http.MethodGet:
+			req.op = "GetQueueAttributes"
+		case http.MethodDelete:
+			req.op = "DeleteQueue"
+		}
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "messages":
+		req.queue = parts[1]
+		switch r.Method {
+		case http.MethodPost:
+			req.op = "SendMessage"
+			if rootElement(req.body) == "Messages" {
+				req.op = "BatchSendMessage"
+			}
+		case http.MethodGet:
+			switch _, batch := query["numOfMessages"]; {
+			case query.Get("peekonly") == "true" && batch:
+				req.op = "BatchPeekMessage"
+			case query.Get("peekonly") == "true":
+				req.op = "PeekMessage"
+			case batch:
+				req.op = "BatchReceiveMessage"
+			default:
+				req.op = "ReceiveMessage"
+			}
+		case http.MethodDelete:
+			req.op = "BatchDeleteMessage"
+			if _, ok := query["ReceiptHandle"]; ok {
+				req.op = "DeleteMessage"
+			}
+		case http.MethodPut:
+			req.op = "ChangeMessageVisibility"
+		}
+	case len(parts) == 1 && parts[0] == "topics" && r.Method == http.MethodGet:
+		req.op = "ListTopic"
+	case len(parts) == 2 && parts[0] == "topics":
+		req.topic = parts[1]
+		switch r.Method {
+		case http.MethodPut:
+			req.op = "CreateTopic"
+			if query.Get("metaoverride") == "true" {
+				req.op = "SetTopicAttributes"
+			}
+		case http.MethodGet:
+			req.op = "GetTopicAttributes"
+		case http.MethodDelete:
+			req.op = "DeleteTopic"
+		}
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "messages" && r.Method == http.MethodPost:
+		req.topic = parts[1]
+		req.op = "PublishMessage"
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "subscriptions" && r.Method == http.MethodGet:
+		req.topic = parts[1]
+		req.op = "ListSubscriptionByTopic"
+	case len(parts) == 4 && parts[0] == "topics" && parts[2] == "subscriptions":
+		req.topic, req.subscription = parts[1], parts[3]
+		switch r.Method {
+		case http.MethodPut:
+			req.op = "Subscribe"
+			if query.Get("metaoverride") == "true" {
+				req.op = "SetSubscriptionAttributes"
+			}
+		case http.MethodGet:
+			req.op = "GetSubscriptionAttributes"
+		case http.MethodDelete:
+			req.op = "Unsubscribe"
+		}
+	}
+	return req.op != ""
+}
+
+// rootElement 返回 XML 文档的根元素的名称.
+func rootElement(body []byte) string {
+	decoder := xml.NewDecoder(strings.NewReader(string(body)))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if v, ok := tok.(xml.StartElement); ok {
+			return v.Name.Local
+		}
+	}
+}
+
+func (s *Server) handle(req *request) {
+	switch req.op {
+	case "ListQueue":
+		s.listQueue(req)
+	case "CreateQueue", "SetQueueAttributes":
+		s.putQueue(req)
+	case "GetQueueAttributes":
+		s.getQueueAttributes(req)
+	case "DeleteQueue":
+		s.deleteQueue(req)
+	case "SendMessage":
+		s.sendMessage(req)
+	case "BatchSendMessage":
+		s.batchSendMessage(req)
+	case "ReceiveMessage", "BatchReceiveMessage":
+		s.receiveMessage(req)
+	case "PeekMessage", "BatchPeekMessage":
+		s.peekMessage(req)
+	case "DeleteMessage":
+		s.deleteMessage(req)
+	case "BatchDeleteMessage":
+		s.batchDeleteMessage(req)
+	case "ChangeMessageVisibility":
+		s.changeMessageVisibility(req)
+	case "ListTopic":
+		s.listTopic(req)
+	case "CreateTopic", "SetTopicAttributes":
+		s.putTopic(req)
+	case "GetTopicAttributes":
+		s.getTopicAttributes(req)
+	case "DeleteTopic":
+		s.deleteTopic(req)
+	case "PublishMessage":
+		s.publishMessage(req)
+	case "ListSubscriptionByTopic":
+		s.listSubscription(req)
+	case "Subscribe", "SetSubscriptionAttributes":
+		s.putSubscription(req)
+	case "GetSubscriptionAttributes":
+		s.getSubscriptionAttributes(req)
+	case "Unsubscribe":
+		s.unsubscribe(req)
+	}
+}
+
+// waitLocked 等待 Server 的状态变化, 最多等待到真实时间 deadline, 使用真实的时间时在 wakeup 也会醒来.
+// 返回 false 表示请求被取消. 调用方必须持有 s.mu, 返回时仍然持有 s.mu.
+func (s *Server) waitLocked(ctx context.Context, deadline time.Time, wakeup time.Time) bool {
+	changed := s.changed
+	at := deadline
+	if s.now.IsZero() && !wakeup.IsZero() && wakeup.Before(at) {
+		at = wakeup
+	}
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-changed:
+	case <-timer.C:
+	}
+	return true
+}
+
+// list 实现 ListQueue, ListTopic 和 ListSubscriptionByTopic 的分页, names 必须已经排好序.
+func list(req *request, names []string) (page []string, nextMarker string) {
+	prefix, marker := req.r.Header.Get("X-Mns-Prefix"), req.r.Header.Get("X-Mns-Marker")
+	retNumber, _ := strconv.Atoi(req.r.Header.Get("X-Mns-Ret-Number"))
+	if retNumber < 1 || retNumber > 1000 {
+		retNumber = 1000
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || name < marker {
+			continue
+		}
+		if len(page) == retNumber {
+			nextMarker = name
+			break
+		}
+		page = append(page, name)
+	}
+	return
+}
+
+// newMessageIdLocked 返回一个新的 MessageId, 调用方必须持有 s.mu.
+func (s *Server) newMessageIdLocked() string {
+	s.seq++
+	return fmt.Sprintf("%016X-1-%011X-%09d", s.seq, unixMillisecond(s.nowLocked()), s.seq)
+}
+
+func unixMillisecond(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
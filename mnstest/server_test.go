@@ -0,0 +1,400 @@
+package mnstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+func newTestQueue(t *testing.T, attrs *QueueAttributes) (*Server, *queue.Queue) {
+	s := NewServer(nil)
+	t.Cleanup(s.Close)
+	s.CreateQueue("test", attrs)
+	config := s.Config()
+	config.RetryPolicy = &mns.RetryPolicy{MaxAttempts: 1}
+	return s, queue.New(s.URL, "test", config)
+}
+
+func TestServerSignature(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("test", nil)
+
+	config := s.Config()
+	config.AccessKeySecret = "wrong"
+	_, _, err := queue.New(s.URL, "test", config).SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body")})
+	if v, ok := err.(*mns.Error); !ok || v.HttpStatusCode != http.StatusForbidden || v.Code != "SignatureDoesNotMatch" {
+		t.Errorf("have:%v, want:SignatureDoesNotMatch", err)
+		return
+	}
+	if n := s.RequestCount("SendMessage"); n != 0 {
+		t.Errorf("have:%d, want:%d", n, 0)
+		return
+	}
+}
+
+func TestServerSendReceiveDelete(t *testing.T) {
+	s, q := newTestQueue(t, &QueueAttributes{VisibilityTimeout: 60})
+	s.SetNow(time.Unix(1600000000, 0))
+
+	_, sendResp, err := q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("hello")})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, msg, err := q.ReceiveMessage(1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if msg.MessageId != sendResp.MessageId || string(msg.MessageBody) != "hello" || msg.DequeueCount != 1 {
+		t.Errorf("unexpected message: %+v", msg)
+		return
+	}
+	if have, want := msg.NextVisibleTime, int64(1600000060000); have != want {
+		t.Errorf("have:%d, want:%d", have, want)
+		return
+	}
+	if _, _, err = q.ReceiveMessage(0); !mns.IsMessageNotExist(err) {
+		t.Errorf("have:%v, want:MessageNotExist", err)
+		return
+	}
+
+	// 不可见时间过了之后重新可见, DequeueCount 增加, 旧的 ReceiptHandle 失效
+	s.Advance(time.Minute)
+	_, msg2, err := q.ReceiveMessage(1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if msg2.DequeueCount != 2 || msg2.ReceiptHandle == msg.ReceiptHandle {
+		t.Errorf("unexpected message: %+v", msg2)
+		return
+	}
+	if _, err = q.DeleteMessage(msg.ReceiptHandle); !mns.IsReceiptHandleError(err) {
+		t.Errorf("have:%v, want:ReceiptHandleError", err)
+		return
+	}
+
+	// ChangeMessageVisibility 返回新的 ReceiptHandle, 之前的失效
+	_, changeResp, err := q.ChangeMessageVisibility(msg2.ReceiptHandle, 10)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = q.DeleteMessage(msg2.ReceiptHandle); !mns.IsReceiptHandleError(err) {
+		t.Errorf("have:%v, want:ReceiptHandleError", err)
+		return
+	}
+	if _, err = q.DeleteMessage(changeResp.ReceiptHandle); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = q.DeleteMessage(changeResp.ReceiptHandle); !mns.IsMessageNotExist(err) {
+		t.Errorf("have:%v, want:MessageNotExist", err)
+		return
+	}
+	if msgs := s.Messages("test"); len(msgs) != 0 {
+		t.Errorf("have:%d, want:%d", len(msgs), 0)
+		return
+	}
+}
+
+func TestServerDelayAndPriority(t *testing.T) {
+	s, q := newTestQueue(t, nil)
+	s.SetNow(time.Unix(1600000000, 0))
+
+	msgs := []queue.SendMessageRequest{
+		{MessageBody: []byte("low"), Priority: 16},
+		{MessageBody: []byte("delayed"), Priority: 1, DelaySeconds: 10},
+		{MessageBody: []byte("high"), Priority: 1},
+		{MessageBody: []byte("normal")},
+	}
+	if _, _, err := q.BatchSendMessage(msgs); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, peeked, err := q.BatchPeekMessage(16)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have := bodies(peeked); have != "high,normal,low" {
+		t.Errorf("have:%s, want:%s", have, "high,normal,low")
+		return
+	}
+
+	s.Advance(10 * time.Second)
+	_, received, err := q.BatchReceiveMessage(16, 1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	var have []string
+	for i := range received {
+		have = append(have, string(received[i].MessageBody))
+	}
+	if want := []string{"delayed", "high", "normal", "low"}; len(have) != len(want) || have[0] != want[0] || have[1] != want[1] || have[3] != want[3] {
+		t.Errorf("have:%v, want:%v", have, want)
+		return
+	}
+
+	receiptHandles := []string{received[0].ReceiptHandle, received[1].ReceiptHandle, "invalid"}
+	_, _errors, err := q.BatchDeleteMessage(receiptHandles)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(_errors) != 1 || _errors[0].ReceiptHandle != "invalid" {
+		t.Errorf("unexpected errors: %+v", _errors)
+		return
+	}
+	if n := len(s.Messages("test")); n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+
+	_, _, err = q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("invalid"), Priority: 17})
+	if v, ok := err.(*mns.Error); !ok || v.Message != "the Priority must be between 1 and 16, or 0 for the default 8" {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
+
+func bodies(msgs []queue.PeekMessageResponse) string {
+	var buf bytes.Buffer
+	for i := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(msgs[i].MessageBody)
+	}
+	return buf.String()
+}
+
+func TestServerLongPolling(t *testing.T) {
+	_, q := newTestQueue(t, nil)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("late")})
+	}()
+	start := time.Now()
+	_, msg, err := q.ReceiveMessage(5)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msg.MessageBody) != "late" {
+		t.Errorf("have:%s, want:%s", msg.MessageBody, "late")
+		return
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("long polling should return when the message arrives, elapsed:%v", elapsed)
+		return
+	}
+}
+
+func TestServerLongPollingVirtualTime(t *testing.T) {
+	s, q := newTestQueue(t, nil)
+	s.SetNow(time.Unix(1600000000, 0))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := q.ReceiveMessage(30)
+		done <- err
+	}()
+	for s.RequestCount("ReceiveMessage") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Errorf("ReceiveMessage returned before waitseconds elapsed: %v", err)
+		return
+	default:
+	}
+
+	s.Advance(30 * time.Second)
+	if err := <-done; !mns.IsMessageNotExist(err) {
+		t.Errorf("have:%v, want:MessageNotExist", err)
+		return
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("test", nil)
+	config := s.Config()
+	config.RetryPolicy = &mns.RetryPolicy{InitialBackoff: time.Millisecond}
+	q := queue.New(s.URL, "test", config)
+
+	// 500 之后重试成功
+	s.AddFault(Fault{Operation: "SendMessage", Times: 2, StatusCode: http.StatusInternalServerError})
+	if _, _, err := q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n := s.RequestCount("SendMessage"); n != 3 {
+		t.Errorf("have:%d, want:%d", n, 3)
+		return
+	}
+
+	// 部分消息发送失败
+	s.AddFault(Fault{Operation: "BatchSendMessage", Times: 1, FailIndexes: []int{1}})
+	_, items, err := q.BatchSendMessage([]queue.SendMessageRequest{{MessageBody: []byte("a")}, {MessageBody: []byte("b")}, {MessageBody: []byte("c")}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if items[0].ErrorCode != "" || items[1].ErrorCode != mns.ErrorCodeInternalError || items[2].ErrorCode != "" {
+		t.Errorf("unexpected items: %+v", items)
+		return
+	}
+	if n := len(s.Messages("test")); n != 3 {
+		t.Errorf("have:%d, want:%d", n, 3)
+		return
+	}
+
+	// MessageBodyMD5 错误
+	s.AddFault(Fault{Operation: "ReceiveMessage", Resource: "test", Times: 1, CorruptMD5: true})
+	if _, _, err = q.ReceiveMessage(1); err == nil {
+		t.Error("want MD5 mismatch error")
+		return
+	}
+	s.ClearFaults()
+	if _, _, err = q.ReceiveMessage(1); err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
+
+func TestServerPublish(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("xml", nil)
+	s.CreateQueue("simplified", nil)
+	s.CreateQueue("filtered", nil)
+	s.CreateTopic("test")
+
+	config := s.Config()
+	tp := topic.New(s.URL, "test", config)
+	subscriptions := map[string]*topic.SubscribeRequest{
+		"xml":        {Endpoint: topic.QueueEndpoint("cn-hangzhou", "1234567890123456", "xml")},
+		"simplified": {Endpoint: topic.QueueEndpoint("cn-hangzhou", "1234567890123456", "simplified"), NotifyContentFormat: topic.NotifyContentFormatSimplified},
+		"filtered":   {Endpoint: topic.QueueEndpoint("cn-hangzhou", "1234567890123456", "filtered"), FilterTag: "other"},
+	}
+	for name, req := range subscriptions {
+		if _, err := tp.Subscribe(name, req); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+
+	_, resp, err := tp.PublishMessage(&topic.PublishMessageRequest{MessageBody: []byte("hello"), MessageTag: "tag"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, msg, err := queue.New(s.URL, "xml", config).ReceiveMessage(1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	var n struct {
+		TopicName        string `xml:"TopicName"`
+		SubscriptionName string `xml:"SubscriptionName"`
+		MessageId        string `xml:"MessageId"`
+		MessageMD5       string `xml:"MessageMD5"`
+		MessageTag       string `xml:"MessageTag"`
+		Message          string `xml:"Message"`
+	}
+	if err = xml.Unmarshal(msg.MessageBody, &n); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if n.TopicName != "test" || n.SubscriptionName != "xml" || n.MessageId != resp.MessageId || n.MessageTag != "tag" || n.Message != "hello" || n.MessageMD5 != internal.MessageBodyMD5([]byte("hello")) {
+		t.Errorf("unexpected notification: %+v", n)
+		return
+	}
+
+	if _, msg, err = queue.New(s.URL, "simplified", config).ReceiveMessage(1); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msg.MessageBody) != "hello" {
+		t.Errorf("have:%s, want:%s", msg.MessageBody, "hello")
+		return
+	}
+
+	if n := len(s.Messages("filtered")); n != 0 {
+		t.Errorf("have:%d, want:%d", n, 0)
+		return
+	}
+}
+
+func TestServerSnapshotRestore(t *testing.T) {
+	s, q := newTestQueue(t, &QueueAttributes{VisibilityTimeout: 60})
+	s.CreateTopic("test")
+	config := s.Config()
+	if _, err := topic.New(s.URL, "test", config).Subscribe("http", &topic.SubscribeRequest{Endpoint: "http://127.0.0.1/notify"}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, _, err := q.BatchSendMessage([]queue.SendMessageRequest{{MessageBody: []byte("a")}, {MessageBody: []byte("b")}}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	_, msg, err := q.ReceiveMessage(0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	data, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	var snapshot Snapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	s2 := NewServer(nil)
+	defer s2.Close()
+	s2.Restore(&snapshot)
+
+	if have := len(s2.Snapshot().Topics[0].Subscriptions); have != 1 {
+		t.Errorf("have:%d, want:%d", have, 1)
+		return
+	}
+	q2 := queue.New(s2.URL, "test", config)
+	_, _, err = q2.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("c")})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	msgs := s2.Messages("test")
+	if len(msgs) != 3 || msgs[2].MessageId == msgs[0].MessageId || msgs[2].MessageId == msgs[1].MessageId {
+		t.Errorf("unexpected messages: %+v", msgs)
+		return
+	}
+	// 恢复之后之前接收到的 ReceiptHandle 仍然有效
+	if _, err = q2.DeleteMessage(msg.ReceiptHandle); err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
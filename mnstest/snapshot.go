@@ -0,0 +1,170 @@
+package mnstest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// Snapshot 是 Server 中所有队列, 主题和消息的快照, 可以编码为 JSON 保存, 之后通过 Server.Restore 恢复.
+type Snapshot struct {
+	Queues []QueueSnapshot
+	Topics []TopicSnapshot
+}
+
+type QueueSnapshot struct {
+	Name           string
+	Attributes     QueueAttributes
+	LoggingEnabled bool
+	CreateTime     time.Time
+	LastModifyTime time.Time
+	Messages       []Message // 按照发送的顺序排列
+}
+
+type TopicSnapshot struct {
+	Name                   string
+	MaximumMessageSize     int
+	MessageRetentionPeriod int
+	LoggingEnabled         bool
+	CreateTime             time.Time
+	LastModifyTime         time.Time
+	MessageCount           int64
+	Subscriptions          []SubscriptionSnapshot
+}
+
+type SubscriptionSnapshot struct {
+	Name                string
+	Endpoint            string
+	FilterTag           string
+	NotifyStrategy      string
+	NotifyContentFormat string
+	CreateTime          time.Time
+	LastModifyTime      time.Time
+}
+
+// Snapshot 返回 Server 当前状态的快照, 队列和主题按照名称排列.
+func (s *Server) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.nowLocked()
+	snapshot := &Snapshot{
+		Queues: make([]QueueSnapshot, 0, len(s.queues)),
+		Topics: make([]TopicSnapshot, 0, len(s.topics)),
+	}
+	for _, q := range s.queues {
+		q.expireLocked(now)
+		qs := QueueSnapshot{
+			Name:           q.name,
+			Attributes:     q.attrs,
+			LoggingEnabled: q.loggingEnabled,
+			CreateTime:     q.createTime,
+			LastModifyTime: q.lastModifyTime,
+			Messages:       make([]Message, len(q.messages)),
+		}
+		for i, m := range q.messages {
+			qs.Messages[i] = m.snapshot()
+		}
+		snapshot.Queues = append(snapshot.Queues, qs)
+	}
+	for _, t := range s.topics {
+		ts := TopicSnapshot{
+			Name:                   t.name,
+			MaximumMessageSize:     t.maximumMessageSize,
+			MessageRetentionPeriod: t.messageRetentionPeriod,
+			LoggingEnabled:         t.loggingEnabled,
+			CreateTime:             t.createTime,
+			LastModifyTime:         t.lastModifyTime,
+			MessageCount:           t.messageCount,
+			Subscriptions:          make([]SubscriptionSnapshot, 0, len(t.subscriptions)),
+		}
+		for _, sub := range t.subscriptions {
+			ts.Subscriptions = append(ts.Subscriptions, SubscriptionSnapshot{
+				Name:                sub.name,
+				Endpoint:            sub.endpoint,
+				FilterTag:           sub.filterTag,
+				NotifyStrategy:      sub.notifyStrategy,
+				NotifyContentFormat: sub.notifyContentFormat,
+				CreateTime:          sub.createTime,
+				LastModifyTime:      sub.lastModifyTime,
+			})
+		}
+		sort.Slice(ts.Subscriptions, func(i, j int) bool { return ts.Subscriptions[i].Name < ts.Subscriptions[j].Name })
+		snapshot.Topics = append(snapshot.Topics, ts)
+	}
+	sort.Slice(snapshot.Queues, func(i, j int) bool { return snapshot.Queues[i].Name < snapshot.Queues[j].Name })
+	sort.Slice(snapshot.Topics, func(i, j int) bool { return snapshot.Topics[i].Name < snapshot.Topics[j].Name })
+	return snapshot
+}
+
+// Restore 用 snapshot 替换 Server 当前所有的队列和主题.
+func (s *Server) Restore(snapshot *Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues = make(map[string]*queueState, len(snapshot.Queues))
+	for _, qs := range snapshot.Queues {
+		q := &queueState{
+			name:           qs.Name,
+			attrs:          withQueueDefaults(qs.Attributes),
+			loggingEnabled: qs.LoggingEnabled,
+			createTime:     qs.CreateTime,
+			lastModifyTime: qs.LastModifyTime,
+			messages:       make([]*message, len(qs.Messages)),
+		}
+		for i := range qs.Messages {
+			m := &qs.Messages[i]
+			q.messages[i] = &message{
+				id:               m.MessageId,
+				body:             append([]byte(nil), m.MessageBody...),
+				md5:              internal.MessageBodyMD5(m.MessageBody),
+				priority:         m.Priority,
+				enqueueTime:      m.EnqueueTime,
+				nextVisibleTime:  m.NextVisibleTime,
+				firstDequeueTime: m.FirstDequeueTime,
+				dequeueCount:     m.DequeueCount,
+				receiptHandle:    m.ReceiptHandle,
+			}
+			// 保证之后生成的 MessageId 和 ReceiptHandle 不会重复
+			if seq, err := strconv.ParseInt(m.MessageId[:strings.IndexByte(m.MessageId+"-", '-')], 16, 64); err == nil && seq > s.seq {
+				s.seq = seq
+			}
+			if i := strings.LastIndexByte(m.ReceiptHandle, '.'); i >= 0 {
+				if seq, err := strconv.ParseInt(m.ReceiptHandle[i+1:], 16, 64); err == nil && seq > s.seq {
+					s.seq = seq
+				}
+			}
+		}
+		s.queues[q.name] = q
+	}
+
+	s.topics = make(map[string]*topicState, len(snapshot.Topics))
+	for _, ts := range snapshot.Topics {
+		t := &topicState{
+			name:                   ts.Name,
+			maximumMessageSize:     ts.MaximumMessageSize,
+			messageRetentionPeriod: ts.MessageRetentionPeriod,
+			loggingEnabled:         ts.LoggingEnabled,
+			createTime:             ts.CreateTime,
+			lastModifyTime:         ts.LastModifyTime,
+			messageCount:           ts.MessageCount,
+			subscriptions:          make(map[string]*subscriptionState, len(ts.Subscriptions)),
+		}
+		for _, sub := range ts.Subscriptions {
+			t.subscriptions[sub.Name] = &subscriptionState{
+				name:                sub.Name,
+				endpoint:            sub.Endpoint,
+				filterTag:           sub.FilterTag,
+				notifyStrategy:      sub.NotifyStrategy,
+				notifyContentFormat: sub.NotifyContentFormat,
+				createTime:          sub.CreateTime,
+				lastModifyTime:      sub.LastModifyTime,
+			}
+		}
+		s.topics[t.name] = t
+	}
+	s.notifyLocked()
+}
@@ -0,0 +1,482 @@
+package mnstest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+type topicState struct {
+	name                   string
+	maximumMessageSize     int
+	messageRetentionPeriod int
+	loggingEnabled         bool
+	createTime             time.Time
+	lastModifyTime         time.Time
+	messageCount           int64
+
+	subscriptions map[string]*subscriptionState
+}
+
+type subscriptionState struct {
+	name                string
+	endpoint            string
+	filterTag           string
+	notifyStrategy      string
+	notifyContentFormat string
+	createTime          time.Time
+	lastModifyTime      time.Time
+}
+
+// CreateTopic 直接创建主题, 不需要通过 HTTP 请求. 主题已经存在时什么都不做.
+func (s *Server) CreateTopic(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.topics[name] != nil {
+		return
+	}
+	now := s.nowLocked()
+	s.topics[name] = &topicState{
+		name:                   name,
+		maximumMessageSize:     65536,
+		messageRetentionPeriod: 86400,
+		createTime:             now,
+		lastModifyTime:         now,
+		subscriptions:          make(map[string]*subscriptionState),
+	}
+}
+
+func (s *Server) topicLocked(req *request) *topicState {
+	t := s.topics[req.topic]
+	if t == nil {
+		req.writeError(mns.ErrorHttpStatusCodeTopicNotExist, mns.ErrorCodeTopicNotExist, "The topic you provided does not exist.")
+		return nil
+	}
+	return t
+}
+
+type topicAttributesRequest struct {
+	XMLName struct{} `xml:"Topic"`
+
+	MaximumMessageSize *int  `xml:"MaximumMessageSize"`
+	LoggingEnabled     *bool `xml:"LoggingEnabled"`
+}
+
+func (s *Server) putTopic(req *request) {
+	var body topicAttributesRequest
+	if len(req.body) > 0 {
+		if err := xml.Unmarshal(req.body, &body); err != nil {
+			req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.nowLocked()
+	if req.op == "SetTopicAttributes" {
+		t := s.topicLocked(req)
+		if t == nil {
+			return
+		}
+		if body.MaximumMessageSize != nil {
+			t.maximumMessageSize = *body.MaximumMessageSize
+		}
+		if body.LoggingEnabled != nil {
+			t.loggingEnabled = *body.LoggingEnabled
+		}
+		t.lastModifyTime = now
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+
+	maximumMessageSize, loggingEnabled := 65536, false
+	if body.MaximumMessageSize != nil {
+		maximumMessageSize = *body.MaximumMessageSize
+	}
+	if body.LoggingEnabled != nil {
+		loggingEnabled = *body.LoggingEnabled
+	}
+	if t := s.topics[req.topic]; t != nil {
+		if t.maximumMessageSize != maximumMessageSize || t.loggingEnabled != loggingEnabled {
+			req.writeError(mns.ErrorHttpStatusCodeTopicAlreadyExist, mns.ErrorCodeTopicAlreadyExist, "The topic you want to create already exist.")
+			return
+		}
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+	s.topics[req.topic] = &topicState{
+		name:                   req.topic,
+		maximumMessageSize:     maximumMessageSize,
+		messageRetentionPeriod: 86400,
+		loggingEnabled:         loggingEnabled,
+		createTime:             now,
+		lastModifyTime:         now,
+		subscriptions:          make(map[string]*subscriptionState),
+	}
+	req.w.Header().Set("Location", "http://"+req.r.Host+"/topics/"+req.topic)
+	req.writeStatus(http.StatusCreated)
+}
+
+func (s *Server) getTopicAttributes(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.topicLocked(req)
+	if t == nil {
+		return
+	}
+	req.writeXML(http.StatusOK, &struct {
+		XMLName struct{} `xml:"Topic"`
+
+		TopicName              string `xml:"TopicName"`
+		CreateTime             int64  `xml:"CreateTime"`
+		LastModifyTime         int64  `xml:"LastModifyTime"`
+		MaximumMessageSize     int    `xml:"MaximumMessageSize"`
+		MessageRetentionPeriod int    `xml:"MessageRetentionPeriod"`
+		MessageCount           int64  `xml:"MessageCount"`
+		LoggingEnabled         bool   `xml:"LoggingEnabled"`
+	}{
+		TopicName:              t.name,
+		CreateTime:             t.createTime.Unix(),
+		LastModifyTime:         t.lastModifyTime.Unix(),
+		MaximumMessageSize:     t.maximumMessageSize,
+		MessageRetentionPeriod: t.messageRetentionPeriod,
+		MessageCount:           t.messageCount,
+		LoggingEnabled:         t.loggingEnabled,
+	})
+}
+
+func (s *Server) deleteTopic(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.topics, req.topic)
+	req.writeStatus(http.StatusNoContent)
+}
+
+type listTopicResponse struct {
+	XMLName struct{} `xml:"Topics"`
+
+	Topics []struct {
+		TopicURL string `xml:"TopicURL"`
+	} `xml:"Topic"`
+	NextMarker string `xml:"NextMarker,omitempty"`
+}
+
+func (s *Server) listTopic(req *request) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.topics))
+	for name := range s.topics {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	page, nextMarker := list(req, names)
+	resp := &listTopicResponse{NextMarker: nextMarker}
+	resp.Topics = make([]struct {
+		TopicURL string `xml:"TopicURL"`
+	}, len(page))
+	for i, name := range page {
+		resp.Topics[i].TopicURL = "http://" + req.r.Host + "/topics/" + name
+	}
+	req.writeXML(http.StatusOK, resp)
+}
+
+// notification 是主题推送给订阅者的消息, 按照订阅的 NotifyContentFormat 编码为 XML 或者 JSON.
+type notification struct {
+	XMLName struct{} `xml:"Notification" json:"-"`
+
+	TopicOwner       string `xml:"TopicOwner" json:"TopicOwner"`
+	TopicName        string `xml:"TopicName" json:"TopicName"`
+	Subscriber       string `xml:"Subscriber" json:"Subscriber"`
+	SubscriptionName string `xml:"SubscriptionName" json:"SubscriptionName"`
+	MessageId        string `xml:"MessageId" json:"MessageId"`
+	MessageMD5       string `xml:"MessageMD5" json:"MessageMD5"`
+	MessageTag       string `xml:"MessageTag,omitempty" json:"MessageTag,omitempty"`
+	Message          string `xml:"Message" json:"Message"`
+	PublishTime      int64  `xml:"PublishTime" json:"PublishTime"`
+}
+
+// encodeNotification 按照 format 编码推送的消息, SIMPLIFIED 格式直接返回消息体.
+func encodeNotification(format string, n *notification) []byte {
+	switch format {
+	case "SIMPLIFIED":
+		return []byte(n.Message)
+	case "JSON":
+		b, _ := json.Marshal(n)
+		return b
+	default:
+		b, _ := xml.Marshal(n)
+		return append([]byte(xml.Header), b...)
+	}
+}
+
+// Push 是需要推送给队列以外的 Endpoint 的一条消息, 见 Config.Push.
+type Push struct {
+	TopicName           string
+	SubscriptionName    string
+	Endpoint            string // 订阅的 Endpoint, 比如 http://host/path, mail:directmail:{MailAddress}
+	NotifyStrategy      string // BACKOFF_RETRY 或者 EXPONENTIAL_DECAY_RETRY
+	NotifyContentFormat string // XML, JSON 或者 SIMPLIFIED
+	MessageId           string
+	MessageTag          string
+	Body                []byte // 按照 NotifyContentFormat 编码之后的消息
+}
+
+// queueName 返回 QueueEndpoint 中的队列名称, 不是 QueueEndpoint 时返回空.
+//  acs:mns:{REGION}:{AccountID}:queues/{QueueName}
+func queueName(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "acs:mns:") {
+		return ""
+	}
+	i := strings.Index(endpoint, ":queues/")
+	if i < 0 {
+		return ""
+	}
+	return endpoint[i+len(":queues/"):]
+}
+
+func (s *Server) publishMessage(req *request) {
+	var body struct {
+		XMLName struct{} `xml:"Message"`
+
+		MessageBody []byte `xml:"MessageBody"`
+		MessageTag  string `xml:"MessageTag"`
+	}
+	if err := xml.Unmarshal(req.body, &body); err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	var pushes []*Push
+	defer func() {
+		for _, p := range pushes {
+			s.config.Push(p) // 在释放 s.mu 之后调用
+		}
+	}()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.topicLocked(req)
+	if t == nil {
+		return
+	}
+	switch {
+	case len(body.MessageBody) == 0:
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the MessageBody must not be empty")
+		return
+	case len(body.MessageBody) > t.maximumMessageSize:
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the MessageBody is larger than MaximumMessageSize")
+		return
+	}
+
+	now := s.nowLocked()
+	n := notification{
+		TopicOwner:  s.config.AccountId,
+		TopicName:   t.name,
+		Subscriber:  s.config.AccountId,
+		MessageId:   s.newMessageIdLocked(),
+		MessageMD5:  internal.MessageBodyMD5(body.MessageBody),
+		MessageTag:  body.MessageTag,
+		Message:     string(body.MessageBody),
+		PublishTime: unixMillisecond(now),
+	}
+	t.messageCount++
+
+	names := make([]string, 0, len(t.subscriptions))
+	for name := range t.subscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := t.subscriptions[name]
+		if sub.filterTag != "" && sub.filterTag != body.MessageTag {
+			continue
+		}
+		n.SubscriptionName = sub.name
+		body := encodeNotification(sub.notifyContentFormat, &n)
+		if name := queueName(sub.endpoint); name != "" {
+			if q := s.queues[name]; q != nil {
+				s.enqueueLocked(q, body, -1, 0)
+			}
+			continue // 队列不存在时丢弃
+		}
+		if s.config.Push != nil {
+			pushes = append(pushes, &Push{
+				TopicName:           t.name,
+				SubscriptionName:    sub.name,
+				Endpoint:            sub.endpoint,
+				NotifyStrategy:      sub.notifyStrategy,
+				NotifyContentFormat: sub.notifyContentFormat,
+				MessageId:           n.MessageId,
+				MessageTag:          n.MessageTag,
+				Body:                body,
+			})
+		}
+	}
+
+	req.writeXML(http.StatusCreated, &struct {
+		XMLName struct{} `xml:"Message"`
+
+		MessageId      string `xml:"MessageId"`
+		MessageBodyMD5 string `xml:"MessageBodyMD5"`
+	}{
+		MessageId:      n.MessageId,
+		MessageBodyMD5: req.md5(n.MessageMD5),
+	})
+}
+
+type subscriptionRequest struct {
+	XMLName struct{} `xml:"Subscription"`
+
+	Endpoint            string `xml:"Endpoint"`
+	FilterTag           string `xml:"FilterTag"`
+	NotifyStrategy      string `xml:"NotifyStrategy"`
+	NotifyContentFormat string `xml:"NotifyContentFormat"`
+}
+
+func (s *Server) putSubscription(req *request) {
+	var body subscriptionRequest
+	if err := xml.Unmarshal(req.body, &body); err != nil {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.topicLocked(req)
+	if t == nil {
+		return
+	}
+	now := s.nowLocked()
+	sub := t.subscriptions[req.subscription]
+	if req.op == "SetSubscriptionAttributes" {
+		if sub == nil {
+			req.writeError(mns.ErrorHttpStatusCodeSubscriptionNotExist, mns.ErrorCodeSubscriptionNotExist, "The subscription you provided does not exist.")
+			return
+		}
+		if body.NotifyStrategy != "" {
+			sub.notifyStrategy = body.NotifyStrategy
+		}
+		sub.lastModifyTime = now
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+
+	if body.Endpoint == "" {
+		req.writeError(http.StatusBadRequest, "InvalidArgument", "the Endpoint must not be empty")
+		return
+	}
+	if body.NotifyStrategy == "" {
+		body.NotifyStrategy = "BACKOFF_RETRY"
+	}
+	if body.NotifyContentFormat == "" {
+		body.NotifyContentFormat = "XML"
+	}
+	if sub != nil {
+		if sub.endpoint != body.Endpoint || sub.filterTag != body.FilterTag || sub.notifyStrategy != body.NotifyStrategy || sub.notifyContentFormat != body.NotifyContentFormat {
+			req.writeError(mns.ErrorHttpStatusCodeSubscriptionAlreadyExist, mns.ErrorCodeSubscriptionAlreadyExist, "The subscription you want to create already exist.")
+			return
+		}
+		req.writeStatus(http.StatusNoContent)
+		return
+	}
+	t.subscriptions[req.subscription] = &subscriptionState{
+		name:                req.subscription,
+		endpoint:            body.Endpoint,
+		filterTag:           body.FilterTag,
+		notifyStrategy:      body.NotifyStrategy,
+		notifyContentFormat: body.NotifyContentFormat,
+		createTime:          now,
+		lastModifyTime:      now,
+	}
+	req.w.Header().Set("Location", "http://"+req.r.Host+"/topics/"+req.topic+"/subscriptions/"+req.subscription)
+	req.writeStatus(http.StatusCreated)
+}
+
+func (s *Server) getSubscriptionAttributes(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.topicLocked(req)
+	if t == nil {
+		return
+	}
+	sub := t.subscriptions[req.subscription]
+	if sub == nil {
+		req.writeError(mns.ErrorHttpStatusCodeSubscriptionNotExist, mns.ErrorCodeSubscriptionNotExist, "The subscription you provided does not exist.")
+		return
+	}
+	req.writeXML(http.StatusOK, &struct {
+		XMLName struct{} `xml:"Subscription"`
+
+		SubscriptionName    string `xml:"SubscriptionName"`
+		Subscriber          string `xml:"Subscriber"`
+		TopicOwner          string `xml:"TopicOwner"`
+		TopicName           string `xml:"TopicName"`
+		Endpoint            string `xml:"Endpoint"`
+		FilterTag           string `xml:"FilterTag"`
+		NotifyStrategy      string `xml:"NotifyStrategy"`
+		NotifyContentFormat string `xml:"NotifyContentFormat"`
+		CreateTime          int64  `xml:"CreateTime"`
+		LastModifyTime      int64  `xml:"LastModifyTime"`
+	}{
+		SubscriptionName:    sub.name,
+		Subscriber:          s.config.AccountId,
+		TopicOwner:          s.config.AccountId,
+		TopicName:           t.name,
+		Endpoint:            sub.endpoint,
+		FilterTag:           sub.filterTag,
+		NotifyStrategy:      sub.notifyStrategy,
+		NotifyContentFormat: sub.notifyContentFormat,
+		CreateTime:          sub.createTime.Unix(),
+		LastModifyTime:      sub.lastModifyTime.Unix(),
+	})
+}
+
+func (s *Server) unsubscribe(req *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.topics[req.topic]; t != nil {
+		delete(t.subscriptions, req.subscription)
+	}
+	req.writeStatus(http.StatusNoContent)
+}
+
+type listSubscriptionResponse struct {
+	XMLName struct{} `xml:"Subscriptions"`
+
+	Subscriptions []struct {
+		SubscriptionURL string `xml:"SubscriptionURL"`
+	} `xml:"Subscription"`
+	NextMarker string `xml:"NextMarker,omitempty"`
+}
+
+func (s *Server) listSubscription(req *request) {
+	s.mu.Lock()
+	t := s.topicLocked(req)
+	if t == nil {
+		s.mu.Unlock()
+		return
+	}
+	names := make([]string, 0, len(t.subscriptions))
+	for name := range t.subscriptions {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	page, nextMarker := list(req, names)
+	resp := &listSubscriptionResponse{NextMarker: nextMarker}
+	resp.Subscriptions = make([]struct {
+		SubscriptionURL string `xml:"SubscriptionURL"`
+	}, len(page))
+	for i, name := range page {
+		resp.Subscriptions[i].SubscriptionURL = "http://" + req.r.Host + "/topics/" + req.topic + "/subscriptions/" + name
+	}
+	req.writeXML(http.StatusOK, resp)
+}
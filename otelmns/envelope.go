@@ -0,0 +1,71 @@
+package otelmns
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func propagator(config *Config) propagation.TextMapPropagator {
+	if config != nil && config.Propagator != nil {
+		return config.Propagator
+	}
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// Inject 把 ctx 中的 trace context 和 baggage 写入信封格式的消息体, config 可以为 nil.
+// body 已经是信封格式时, 保留其中已有的 header (比如自定义的 header), 只覆盖 trace context 相关的 header.
+func Inject(ctx context.Context, body []byte, config *Config) []byte {
+	return inject(ctx, propagator(config), body)
+}
+
+// Extract 解开信封格式的消息体, 返回带有发送方 trace context 和 baggage 的 context 以及去掉 trace context 相关的 header 之后的消息, config 可以为 nil.
+// 信封中还有其他的 header (比如死信的 header) 时返回的消息仍然是信封格式, 否则返回原始的消息; body 不是信封格式时返回 ctx 和 body 本身.
+func Extract(ctx context.Context, body []byte, config *Config) (context.Context, []byte) {
+	header, payload, ok := mns.DecodeEnvelope(body)
+	if !ok {
+		return ctx, body
+	}
+	p := propagator(config)
+	return p.Extract(ctx, propagation.MapCarrier(header)), strip(p, header, payload)
+}
+
+func inject(ctx context.Context, p propagation.TextMapPropagator, body []byte) []byte {
+	header, payload, ok := mns.DecodeEnvelope(body)
+	if !ok {
+		header = make(map[string]string)
+	}
+	p.Inject(ctx, propagation.MapCarrier(header))
+	return mns.EncodeEnvelope(header, payload)
+}
+
+// strip 删除 header 中 trace context 相关的 header, 没有其他的 header 时返回 payload, 否则返回重新编码的信封.
+func strip(p propagation.TextMapPropagator, header map[string]string, payload []byte) []byte {
+	for _, key := range p.Fields() {
+		delete(header, key)
+	}
+	if len(header) == 0 {
+		return payload
+	}
+	return mns.EncodeEnvelope(header, payload)
+}
+
+// unwrap 解开信封格式的消息体, 返回去掉 trace context 之后的消息 (见 strip) 和发送消息的 span 的 link; body 不是信封格式或者没有 trace context 时 ok 为 false.
+func (t *tracer) unwrap(ctx context.Context, body []byte) (payload []byte, link trace.Link, ok bool) {
+	if !t.envelopeEnabled {
+		return body, trace.Link{}, false
+	}
+	header, payload, isEnvelope := mns.DecodeEnvelope(body)
+	if !isEnvelope {
+		return body, trace.Link{}, false
+	}
+	spanContext := trace.SpanContextFromContext(t.propagator.Extract(ctx, propagation.MapCarrier(header)))
+	payload = strip(t.propagator, header, payload)
+	if !spanContext.IsValid() {
+		return payload, trace.Link{}, false
+	}
+	return payload, trace.Link{SpanContext: spanContext}, true
+}
@@ -0,0 +1,118 @@
+// Package otelmns 为 queue.API 和 topic.API 添加 OpenTelemetry 的 span.
+//
+//  q := otelmns.NewQueue(queue.New(endpoint, queueName, config), queueName, nil)
+//  t := otelmns.NewTopic(topic.New(endpoint, topicName, config), topicName, nil)
+//
+// span 的属性遵循 messaging 的语义约定, 另外记录 MNS 的 X-Mns-Request-Id 和错误码.
+package otelmns
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+const instrumentationName = "github.com/chanxuehong/mns.aliyun.v20150606/otelmns"
+
+// messaging.system 的值
+const System = "alibaba_mns"
+
+const (
+	RequestIdKey   = attribute.Key("messaging.alibaba_mns.request_id")   // X-Mns-Request-Id
+	ErrorCodeKey   = attribute.Key("messaging.alibaba_mns.error_code")   // MNS 返回的错误码
+	MessageIdsKey  = attribute.Key("messaging.alibaba_mns.message_ids")  // 批量操作成功的消息的 MessageId
+	FailedCountKey = attribute.Key("messaging.alibaba_mns.failed_count") // 批量操作中失败的消息数
+	BatchSizeKey   = attribute.Key("messaging.batch.message_count")      // 批量操作的消息数
+
+	VisibilityTimeoutKey = attribute.Key("messaging.alibaba_mns.visibility_timeout") // ChangeMessageVisibility 的 visibilityTimeout
+)
+
+type Config struct {
+	// following is optional
+	TracerProvider trace.TracerProvider // 默认为 otel.GetTracerProvider()
+
+	// EnvelopeEnabled 为 true 时, 发送和发布的消息使用 mns.EncodeEnvelope 的信封格式携带 trace context,
+	// 接收到的信封格式的消息去掉 trace context 相关的 header, receive span 关联到发送消息的 span, 不是信封格式的消息原样返回.
+	// 信封中的其他 header (比如自定义的 header 和 deadletter 的 header) 被保留, 消息仍然是信封格式, 可以用 mns.DecodeEnvelope 读取;
+	// 只有 trace context 相关的 header 时返回原始的消息.
+	EnvelopeEnabled bool
+	Propagator      propagation.TextMapPropagator // 默认为 W3C TraceContext 和 Baggage
+}
+
+type tracer struct {
+	tracer      trace.Tracer
+	destination string
+	attrs       []attribute.KeyValue
+
+	envelopeEnabled bool
+	propagator      propagation.TextMapPropagator
+}
+
+func newTracer(destination string, kind attribute.KeyValue, config *Config) *tracer {
+	if config == nil {
+		config = &Config{}
+	}
+	provider := config.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &tracer{
+		tracer:      provider.Tracer(instrumentationName),
+		destination: destination,
+		attrs: []attribute.KeyValue{
+			semconv.MessagingSystemKey.String(System),
+			semconv.MessagingDestinationKey.String(destination),
+			kind,
+		},
+		envelopeEnabled: config.EnvelopeEnabled,
+		propagator:      propagator(config),
+	}
+}
+
+// start 开始一个名称为 "{destination} {operation}" 的 span.
+func (t *tracer) start(ctx context.Context, operation string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, t.destination+" "+operation,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(t.attrs...),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// startReceive 在接收到消息之后开始 receive span, 开始时间为 startTime, 并且关联到 links.
+func (t *tracer) startReceive(ctx context.Context, startTime time.Time, links []trace.Link, attrs ...attribute.KeyValue) trace.Span {
+	_, span := t.tracer.Start(ctx, t.destination+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(startTime),
+		trace.WithLinks(links...),
+		trace.WithAttributes(t.attrs...),
+		trace.WithAttributes(semconv.MessagingOperationReceive),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+// end 记录 requestId 和 err 并结束 span, allowMessageNotExist 为 true 时 MessageNotExist 不作为错误, 比如队列中没有消息.
+func end(span trace.Span, requestId string, err error, allowMessageNotExist bool) {
+	if v, ok := err.(*mns.Error); ok && v != nil {
+		if requestId == "" {
+			requestId = v.RequestId
+		}
+		span.SetAttributes(ErrorCodeKey.String(v.Code))
+	}
+	if requestId != "" {
+		span.SetAttributes(RequestIdKey.String(requestId))
+	}
+	if err != nil && !(allowMessageNotExist && mns.IsMessageNotExist(err)) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,300 @@
+package otelmns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/deadletter"
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestQueue(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	config := &Config{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+
+	mock := &queue.MockAPI{
+		SendMessageContextFunc: func(ctx context.Context, msg *queue.SendMessageRequest) (requestId string, resp *queue.SendMessageResponse, err error) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				t.Error("the span should be passed to the next queue.API")
+			}
+			return "request-1", &queue.SendMessageResponse{MessageId: "message-1"}, nil
+		},
+		ReceiveMessageContextFunc: func(ctx context.Context, waitSeconds int) (requestId string, msg *queue.Message, err error) {
+			return "", nil, &mns.Error{HttpStatusCode: mns.ErrorHttpStatusCodeMessageNotExist, Code: mns.ErrorCodeMessageNotExist, RequestId: "request-2"}
+		},
+		DeleteMessageContextFunc: func(ctx context.Context, receiptHandle string) (requestId string, err error) {
+			return "", &mns.Error{HttpStatusCode: http.StatusBadRequest, Code: mns.ErrorCodeReceiptHandleError, RequestId: "request-3"}
+		},
+	}
+	q := NewQueue(mock, "test", config)
+	q.SendMessageContext(context.Background(), &queue.SendMessageRequest{MessageBody: []byte("body")})
+	q.ReceiveMessageContext(context.Background(), 0)
+	q.DeleteMessageContext(context.Background(), "handle")
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Errorf("have:%d, want:%d", len(spans), 3)
+		return
+	}
+
+	send := spans[0]
+	attrs := attributes(send)
+	if send.Name() != "test send" || send.SpanKind() != trace.SpanKindProducer || send.Status().Code == codes.Error {
+		t.Errorf("unexpected span: %s/%v/%v", send.Name(), send.SpanKind(), send.Status())
+		return
+	}
+	for k, want := range map[attribute.Key]string{
+		"messaging.system":                 System,
+		"messaging.destination":            "test",
+		"messaging.destination_kind":       "queue",
+		"messaging.message_id":             "message-1",
+		"messaging.alibaba_mns.request_id": "request-1",
+	} {
+		if have := attrs[k].AsString(); have != want {
+			t.Errorf("%s have:%q, want:%q", k, have, want)
+		}
+	}
+
+	// 队列中没有消息不是错误
+	receive := spans[1]
+	attrs = attributes(receive)
+	if receive.Status().Code == codes.Error || attrs[ErrorCodeKey].AsString() != mns.ErrorCodeMessageNotExist || attrs[RequestIdKey].AsString() != "request-2" {
+		t.Errorf("unexpected span: %v/%v", receive.Status(), attrs)
+		return
+	}
+
+	del := spans[2]
+	attrs = attributes(del)
+	if del.Status().Code != codes.Error || attrs[ErrorCodeKey].AsString() != mns.ErrorCodeReceiptHandleError || attrs[RequestIdKey].AsString() != "request-3" {
+		t.Errorf("unexpected span: %v/%v", del.Status(), attrs)
+		return
+	}
+}
+
+func TestTopic(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	config := &Config{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+
+	mock := &topic.MockAPI{
+		PublishMessageContextFunc: func(ctx context.Context, msg *topic.PublishMessageRequest) (requestId string, resp *topic.PublishMessageResponse, err error) {
+			return "request-id", &topic.PublishMessageResponse{MessageId: "message-id"}, nil
+		},
+		DeleteTopicContextFunc: func(ctx context.Context) (requestId string, err error) {
+			return "request-id", nil
+		},
+	}
+	tp := NewTopic(mock, "test", config)
+	tp.PublishMessageContext(context.Background(), &topic.PublishMessageRequest{MessageBody: []byte("body")})
+	tp.DeleteTopicContext(context.Background())
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Errorf("have:%d, want:%d", len(spans), 1)
+		return
+	}
+	attrs := attributes(spans[0])
+	if spans[0].Name() != "test publish" || attrs["messaging.destination_kind"].AsString() != "topic" || attrs["messaging.message_id"].AsString() != "message-id" {
+		t.Errorf("unexpected span: %s/%v", spans[0].Name(), attrs)
+		return
+	}
+	if n := len(mock.Calls()); n != 2 {
+		t.Errorf("have:%d, want:%d", n, 2)
+		return
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	config := &Config{
+		TracerProvider:  sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		EnvelopeEnabled: true,
+	}
+
+	var bodies [][]byte
+	mock := &queue.MockAPI{
+		SendMessageContextFunc: func(ctx context.Context, msg *queue.SendMessageRequest) (requestId string, resp *queue.SendMessageResponse, err error) {
+			bodies = append(bodies, msg.MessageBody)
+			return "", &queue.SendMessageResponse{MessageId: "message-id"}, nil
+		},
+		BatchReceiveMessageContextFunc: func(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []queue.Message, err error) {
+			for _, body := range bodies {
+				msgs = append(msgs, queue.Message{MessageId: "message-id", MessageBody: body})
+			}
+			return "", msgs, nil
+		},
+	}
+	q := NewQueue(mock, "test", config)
+
+	msg := &queue.SendMessageRequest{MessageBody: []byte("hello")}
+	if _, _, err := q.SendMessageContext(context.Background(), msg); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msg.MessageBody) != "hello" {
+		t.Errorf("the caller's message should not be modified: %q", msg.MessageBody)
+		return
+	}
+	header, payload, ok := mns.DecodeEnvelope(bodies[0])
+	if !ok || header["traceparent"] == "" || string(payload) != "hello" {
+		t.Errorf("unexpected body: %q", bodies[0])
+		return
+	}
+
+	// 自定义的 header 保留
+	custom := mns.EncodeEnvelope(map[string]string{"x-custom": "value"}, []byte("custom"))
+	if _, _, err := q.SendMessageContext(context.Background(), &queue.SendMessageRequest{MessageBody: custom}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if header, payload, _ := mns.DecodeEnvelope(bodies[1]); header["x-custom"] != "value" || header["traceparent"] == "" || string(payload) != "custom" {
+		t.Errorf("unexpected body: %q", bodies[1])
+		return
+	}
+
+	// 只去掉 trace context 相关的 header, 自定义的 header 保留; 不是信封格式的消息原样返回
+	bodies = append(bodies, []byte("plain"))
+	_, msgs, err := q.BatchReceiveMessageContext(context.Background(), 16, 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(msgs) != 3 || string(msgs[0].MessageBody) != "hello" || string(msgs[1].MessageBody) != string(custom) || string(msgs[2].MessageBody) != "plain" {
+		t.Errorf("unexpected messages: %+v", msgs)
+		return
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Errorf("have:%d, want:%d", len(spans), 3)
+		return
+	}
+	links := spans[2].Links()
+	if len(links) != 2 || links[0].SpanContext.SpanID() != spans[0].SpanContext().SpanID() || links[1].SpanContext.SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("the receive span should link to the send spans: %+v", links)
+		return
+	}
+
+	// Extract 返回发送方的 trace context
+	ctx, payload := Extract(context.Background(), bodies[0], nil)
+	if string(payload) != "hello" || trace.SpanContextFromContext(ctx).TraceID() != spans[0].SpanContext().TraceID() {
+		t.Errorf("unexpected extract result: %q", payload)
+		return
+	}
+}
+
+// 死信队列也使用 NewQueue 时, 死信的 header 要保留, deadletter.Decode 和 deadletter.Replay 可以正常工作.
+func TestEnvelopeDeadLetter(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("orders", nil)
+	s.CreateQueue("orders-dlq", nil)
+
+	recorder := tracetest.NewSpanRecorder()
+	config := &Config{
+		TracerProvider:  sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		EnvelopeEnabled: true,
+	}
+	orders := NewQueue(queue.New(s.URL, "orders", s.Config()), "orders", config)
+	dlq := NewQueue(queue.New(s.URL, "orders-dlq", s.Config()), "orders-dlq", config)
+
+	if _, _, err := orders.SendMessageContext(context.Background(), &queue.SendMessageRequest{MessageBody: []byte("hello")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	_, msg, err := orders.ReceiveMessageContext(context.Background(), 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msg.MessageBody) != "hello" {
+		t.Errorf("have:%q, want:%q", msg.MessageBody, "hello")
+		return
+	}
+	if err = deadletter.New(orders, "orders", dlq, nil).Move(context.Background(), msg, errors.New("poison")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, peeked, err := dlq.PeekMessageContext(context.Background())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if header, _, _ := mns.DecodeEnvelope(peeked.MessageBody); header["traceparent"] == "" {
+		t.Errorf("the dead letter should carry the trace context: %q", peeked.MessageBody)
+		return
+	}
+	_, msg, err = dlq.ReceiveMessageContext(context.Background(), 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	header, _, _ := mns.DecodeEnvelope(msg.MessageBody)
+	if _, ok := header["traceparent"]; ok {
+		t.Errorf("the trace context should be removed: %q", msg.MessageBody)
+		return
+	}
+	dl, ok := deadletter.Decode(msg.MessageBody)
+	if !ok {
+		t.Errorf("not a dead letter: %q", msg.MessageBody)
+		return
+	}
+	if dl.SourceQueue != "orders" || dl.Error != "poison" || string(dl.Body) != "hello" {
+		t.Errorf("unexpected dead letter: %+v", dl)
+		return
+	}
+	s.Advance(time.Hour) // 死信重新可见
+	replayed, err := deadletter.Replay(context.Background(), dlq, func(string) queue.API { return orders }, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if replayed != 1 {
+		t.Errorf("have:%d, want:%d", replayed, 1)
+		return
+	}
+	_, msg, err = orders.ReceiveMessageContext(context.Background(), 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msg.MessageBody) != "hello" {
+		t.Errorf("have:%q, want:%q", msg.MessageBody, "hello")
+		return
+	}
+}
+
+// msg 为 nil 时不 panic, 返回被包装的 API 的错误.
+func TestNilMessage(t *testing.T) {
+	config := &Config{EnvelopeEnabled: true}
+	q := NewQueue(queue.New("http://127.0.0.1", "test", mns.Config{}), "test", config)
+	if _, _, err := q.SendMessageContext(context.Background(), nil); err == nil {
+		t.Error("the error should not be nil")
+		return
+	}
+	tp := NewTopic(topic.New("http://127.0.0.1", "test", mns.Config{}), "test", config)
+	if _, _, err := tp.PublishMessageContext(context.Background(), nil); err == nil {
+		t.Error("the error should not be nil")
+		return
+	}
+}
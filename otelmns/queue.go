@@ -0,0 +1,182 @@
+package otelmns
+
+import (
+	"context"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+type tracedQueue struct {
+	queue.Decorator
+	tracer *tracer
+}
+
+// NewQueue 返回为 q 的每个消息操作创建 span 的 queue.API, queueName 是 q 的队列名称, config 可以为 nil.
+func NewQueue(q queue.API, queueName string, config *Config) queue.API {
+	return &tracedQueue{
+		Decorator: queue.Decorator{Next: q},
+		tracer:    newTracer(queueName, semconv.MessagingDestinationKindQueue, config),
+	}
+}
+
+func (q *tracedQueue) SendMessageContext(ctx context.Context, msg *queue.SendMessageRequest) (requestId string, resp *queue.SendMessageResponse, err error) {
+	ctx, span := q.tracer.start(ctx, "send", trace.SpanKindProducer)
+	if msg != nil { // msg 为 nil 时由 q.Next 返回错误
+		span.SetAttributes(semconv.MessagingMessagePayloadSizeBytesKey.Int(len(msg.MessageBody)))
+		if q.tracer.envelopeEnabled {
+			m := *msg // 不修改调用方的 msg
+			m.MessageBody = inject(ctx, q.tracer.propagator, m.MessageBody)
+			msg = &m
+		}
+	}
+	requestId, resp, err = q.Next.SendMessageContext(ctx, msg)
+	if resp != nil {
+		span.SetAttributes(semconv.MessagingMessageIDKey.String(resp.MessageId))
+	}
+	end(span, requestId, err, false)
+	return
+}
+
+func (q *tracedQueue) BatchSendMessageContext(ctx context.Context, msgs []queue.SendMessageRequest) (requestId string, resp []queue.BatchSendMessageResponseItem, err error) {
+	ctx, span := q.tracer.start(ctx, "send", trace.SpanKindProducer, BatchSizeKey.Int(len(msgs)))
+	requestId, resp, err = q.Next.BatchSendMessageContext(ctx, q.wrap(ctx, msgs))
+	setBatchSendAttributes(span, resp)
+	end(span, requestId, err, false)
+	return
+}
+
+func (q *tracedQueue) BatchSendMessageAllContext(ctx context.Context, msgs []queue.SendMessageRequest, opts *queue.BatchOptions) (resp []queue.BatchSendMessageResponseItem, err error) {
+	ctx, span := q.tracer.start(ctx, "send", trace.SpanKindProducer, BatchSizeKey.Int(len(msgs)))
+	resp, err = q.Next.BatchSendMessageAllContext(ctx, q.wrap(ctx, msgs), opts)
+	setBatchSendAttributes(span, resp)
+	end(span, "", err, false)
+	return
+}
+
+// wrap 返回把 trace context 写入信封之后的 msgs 的副本, 没有开启 EnvelopeEnabled 时返回 msgs.
+func (q *tracedQueue) wrap(ctx context.Context, msgs []queue.SendMessageRequest) []queue.SendMessageRequest {
+	if !q.tracer.envelopeEnabled {
+		return msgs
+	}
+	wrapped := make([]queue.SendMessageRequest, len(msgs))
+	for i := range msgs {
+		wrapped[i] = msgs[i]
+		wrapped[i].MessageBody = inject(ctx, q.tracer.propagator, msgs[i].MessageBody)
+	}
+	return wrapped
+}
+
+func setBatchSendAttributes(span trace.Span, items []queue.BatchSendMessageResponseItem) {
+	if len(items) == 0 {
+		return
+	}
+	messageIds := make([]string, 0, len(items))
+	for i := range items {
+		if items[i].MessageId != "" {
+			messageIds = append(messageIds, items[i].MessageId)
+		}
+	}
+	span.SetAttributes(MessageIdsKey.StringSlice(messageIds))
+	if failed := len(items) - len(messageIds); failed > 0 {
+		span.SetAttributes(FailedCountKey.Int(failed))
+	}
+}
+
+// ReceiveMessageContext 的 receive span 在接收到消息之后创建, 以便关联到发送消息的 span, 开始时间为调用的时间.
+func (q *tracedQueue) ReceiveMessageContext(ctx context.Context, waitSeconds int) (requestId string, msg *queue.Message, err error) {
+	startTime := time.Now()
+	requestId, msg, err = q.Next.ReceiveMessageContext(ctx, waitSeconds)
+	if msg == nil {
+		end(q.tracer.startReceive(ctx, startTime, nil), requestId, err, true)
+		return
+	}
+	var links []trace.Link
+	payload, link, ok := q.tracer.unwrap(ctx, msg.MessageBody)
+	msg.MessageBody = payload
+	if ok {
+		links = append(links, link)
+	}
+	span := q.tracer.startReceive(ctx, startTime, links,
+		semconv.MessagingMessageIDKey.String(msg.MessageId),
+		semconv.MessagingMessagePayloadSizeBytesKey.Int(len(msg.MessageBody)),
+	)
+	end(span, requestId, err, true)
+	return
+}
+
+// BatchReceiveMessageContext 的 receive span 关联到每一条消息的发送消息的 span, 见 ReceiveMessageContext.
+func (q *tracedQueue) BatchReceiveMessageContext(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []queue.Message, err error) {
+	startTime := time.Now()
+	requestId, msgs, err = q.Next.BatchReceiveMessageContext(ctx, numOfMessages, waitSeconds)
+	var links []trace.Link
+	messageIds := make([]string, len(msgs))
+	for i := range msgs {
+		messageIds[i] = msgs[i].MessageId
+		payload, link, ok := q.tracer.unwrap(ctx, msgs[i].MessageBody)
+		msgs[i].MessageBody = payload
+		if ok {
+			links = append(links, link)
+		}
+	}
+	span := q.tracer.startReceive(ctx, startTime, links, BatchSizeKey.Int(len(msgs)), MessageIdsKey.StringSlice(messageIds))
+	end(span, requestId, err, true)
+	return
+}
+
+func (q *tracedQueue) PeekMessageContext(ctx context.Context) (requestId string, msg *queue.PeekMessageResponse, err error) {
+	ctx, span := q.tracer.start(ctx, "peek", trace.SpanKindClient)
+	requestId, msg, err = q.Next.PeekMessageContext(ctx)
+	if msg != nil {
+		span.SetAttributes(semconv.MessagingMessageIDKey.String(msg.MessageId))
+	}
+	end(span, requestId, err, true)
+	return
+}
+
+func (q *tracedQueue) BatchPeekMessageContext(ctx context.Context, numOfMessages int) (requestId string, msgs []queue.PeekMessageResponse, err error) {
+	ctx, span := q.tracer.start(ctx, "peek", trace.SpanKindClient)
+	requestId, msgs, err = q.Next.BatchPeekMessageContext(ctx, numOfMessages)
+	span.SetAttributes(BatchSizeKey.Int(len(msgs)))
+	end(span, requestId, err, true)
+	return
+}
+
+func (q *tracedQueue) DeleteMessageContext(ctx context.Context, receiptHandle string) (requestId string, err error) {
+	ctx, span := q.tracer.start(ctx, "delete", trace.SpanKindClient)
+	requestId, err = q.Next.DeleteMessageContext(ctx, receiptHandle)
+	end(span, requestId, err, false)
+	return
+}
+
+func (q *tracedQueue) BatchDeleteMessageContext(ctx context.Context, receiptHandles []string) (requestId string, _errors []queue.BatchDeleteMessageErrorItem, err error) {
+	ctx, span := q.tracer.start(ctx, "delete", trace.SpanKindClient, BatchSizeKey.Int(len(receiptHandles)))
+	requestId, _errors, err = q.Next.BatchDeleteMessageContext(ctx, receiptHandles)
+	setFailedCount(span, len(_errors))
+	end(span, requestId, err, false)
+	return
+}
+
+func (q *tracedQueue) BatchDeleteMessageAllContext(ctx context.Context, receiptHandles []string, opts *queue.BatchOptions) (_errors []queue.BatchDeleteMessageErrorItem, err error) {
+	ctx, span := q.tracer.start(ctx, "delete", trace.SpanKindClient, BatchSizeKey.Int(len(receiptHandles)))
+	_errors, err = q.Next.BatchDeleteMessageAllContext(ctx, receiptHandles, opts)
+	setFailedCount(span, len(_errors))
+	end(span, "", err, false)
+	return
+}
+
+func setFailedCount(span trace.Span, failed int) {
+	if failed > 0 {
+		span.SetAttributes(FailedCountKey.Int(failed))
+	}
+}
+
+func (q *tracedQueue) ChangeMessageVisibilityContext(ctx context.Context, receiptHandle string, visibilityTimeout int) (requestId string, resp *queue.ChangeMessageVisibilityResponse, err error) {
+	ctx, span := q.tracer.start(ctx, "change_visibility", trace.SpanKindClient, VisibilityTimeoutKey.Int(visibilityTimeout))
+	requestId, resp, err = q.Next.ChangeMessageVisibilityContext(ctx, receiptHandle, visibilityTimeout)
+	end(span, requestId, err, false)
+	return
+}
@@ -0,0 +1,41 @@
+package otelmns
+
+import (
+	"context"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+type tracedTopic struct {
+	topic.Decorator
+	tracer *tracer
+}
+
+// NewTopic 返回为 t 的 PublishMessage 创建 span 的 topic.API, 其他方法直接转发给 t, topicName 是 t 的主题名称, config 可以为 nil.
+func NewTopic(t topic.API, topicName string, config *Config) topic.API {
+	return &tracedTopic{
+		Decorator: topic.Decorator{Next: t},
+		tracer:    newTracer(topicName, semconv.MessagingDestinationKindTopic, config),
+	}
+}
+
+func (t *tracedTopic) PublishMessageContext(ctx context.Context, msg *topic.PublishMessageRequest) (requestId string, resp *topic.PublishMessageResponse, err error) {
+	ctx, span := t.tracer.start(ctx, "publish", trace.SpanKindProducer)
+	if msg != nil { // msg 为 nil 时由 t.Next 返回错误
+		span.SetAttributes(semconv.MessagingMessagePayloadSizeBytesKey.Int(len(msg.MessageBody)))
+		if t.tracer.envelopeEnabled {
+			m := *msg // 不修改调用方的 msg
+			m.MessageBody = inject(ctx, t.tracer.propagator, m.MessageBody)
+			msg = &m
+		}
+	}
+	requestId, resp, err = t.Next.PublishMessageContext(ctx, msg)
+	if resp != nil {
+		span.SetAttributes(semconv.MessagingMessageIDKey.String(resp.MessageId))
+	}
+	end(span, requestId, err, false)
+	return
+}
@@ -0,0 +1,210 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+// ErrProducerClosed 表示 Producer 已经被关闭.
+var ErrProducerClosed = errors.New("the producer has been closed")
+
+type Config struct {
+	// following is optional
+	MaxBatchCount int           // 每次 BatchSendMessage 的最大消息个数, 1-16, 默认为 16
+	MaxBatchBytes int           // 每次 BatchSendMessage 的消息的最大总字节数, 按照 queue.EstimateMessageSize 计算, 默认为 64KB
+	Linger        time.Duration // 消息等待凑成一批的最长时间, 默认为 10ms
+	MaxPending    int           // 还没有发送完成的消息的最大个数, 超过之后 Send 会阻塞, 默认为 1024
+}
+
+// Producer 把单条发送的消息合并成 BatchSendMessage 请求, 减少 HTTP 请求的次数.
+//
+// 一批消息在达到 MaxBatchCount 条, 或者再加入一条会超过 MaxBatchBytes, 或者等待了 Linger 之后发送.
+type Producer struct {
+	queue  queue.API
+	config Config
+
+	pending chan struct{} // 信号量, 限制还没有发送完成的消息个数
+	flushes sync.WaitGroup
+
+	mu         sync.Mutex
+	closed     bool
+	batch      []*Future
+	batchBytes int
+	generation int // 每次发送之后加 1, 用于判断 Linger 定时器对应的是否是当前的一批
+}
+
+// New 创建一个新的 Producer, q 可以是 *queue.Queue 或者 queue.Decorator 等任意的 queue.API, config 可以为 nil.
+// 消息的大小和 queue.Queue.BatchSendMessageAll 拆分批次时相同, 见 queue.EstimateMessageSize.
+func New(q queue.API, config *Config) *Producer {
+	p := &Producer{
+		queue: q,
+	}
+	if config != nil {
+		p.config = *config
+	}
+	if p.config.MaxBatchCount < 1 || p.config.MaxBatchCount > queue.MaxBatchMessageCount {
+		p.config.MaxBatchCount = queue.MaxBatchMessageCount
+	}
+	if p.config.MaxBatchBytes <= 0 || p.config.MaxBatchBytes > queue.MaxBatchMessageBytes {
+		p.config.MaxBatchBytes = queue.MaxBatchMessageBytes
+	}
+	if p.config.Linger <= 0 {
+		p.config.Linger = 10 * time.Millisecond
+	}
+	if p.config.MaxPending <= 0 {
+		p.config.MaxPending = 1024
+	}
+	p.pending = make(chan struct{}, p.config.MaxPending)
+	return p
+}
+
+// Future 表示一条异步发送的消息的结果.
+type Future struct {
+	msg  queue.SendMessageRequest
+	size int
+
+	done chan struct{}
+	resp *queue.SendMessageResponse
+	err  error
+}
+
+// Done 返回的 channel 在消息发送完成 (成功或者失败) 后被关闭.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待消息发送完成, 返回发送的结果; ctx 被取消时返回 ctx.Err(), 但是消息仍然会被发送.
+func (f *Future) Wait(ctx context.Context) (resp *queue.SendMessageResponse, err error) {
+	select {
+	case <-f.done:
+		return f.resp, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send 把 msg 加入到待发送的批次中, 返回的 Future 用于获取发送的结果.
+//
+// 还没有发送完成的消息达到 MaxPending 时, Send 会阻塞直到有消息发送完成或者 ctx 被取消.
+func (p *Producer) Send(ctx context.Context, msg *queue.SendMessageRequest) (*Future, error) {
+	if msg == nil || len(msg.MessageBody) == 0 {
+		return nil, errors.New("the MessageBody must not be empty")
+	}
+	f := &Future{
+		msg:  *msg,
+		size: queue.EstimateMessageSize(p.queue, msg),
+		done: make(chan struct{}),
+	}
+
+	select {
+	case p.pending <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.pending
+		return nil, ErrProducerClosed
+	}
+	if len(p.batch) > 0 && p.batchBytes+f.size > p.config.MaxBatchBytes {
+		p.flushLocked()
+	}
+	p.batch = append(p.batch, f)
+	p.batchBytes += f.size
+	switch {
+	case len(p.batch) >= p.config.MaxBatchCount || p.batchBytes >= p.config.MaxBatchBytes:
+		p.flushLocked()
+	case len(p.batch) == 1:
+		generation := p.generation
+		time.AfterFunc(p.config.Linger, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.generation == generation && len(p.batch) > 0 {
+				p.flushLocked()
+			}
+		})
+	}
+	return f, nil
+}
+
+// SendMessageContext 发送 msg 并等待发送完成, 和 queue.Queue.SendMessageContext 的区别是会和其他消息合并发送.
+func (p *Producer) SendMessageContext(ctx context.Context, msg *queue.SendMessageRequest) (resp *queue.SendMessageResponse, err error) {
+	f, err := p.Send(ctx, msg)
+	if err != nil {
+		return
+	}
+	return f.Wait(ctx)
+}
+
+// Close 发送所有待发送的消息并等待发送完成, 之后的 Send 返回 ErrProducerClosed.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		if len(p.batch) > 0 {
+			p.flushLocked()
+		}
+	}
+	p.mu.Unlock()
+
+	p.flushes.Wait()
+	return nil
+}
+
+// flushLocked 异步发送当前的一批消息, 调用方必须持有 p.mu.
+func (p *Producer) flushLocked() {
+	batch := p.batch
+	p.batch = nil
+	p.batchBytes = 0
+	p.generation++
+
+	p.flushes.Add(1)
+	go func() {
+		defer p.flushes.Done()
+		p.send(batch)
+	}()
+}
+
+func (p *Producer) send(batch []*Future) {
+	defer func() {
+		for _, f := range batch {
+			close(f.done)
+			<-p.pending
+		}
+	}()
+
+	msgs := make([]queue.SendMessageRequest, len(batch))
+	for i, f := range batch {
+		msgs[i] = f.msg
+	}
+	requestId, items, err := p.queue.BatchSendMessageContext(context.Background(), msgs)
+	if err != nil {
+		for _, f := range batch {
+			f.err = err
+		}
+		return
+	}
+	for i, f := range batch {
+		item := &items[i]
+		if item.ErrorCode != "" {
+			f.err = &mns.Error{
+				Code:      item.ErrorCode,
+				Message:   item.ErrorMessage,
+				RequestId: requestId,
+			}
+			continue
+		}
+		f.resp = &queue.SendMessageResponse{
+			MessageId:      item.MessageId,
+			MessageBodyMD5: item.MessageBodyMD5,
+			ReceiptHandle:  item.ReceiptHandle,
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package producer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+// testBatchServer 记录每次 BatchSendMessage 的消息个数, 消息体以 "fail" 开头的消息返回失败.
+type testBatchServer struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (s *testBatchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		Messages []queue.SendMessageRequest `xml:"Message"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.batches = append(s.batches, len(req.Messages))
+	s.mu.Unlock()
+
+	var failed bool
+	for _, msg := range req.Messages {
+		failed = failed || strings.HasPrefix(string(msg.MessageBody), "fail")
+	}
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	fmt.Fprint(w, "<Messages>")
+	for _, msg := range req.Messages {
+		if strings.HasPrefix(string(msg.MessageBody), "fail") {
+			fmt.Fprint(w, "<Message><ErrorCode>InternalError</ErrorCode><ErrorMessage>internal error</ErrorMessage></Message>")
+			continue
+		}
+		fmt.Fprintf(w, "<Message><MessageId>id-%s</MessageId><MessageBodyMD5>%s</MessageBodyMD5></Message>", msg.MessageBody, internal.MessageBodyMD5(msg.MessageBody))
+	}
+	fmt.Fprint(w, "</Messages>")
+}
+
+func TestProducer(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	p := New(q, &Config{Linger: time.Hour})
+
+	futures := make([]*Future, 40)
+	for i := range futures {
+		body := fmt.Sprintf("msg%d", i)
+		if i == 7 {
+			body = "fail"
+		}
+		f, err := p.Send(context.Background(), &queue.SendMessageRequest{MessageBody: []byte(body)})
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		futures[i] = f
+	}
+	if err := p.Close(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for i, f := range futures {
+		resp, err := f.Wait(context.Background())
+		if i == 7 {
+			if v, ok := err.(*mns.Error); !ok || v.Code != "InternalError" {
+				t.Errorf("want InternalError, have:%v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err.Error())
+			continue
+		}
+		if want := fmt.Sprintf("id-msg%d", i); resp.MessageId != want {
+			t.Errorf("have:%s, want:%s", resp.MessageId, want)
+		}
+	}
+	sort.Ints(s.batches) // 批次是并发发送的
+	if have, want := fmt.Sprint(s.batches), "[8 16 16]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+
+	if _, err := p.Send(context.Background(), &queue.SendMessageRequest{MessageBody: []byte("closed")}); err != ErrProducerClosed {
+		t.Errorf("have:%v, want:%v", err, ErrProducerClosed)
+		return
+	}
+}
+
+func TestProducerLingerAndBytes(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	// 两条消息凑满一批
+	maxBatchBytes := 2 * q.MessageSize(&queue.SendMessageRequest{MessageBody: []byte("aaaa")})
+	p := New(q, &Config{MaxBatchBytes: maxBatchBytes, Linger: 10 * time.Millisecond})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for _, body := range []string{"aaaa", "bbbb", "cccc"} {
+		f, err := p.Send(context.Background(), &queue.SendMessageRequest{MessageBody: []byte(body)})
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Wait(context.Background()); err != nil {
+				t.Error(err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	sort.Ints(s.batches)
+	if have, want := fmt.Sprint(s.batches), "[1 2]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		s.mu.Unlock()
+		return
+	}
+	s.batches = nil
+	s.mu.Unlock()
+
+	// 不是 *queue.Queue 时按照 Base64 编码之后的大小计算, 每条消息单独一批
+	p2 := New(queue.Decorator{Next: q}, &Config{MaxBatchBytes: maxBatchBytes, Linger: 10 * time.Millisecond})
+	defer p2.Close()
+	var futures []*Future
+	for _, body := range []string{"aaaa", "bbbb", "cccc"} {
+		f, err := p2.Send(context.Background(), &queue.SendMessageRequest{MessageBody: []byte(body)})
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		if _, err := f.Wait(context.Background()); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if have, want := fmt.Sprint(s.batches), "[1 1 1]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+func TestProducerBackpressure(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := queue.New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	p := New(q, &Config{Linger: time.Hour, MaxPending: 1})
+	defer p.Close()
+
+	if _, err := p.Send(context.Background(), &queue.SendMessageRequest{MessageBody: []byte("a")}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Send(ctx, &queue.SendMessageRequest{MessageBody: []byte("b")}); err != context.DeadlineExceeded {
+		t.Errorf("have:%v, want:%v", err, context.DeadlineExceeded)
+		return
+	}
+}
@@ -0,0 +1,193 @@
+package prommns
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/client"
+)
+
+type BacklogConfig struct {
+	QueueNames []string // 需要导出的队列
+	Prefix     string   // 导出名称以 Prefix 开头的队列, 每次轮询都会重新列出队列; QueueNames 和 Prefix 都为空时导出所有的队列
+
+	// following is optional
+	Interval    time.Duration     // 轮询的间隔, 默认为 1 分钟
+	Namespace   string            // 指标名称的前缀, 默认为 mns
+	ConstLabels prometheus.Labels // 所有指标都带有的 label
+}
+
+// BacklogExporter 定期调用 GetQueueAttributes, 把队列中的消息数导出为 Prometheus 的 gauge, 用于队列积压的告警.
+//
+//  exporter := prommns.NewBacklogExporter(client.New(endpoint, config), &prommns.BacklogConfig{Prefix: "order-"})
+//  go exporter.Run(ctx)
+//  http.Handle("/metrics", exporter.Handler())
+type BacklogExporter struct {
+	client   *client.Client
+	names    []string
+	prefix   string
+	interval time.Duration
+
+	activeMessages   *prometheus.Desc
+	inactiveMessages *prometheus.Desc
+	delayMessages    *prometheus.Desc
+	lastModifyTime   *prometheus.Desc
+	lastPollTime     *prometheus.Desc
+	pollErrors       prometheus.Counter
+
+	mu         sync.Mutex
+	queues     map[string]*client.GetQueueAttributesResponse
+	lastPolled time.Time
+}
+
+var _ prometheus.Collector = (*BacklogExporter)(nil)
+
+// NewBacklogExporter 创建 BacklogExporter, config 可以为 nil, 此时导出所有的队列.
+func NewBacklogExporter(c *client.Client, config *BacklogConfig) *BacklogExporter {
+	if config == nil {
+		config = &BacklogConfig{}
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = "mns"
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "queue", name), help, labels, config.ConstLabels)
+	}
+	return &BacklogExporter{
+		client:   c,
+		names:    append([]string(nil), config.QueueNames...),
+		prefix:   config.Prefix,
+		interval: interval,
+
+		activeMessages:   desc("active_messages", "Approximate number of active messages in the queue.", "queue"),
+		inactiveMessages: desc("inactive_messages", "Approximate number of inactive (received but not deleted) messages in the queue.", "queue"),
+		delayMessages:    desc("delay_messages", "Approximate number of delayed messages in the queue.", "queue"),
+		lastModifyTime:   desc("last_modify_time_seconds", "Time the queue attributes were last modified, in unix seconds.", "queue"),
+		lastPollTime:     desc("backlog_last_poll_time_seconds", "Time of the last successful poll, in unix seconds."),
+		pollErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "queue",
+			Name:        "backlog_poll_errors_total",
+			Help:        "Total number of errors while listing queues or getting queue attributes.",
+			ConstLabels: config.ConstLabels,
+		}),
+		queues: make(map[string]*client.GetQueueAttributesResponse),
+	}
+}
+
+// Run 立即轮询一次, 之后每隔 Interval 轮询一次, 直到 ctx 结束.
+// 轮询的错误记录在 backlog_poll_errors_total 中, 不会中断 Run.
+func (e *BacklogExporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll 获取一次所有队列的属性, 返回遇到的第一个错误.
+// 获取属性失败的队列保留上一次的值, 不存在的队列不再导出.
+func (e *BacklogExporter) Poll(ctx context.Context) (err error) {
+	names := e.names
+	if len(names) == 0 {
+		if names, err = e.listQueues(ctx); err != nil {
+			e.pollErrors.Inc()
+			return
+		}
+	}
+
+	queues := make(map[string]*client.GetQueueAttributesResponse, len(names))
+	for _, name := range names {
+		_, resp, err2 := e.client.GetQueueAttributesContext(ctx, name)
+		if err2 == nil {
+			queues[name] = resp
+			continue
+		}
+		if mns.IsQueueNotExist(err2) {
+			continue
+		}
+		e.pollErrors.Inc()
+		if err == nil {
+			err = err2
+		}
+		e.mu.Lock()
+		if v, ok := e.queues[name]; ok {
+			queues[name] = v
+		}
+		e.mu.Unlock()
+	}
+
+	e.mu.Lock()
+	e.queues = queues
+	if err == nil {
+		e.lastPolled = time.Now()
+	}
+	e.mu.Unlock()
+	return
+}
+
+func (e *BacklogExporter) listQueues(ctx context.Context) (names []string, err error) {
+	it := e.client.NewQueueIterator(e.prefix, 0)
+	for it.Next(ctx) {
+		names = append(names, path.Base(it.Queue().QueueURL))
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (e *BacklogExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.activeMessages
+	ch <- e.inactiveMessages
+	ch <- e.delayMessages
+	ch <- e.lastModifyTime
+	ch <- e.lastPollTime
+	e.pollErrors.Describe(ch)
+}
+
+func (e *BacklogExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.queues))
+	for name := range e.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := e.queues[name]
+		ch <- prometheus.MustNewConstMetric(e.activeMessages, prometheus.GaugeValue, float64(v.ActiveMessages), name)
+		ch <- prometheus.MustNewConstMetric(e.inactiveMessages, prometheus.GaugeValue, float64(v.InactiveMessages), name)
+		ch <- prometheus.MustNewConstMetric(e.delayMessages, prometheus.GaugeValue, float64(v.DelayMessages), name)
+		ch <- prometheus.MustNewConstMetric(e.lastModifyTime, prometheus.GaugeValue, float64(v.LastModifyTime), name)
+	}
+	if !e.lastPolled.IsZero() {
+		ch <- prometheus.MustNewConstMetric(e.lastPollTime, prometheus.GaugeValue, float64(e.lastPolled.UnixNano())/1e9)
+	}
+	e.mu.Unlock()
+	e.pollErrors.Collect(ch)
+}
+
+// Handler 返回只导出 e 的指标的 http.Handler, 需要同时导出其他指标时把 e 注册到自己的 prometheus.Registry.
+func (e *BacklogExporter) Handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
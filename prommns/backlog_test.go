@@ -0,0 +1,83 @@
+package prommns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/client"
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+	"github.com/chanxuehong/mns.aliyun.v20150606/queue"
+)
+
+func TestBacklogExporter(t *testing.T) {
+	srv := mnstest.NewServer(nil)
+	defer srv.Close()
+	c := client.New(srv.URL, srv.Config())
+	for _, name := range []string{"order-a", "order-b", "other"} {
+		if _, err := c.CreateQueue(name, nil); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+	q := c.Queue("order-a")
+	for i := 0; i < 3; i++ {
+		if _, _, err := q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body")}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+	if _, _, err := q.SendMessage(&queue.SendMessageRequest{MessageBody: []byte("body"), DelaySeconds: 60}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, _, err := q.ReceiveMessage(0); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	e := NewBacklogExporter(c, &BacklogConfig{Prefix: "order-"})
+	if err := e.Poll(context.Background()); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	want := `
+# HELP mns_queue_active_messages Approximate number of active messages in the queue.
+# TYPE mns_queue_active_messages gauge
+mns_queue_active_messages{queue="order-a"} 2
+mns_queue_active_messages{queue="order-b"} 0
+# HELP mns_queue_delay_messages Approximate number of delayed messages in the queue.
+# TYPE mns_queue_delay_messages gauge
+mns_queue_delay_messages{queue="order-a"} 1
+mns_queue_delay_messages{queue="order-b"} 0
+# HELP mns_queue_inactive_messages Approximate number of inactive (received but not deleted) messages in the queue.
+# TYPE mns_queue_inactive_messages gauge
+mns_queue_inactive_messages{queue="order-a"} 1
+mns_queue_inactive_messages{queue="order-b"} 0
+# HELP mns_queue_backlog_poll_errors_total Total number of errors while listing queues or getting queue attributes.
+# TYPE mns_queue_backlog_poll_errors_total counter
+mns_queue_backlog_poll_errors_total 0
+`
+	names := []string{"mns_queue_active_messages", "mns_queue_inactive_messages", "mns_queue_delay_messages", "mns_queue_backlog_poll_errors_total"}
+	if err := testutil.CollectAndCompare(e, strings.NewReader(want), names...); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 删除的队列不再导出
+	if _, err := c.DeleteQueue("order-b"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	e = NewBacklogExporter(c, &BacklogConfig{QueueNames: []string{"order-a", "order-b"}})
+	if err := e.Poll(context.Background()); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, want := testutil.CollectAndCount(e, "mns_queue_active_messages"), 1; have != want {
+		t.Errorf("have:%d, want:%d", have, want)
+		return
+	}
+}
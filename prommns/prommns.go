@@ -0,0 +1,125 @@
+// Package prommns 把 MNS 客户端的请求指标导出到 Prometheus.
+//
+//  collector := prommns.NewCollector(nil)
+//  prometheus.MustRegister(collector)
+//  config := &mns.Config{..., Metrics: collector}
+//
+// 所有的指标都有 operation, queue, topic 三个 label, queue 和 topic 不相关时为空.
+package prommns
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+type Config struct {
+	// following is optional
+	Namespace   string            // 指标名称的前缀, 默认为 mns
+	Buckets     []float64         // request_duration_seconds 的 bucket, 默认为 prometheus.DefBuckets
+	ConstLabels prometheus.Labels // 所有指标都带有的 label
+}
+
+// Collector 同时实现了 prometheus.Collector 和 mns.MetricsHook.
+type Collector struct {
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	errors        *prometheus.CounterVec
+	retries       *prometheus.CounterVec
+	md5Mismatches *prometheus.CounterVec
+	bytesSent     *prometheus.CounterVec
+	bytesReceived *prometheus.CounterVec
+}
+
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ mns.MetricsHook      = (*Collector)(nil)
+)
+
+var labelNames = []string{"operation", "queue", "topic"}
+
+// NewCollector 创建 Collector, config 可以为 nil.
+func NewCollector(config *Config) *Collector {
+	if config == nil {
+		config = &Config{}
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = "mns"
+	}
+	buckets := config.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	counterVec := func(name, help string, extraLabels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.ConstLabels,
+		}, append(labelNames[:len(labelNames):len(labelNames)], extraLabels...))
+	}
+	return &Collector{
+		requests: counterVec("requests_total", "Total number of HTTP requests sent to MNS, including retries.", "code"),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "request_duration_seconds",
+			Help:        "Duration of HTTP requests sent to MNS, including retries.",
+			ConstLabels: config.ConstLabels,
+			Buckets:     buckets,
+		}, labelNames),
+		errors:        counterVec("errors_total", "Total number of failed HTTP requests, by MNS error code or \"network\".", "error_code"),
+		retries:       counterVec("retries_total", "Total number of retried HTTP requests."),
+		md5Mismatches: counterVec("message_body_md5_mismatches_total", "Total number of messages whose MessageBodyMD5 does not match the body."),
+		bytesSent:     counterVec("sent_bytes_total", "Total bytes of HTTP request bodies."),
+		bytesReceived: counterVec("received_bytes_total", "Total bytes of HTTP response bodies."),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.requests, c.duration, c.errors, c.retries, c.md5Mismatches, c.bytesSent, c.bytesReceived}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range c.collectors() {
+		v.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range c.collectors() {
+		v.Collect(ch)
+	}
+}
+
+// ObserveRequest 实现 mns.MetricsHook.
+func (c *Collector) ObserveRequest(m *mns.RequestMetrics) {
+	code := "0"
+	if m.StatusCode != 0 {
+		code = strconv.Itoa(m.StatusCode)
+	}
+	c.requests.WithLabelValues(m.Operation, m.QueueName, m.TopicName, code).Inc()
+	c.duration.WithLabelValues(m.Operation, m.QueueName, m.TopicName).Observe(m.Duration.Seconds())
+	switch {
+	case m.Err != nil:
+		c.errors.WithLabelValues(m.Operation, m.QueueName, m.TopicName, "network").Inc()
+	case m.StatusCode/100 != 2:
+		errorCode := m.ErrorCode
+		if errorCode == "" {
+			errorCode = "unknown"
+		}
+		c.errors.WithLabelValues(m.Operation, m.QueueName, m.TopicName, errorCode).Inc()
+	}
+	if m.Attempt > 1 {
+		c.retries.WithLabelValues(m.Operation, m.QueueName, m.TopicName).Inc()
+	}
+	c.bytesSent.WithLabelValues(m.Operation, m.QueueName, m.TopicName).Add(float64(m.BytesSent))
+	c.bytesReceived.WithLabelValues(m.Operation, m.QueueName, m.TopicName).Add(float64(m.BytesReceived))
+}
+
+// ObserveMessageBodyMD5Mismatch 实现 mns.MetricsHook.
+func (c *Collector) ObserveMessageBodyMD5Mismatch(operation, queueName, topicName string) {
+	c.md5Mismatches.WithLabelValues(operation, queueName, topicName).Inc()
+}
@@ -0,0 +1,72 @@
+package prommns
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(&Config{Namespace: "test"})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	c.ObserveRequest(&mns.RequestMetrics{Operation: "SendMessage", QueueName: "q", Attempt: 1, Duration: time.Second, Err: errors.New("connection reset"), BytesSent: 10})
+	c.ObserveRequest(&mns.RequestMetrics{Operation: "SendMessage", QueueName: "q", Attempt: 2, Duration: time.Second, StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServiceUnavailable", BytesSent: 10, BytesReceived: 100})
+	c.ObserveRequest(&mns.RequestMetrics{Operation: "SendMessage", QueueName: "q", Attempt: 3, Duration: time.Second, StatusCode: http.StatusCreated, BytesSent: 10, BytesReceived: 50})
+	c.ObserveMessageBodyMD5Mismatch("SendMessage", "q", "")
+
+	tests := []struct {
+		counter prometheus.Collector
+		want    float64
+	}{
+		{c.requests.WithLabelValues("SendMessage", "q", "", "0"), 1},
+		{c.requests.WithLabelValues("SendMessage", "q", "", "503"), 1},
+		{c.requests.WithLabelValues("SendMessage", "q", "", "201"), 1},
+		{c.errors.WithLabelValues("SendMessage", "q", "", "network"), 1},
+		{c.errors.WithLabelValues("SendMessage", "q", "", "ServiceUnavailable"), 1},
+		{c.retries.WithLabelValues("SendMessage", "q", ""), 2},
+		{c.md5Mismatches.WithLabelValues("SendMessage", "q", ""), 1},
+		{c.bytesSent.WithLabelValues("SendMessage", "q", ""), 30},
+		{c.bytesReceived.WithLabelValues("SendMessage", "q", ""), 150},
+	}
+	for i, v := range tests {
+		if have := testutil.ToFloat64(v.counter); have != v.want {
+			t.Errorf("%d: have:%v, want:%v", i, have, v.want)
+			return
+		}
+	}
+
+	want := `
+# HELP test_request_duration_seconds Duration of HTTP requests sent to MNS, including retries.
+# TYPE test_request_duration_seconds histogram
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.005"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.01"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.025"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.05"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.1"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.25"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="0.5"} 0
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="1"} 3
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="2.5"} 3
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="5"} 3
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="10"} 3
+test_request_duration_seconds_bucket{operation="SendMessage",queue="q",topic="",le="+Inf"} 3
+test_request_duration_seconds_sum{operation="SendMessage",queue="q",topic=""} 3
+test_request_duration_seconds_count{operation="SendMessage",queue="q",topic=""} 3
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "test_request_duration_seconds"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"context"
+)
+
+// API 是 Queue 所有带 context.Context 参数的方法, 用于替换成测试用的 MockAPI 或者通过 Decorator 添加中间件.
+type API interface {
+	SendMessageContext(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error)
+	BatchSendMessageContext(ctx context.Context, msgs []SendMessageRequest) (requestId string, resp []BatchSendMessageResponseItem, err error)
+	BatchSendMessageAllContext(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error)
+	ReceiveMessageContext(ctx context.Context, waitSeconds int) (requestId string, msg *Message, err error)
+	BatchReceiveMessageContext(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []Message, err error)
+	PeekMessageContext(ctx context.Context) (requestId string, msg *PeekMessageResponse, err error)
+	BatchPeekMessageContext(ctx context.Context, numOfMessages int) (requestId string, msgs []PeekMessageResponse, err error)
+	DeleteMessageContext(ctx context.Context, receiptHandle string) (requestId string, err error)
+	BatchDeleteMessageContext(ctx context.Context, receiptHandles []string) (requestId string, _errors []BatchDeleteMessageErrorItem, err error)
+	BatchDeleteMessageAllContext(ctx context.Context, receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error)
+	ChangeMessageVisibilityContext(ctx context.Context, receiptHandle string, visibilityTimeout int) (requestId string, resp *ChangeMessageVisibilityResponse, err error)
+}
+
+var (
+	_ API = (*Queue)(nil)
+	_ API = (*MockAPI)(nil)
+	_ API = Decorator{}
+)
+
+// Decorator 把所有方法转发给 Next, 用于实现中间件, 例如:
+//  type loggingQueue struct {
+//      queue.Decorator
+//  }
+//
+//  func (q loggingQueue) SendMessageContext(ctx context.Context, msg *queue.SendMessageRequest) (requestId string, resp *queue.SendMessageResponse, err error) {
+//      requestId, resp, err = q.Next.SendMessageContext(ctx, msg)
+//      log.Printf("SendMessage: requestId=%s, err=%v", requestId, err)
+//      return
+//  }
+//
+//  var q queue.API = loggingQueue{queue.Decorator{Next: queue.New(endpoint, name, config)}}
+type Decorator struct {
+	Next API
+}
+
+func (d Decorator) SendMessageContext(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error) {
+	return d.Next.SendMessageContext(ctx, msg)
+}
+
+func (d Decorator) BatchSendMessageContext(ctx context.Context, msgs []SendMessageRequest) (requestId string, resp []BatchSendMessageResponseItem, err error) {
+	return d.Next.BatchSendMessageContext(ctx, msgs)
+}
+
+func (d Decorator) BatchSendMessageAllContext(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error) {
+	return d.Next.BatchSendMessageAllContext(ctx, msgs, opts)
+}
+
+func (d Decorator) ReceiveMessageContext(ctx context.Context, waitSeconds int) (requestId string, msg *Message, err error) {
+	return d.Next.ReceiveMessageContext(ctx, waitSeconds)
+}
+
+func (d Decorator) BatchReceiveMessageContext(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []Message, err error) {
+	return d.Next.BatchReceiveMessageContext(ctx, numOfMessages, waitSeconds)
+}
+
+func (d Decorator) PeekMessageContext(ctx context.Context) (requestId string, msg *PeekMessageResponse, err error) {
+	return d.Next.PeekMessageContext(ctx)
+}
+
+func (d Decorator) BatchPeekMessageContext(ctx context.Context, numOfMessages int) (requestId string, msgs []PeekMessageResponse, err error) {
+	return d.Next.BatchPeekMessageContext(ctx, numOfMessages)
+}
+
+func (d Decorator) DeleteMessageContext(ctx context.Context, receiptHandle string) (requestId string, err error) {
+	return d.Next.DeleteMessageContext(ctx, receiptHandle)
+}
+
+func (d Decorator) BatchDeleteMessageContext(ctx context.Context, receiptHandles []string) (requestId string, _errors []BatchDeleteMessageErrorItem, err error) {
+	return d.Next.BatchDeleteMessageContext(ctx, receiptHandles)
+}
+
+func (d Decorator) BatchDeleteMessageAllContext(ctx context.Context, receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error) {
+	return d.Next.BatchDeleteMessageAllContext(ctx, receiptHandles, opts)
+}
+
+func (d Decorator) ChangeMessageVisibilityContext(ctx context.Context, receiptHandle string, visibilityTimeout int) (requestId string, resp *ChangeMessageVisibilityResponse, err error) {
+	return d.Next.ChangeMessageVisibilityContext(ctx, receiptHandle, visibilityTimeout)
+}
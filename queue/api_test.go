@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type countingQueue struct {
+	Decorator
+	sent int
+}
+
+func (q *countingQueue) SendMessageContext(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error) {
+	q.sent++
+	return q.Next.SendMessageContext(ctx, msg)
+}
+
+func TestDecorator(t *testing.T) {
+	mock := &MockAPI{
+		SendMessageContextFunc: func(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error) {
+			return "request-id", &SendMessageResponse{MessageId: "message-id"}, nil
+		},
+		DeleteMessageContextFunc: func(ctx context.Context, receiptHandle string) (requestId string, err error) {
+			return "", errors.New("delete failed")
+		},
+	}
+	q := &countingQueue{Decorator: Decorator{Next: mock}}
+	var api API = q
+
+	requestId, resp, err := api.SendMessageContext(context.Background(), &SendMessageRequest{MessageBody: []byte("body")})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if requestId != "request-id" || resp.MessageId != "message-id" {
+		t.Errorf("have:%s,%s, want:%s,%s", requestId, resp.MessageId, "request-id", "message-id")
+		return
+	}
+	if _, err = api.DeleteMessageContext(context.Background(), "receipt-handle"); err == nil || err.Error() != "delete failed" {
+		t.Errorf("have:%v, want:%s", err, "delete failed")
+		return
+	}
+	if q.sent != 1 {
+		t.Errorf("have:%d, want:%d", q.sent, 1)
+		return
+	}
+
+	calls := mock.Calls()
+	if len(calls) != 2 || calls[0].Method != "SendMessageContext" || calls[1].Method != "DeleteMessageContext" || calls[1].Args[0] != "receipt-handle" {
+		t.Errorf("unexpected calls: %+v", calls)
+		return
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic when ReceiveMessageContextFunc is nil")
+		}
+	}()
+	api.ReceiveMessageContext(context.Background(), 0)
+}
@@ -0,0 +1,364 @@
+package queue
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// BatchOptions 是 BatchSendMessageAll 和 BatchDeleteMessageAll 的可选参数.
+type BatchOptions struct {
+	Parallelism int // 同时进行的批量请求的个数, 默认为 1
+
+	// following is used by BatchSendMessageAll only
+	MaxRetries   int           // 发送失败的消息的最大重试次数, 只重试临时的错误, 默认为 0 表示不重试
+	RetryBackoff time.Duration // 第一次重试之前的等待时间, 之后每次翻倍, 并加上随机抖动, 默认为 100ms, 最长 5s
+}
+
+func (opts *BatchOptions) parallelism() int {
+	if opts == nil || opts.Parallelism < 1 {
+		return 1
+	}
+	return opts.Parallelism
+}
+
+// splitSendMessages 按照 MaxBatchMessageCount 和 MaxBatchMessageBytes 把 msgs 拆分成若干批, 返回每一批在 msgs 中的起始下标.
+// 消息的大小按照 MessageSize 计算, 包括 Base64 编码, XML 转义和其他元素的开销.
+// 单条超过 MaxBatchMessageBytes 的消息单独作为一批, 由 MNS 返回错误.
+func (q *Queue) splitSendMessages(msgs []SendMessageRequest) (starts []int) {
+	var count, size int
+	for i := range msgs {
+		n := q.MessageSize(&msgs[i])
+		if count == 0 || count >= MaxBatchMessageCount || size+n > MaxBatchMessageBytes {
+			starts = append(starts, i)
+			count, size = 0, 0
+		}
+		count++
+		size += n
+	}
+	return
+}
+
+// MessageSize 返回 msg 在 BatchSendMessage 的请求中编码后的 <Message> 元素的字节数,
+// 一批消息的 MessageSize 之和不超过 MaxBatchMessageBytes, 见 BatchSendMessageAll.
+func (q *Queue) MessageSize(msg *SendMessageRequest) int {
+	m := *msg
+	if q.config.Base64Enabled {
+		m.MessageBody = internal.Base64Encode(m.MessageBody)
+	}
+	var w countWriter
+	if err := xml.NewEncoder(&w).Encode(&m); err != nil {
+		return q.MessageBodySize(msg)
+	}
+	return int(w)
+}
+
+// EstimateMessageSize 返回 msg 通过 q 批量发送时的大小.
+// q 是 *Queue 时等于 q.MessageSize(msg); 否则不知道是否开启了 Base64Enabled, 按照开启了 Base64Enabled 计算.
+func EstimateMessageSize(q API, msg *SendMessageRequest) int {
+	if v, ok := q.(interface {
+		MessageSize(msg *SendMessageRequest) int
+	}); ok {
+		return v.MessageSize(msg)
+	}
+	return (&Queue{config: mns.Config{Base64Enabled: true}}).MessageSize(msg)
+}
+
+// countWriter 只记录写入的字节数.
+type countWriter int
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+// runBatches 并发的执行 fn(i), i 为 [0, n), 同时最多执行 parallelism 个.
+func runBatches(n, parallelism int, fn func(i int)) {
+	if parallelism > n {
+		parallelism = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func (q *Queue) BatchSendMessageAll(msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error) {
+	return q.BatchSendMessageAllContext(context.Background(), msgs, opts)
+}
+
+// BatchSendMessageAllContext 发送任意条消息, 按照个数和消息体的大小拆分成多次 BatchSendMessage 请求.
+//
+// resp 和 msgs 一一对应, 单条消息发送失败时对应的 ErrorCode 不为空.
+// 如果某一批请求整体失败了, 这一批消息对应的 resp 为零值, err 为按照 msgs 顺序第一个失败的请求的错误.
+// 和 BatchSendMessageContext 不同, 不会修改 msgs.
+//
+// opts.MaxRetries 大于 0 时, 只重试发送失败并且可以重试的消息, 最终还有消息发送失败时 err 为 *BatchSendError,
+// 重试的过程中 ctx 结束时 err 为 *BatchSendCanceledError.
+// 这时每一批请求不再按照 mns.Config.RetryPolicy 重试, 每条消息最多发送 opts.MaxRetries+1 次;
+// opts.MaxRetries 为 0 时每一批请求按照 mns.Config.RetryPolicy 重试.
+func (q *Queue) BatchSendMessageAllContext(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error) {
+	if len(msgs) == 0 {
+		err = errors.New("the length of msgs is invalid")
+		return
+	}
+	for i := range msgs {
+		if len(msgs[i].MessageBody) == 0 {
+			err = errors.New("the MessageBody must not be empty")
+			return
+		}
+	}
+	if opts != nil && opts.MaxRetries > 0 {
+		return q.batchSendMessageWithRetry(ctx, msgs, opts)
+	}
+
+	resp, errs := q.batchSendMessageAll(ctx, msgs, opts.parallelism())
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// batchSendMessageAll 拆分并发送 msgs, resp 和 errs 都和 msgs 一一对应, errs[i] 为 msgs[i] 所在的那一批请求整体的错误.
+func (q *Queue) batchSendMessageAll(ctx context.Context, msgs []SendMessageRequest, parallelism int) (resp []BatchSendMessageResponseItem, errs []error) {
+	starts := q.splitSendMessages(msgs)
+	resp = make([]BatchSendMessageResponseItem, len(msgs))
+	errs = make([]error, len(msgs))
+	runBatches(len(starts), parallelism, func(i int) {
+		start, end := starts[i], len(msgs)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		// BatchSendMessageContext 会修改传入的消息, 所以需要复制一份
+		batch := make([]SendMessageRequest, end-start)
+		copy(batch, msgs[start:end])
+		_, items, err := q.BatchSendMessageContext(ctx, batch)
+		if err != nil {
+			for j := start; j < end; j++ {
+				errs[j] = err
+			}
+			return
+		}
+		copy(resp[start:end], items)
+	})
+	return
+}
+
+func (q *Queue) batchSendMessageWithRetry(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error) {
+	policy := &mns.RetryPolicy{InitialBackoff: opts.RetryBackoff}
+
+	// 每一批请求只发送一次, 由下面的循环重试, 否则两层的重试次数相乘
+	once := *q
+	once.config.RetryPolicy = &mns.RetryPolicy{MaxAttempts: 1}
+
+	resp = make([]BatchSendMessageResponseItem, len(msgs))
+	failed := make(map[int]*BatchSendItemError)
+	pending := make([]int, len(msgs)) // 需要发送的消息在 msgs 中的下标
+	for i := range pending {
+		pending[i] = i
+	}
+	for retries := 0; ; retries++ {
+		batch := make([]SendMessageRequest, len(pending))
+		for i, index := range pending {
+			batch[i] = msgs[index]
+		}
+		items, errs := once.batchSendMessageAll(ctx, batch, opts.parallelism())
+
+		var retry []int
+		for i, index := range pending {
+			resp[index] = items[i]
+			itemErr := newBatchSendItemError(index, &items[i], errs[i])
+			if itemErr == nil {
+				delete(failed, index)
+				continue
+			}
+			failed[index] = itemErr
+			if !itemErr.Permanent {
+				retry = append(retry, index)
+			}
+		}
+		if len(retry) == 0 || retries >= opts.MaxRetries {
+			break
+		}
+		timer := time.NewTimer(internal.Backoff(policy, retries+1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			err = &BatchSendCanceledError{
+				Err:   ctx.Err(),
+				Total: len(msgs),
+				Items: sortedBatchSendItemErrors(failed),
+			}
+			return
+		}
+		pending = retry
+	}
+
+	if len(failed) == 0 {
+		return
+	}
+	err = &BatchSendError{
+		Total: len(msgs),
+		Items: sortedBatchSendItemErrors(failed),
+	}
+	return
+}
+
+func sortedBatchSendItemErrors(m map[int]*BatchSendItemError) []BatchSendItemError {
+	items := make([]BatchSendItemError, 0, len(m))
+	for _, itemErr := range m {
+		items = append(items, *itemErr)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Index < items[j].Index })
+	return items
+}
+
+// BatchSendItemError 表示 BatchSendMessageAll 中单条消息发送失败的原因.
+type BatchSendItemError struct {
+	Index int // 消息在 msgs 中的下标
+
+	// 单条消息失败时 ErrorCode 和 ErrorMessage 有值, 整批请求失败时 Err 有值
+	ErrorCode    string
+	ErrorMessage string
+	Err          error
+
+	Permanent bool // 是否是重试也不能解决的错误
+}
+
+func (e *BatchSendItemError) Error() string {
+	if e.Err != nil {
+		return "msgs[" + strconv.Itoa(e.Index) + "]: " + e.Err.Error()
+	}
+	return "msgs[" + strconv.Itoa(e.Index) + "]: " + e.ErrorCode + ": " + e.ErrorMessage
+}
+
+// newBatchSendItemError 根据单条消息的发送结果返回错误, 发送成功返回 nil.
+func newBatchSendItemError(index int, item *BatchSendMessageResponseItem, err error) *BatchSendItemError {
+	switch {
+	case err != nil:
+		itemErr := &BatchSendItemError{
+			Index: index,
+			Err:   err,
+		}
+		if v, ok := err.(*mns.Error); ok {
+			itemErr.Permanent = v.HttpStatusCode/100 != 5 && !mns.IsRetryableErrorCode(v.Code)
+		}
+		return itemErr
+	case item.ErrorCode != "":
+		return &BatchSendItemError{
+			Index:        index,
+			ErrorCode:    item.ErrorCode,
+			ErrorMessage: item.ErrorMessage,
+			Permanent:    !mns.IsRetryableErrorCode(item.ErrorCode),
+		}
+	default:
+		return nil
+	}
+}
+
+var _ error = (*BatchSendError)(nil)
+
+// BatchSendError 表示 BatchSendMessageAll 重试之后仍然有消息发送失败.
+type BatchSendError struct {
+	Total int                  // 消息的总数
+	Items []BatchSendItemError // 最终发送失败的消息, 按照 Index 从小到大排列
+}
+
+// Indexes 返回最终发送失败的消息在 msgs 中的下标.
+func (e *BatchSendError) Indexes() []int {
+	indexes := make([]int, len(e.Items))
+	for i := range e.Items {
+		indexes[i] = e.Items[i].Index
+	}
+	return indexes
+}
+
+func (e *BatchSendError) Error() string {
+	return strconv.Itoa(len(e.Items)) + " of " + strconv.Itoa(e.Total) + " messages failed to send, first error: " + e.Items[0].Error()
+}
+
+var _ error = (*BatchSendCanceledError)(nil)
+
+// BatchSendCanceledError 表示 BatchSendMessageAll 在重试的过程中 ctx 结束了, Err 为 ctx.Err().
+type BatchSendCanceledError struct {
+	Err   error
+	Total int                  // 消息的总数
+	Items []BatchSendItemError // ctx 结束时还没有发送成功的消息, 按照 Index 从小到大排列
+}
+
+// Indexes 返回还没有发送成功的消息在 msgs 中的下标.
+func (e *BatchSendCanceledError) Indexes() []int {
+	indexes := make([]int, len(e.Items))
+	for i := range e.Items {
+		indexes[i] = e.Items[i].Index
+	}
+	return indexes
+}
+
+func (e *BatchSendCanceledError) Error() string {
+	return e.Err.Error() + ": " + strconv.Itoa(len(e.Items)) + " of " + strconv.Itoa(e.Total) + " messages not sent"
+}
+
+// Unwrap 返回 ctx.Err(), 可以使用 errors.Is(err, context.Canceled) 判断.
+func (e *BatchSendCanceledError) Unwrap() error {
+	return e.Err
+}
+
+func (q *Queue) BatchDeleteMessageAll(receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error) {
+	return q.BatchDeleteMessageAllContext(context.Background(), receiptHandles, opts)
+}
+
+// BatchDeleteMessageAllContext 删除任意条消息, 按照 MaxBatchMessageCount 拆分成多次 BatchDeleteMessage 请求.
+//
+// _errors 为删除失败的消息, 按照 receiptHandles 的顺序排列.
+// 如果某一批请求整体失败了, err 为按照 receiptHandles 顺序第一个失败的请求的错误.
+func (q *Queue) BatchDeleteMessageAllContext(ctx context.Context, receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error) {
+	if len(receiptHandles) == 0 {
+		err = errors.New("the length of receiptHandles is invalid")
+		return
+	}
+
+	n := (len(receiptHandles) + MaxBatchMessageCount - 1) / MaxBatchMessageCount
+	batchErrors := make([][]BatchDeleteMessageErrorItem, n)
+	errs := make([]error, n)
+	runBatches(n, opts.parallelism(), func(i int) {
+		start, end := i*MaxBatchMessageCount, (i+1)*MaxBatchMessageCount
+		if end > len(receiptHandles) {
+			end = len(receiptHandles)
+		}
+		_, batchErrors[i], errs[i] = q.BatchDeleteMessageContext(ctx, receiptHandles[start:end])
+	})
+	for i := range batchErrors {
+		_errors = append(_errors, batchErrors[i]...)
+	}
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,326 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// testBatchServer 记录每次批量请求的消息个数, BatchSendMessage 返回的 MessageId 为消息体.
+type testBatchServer struct {
+	mu      sync.Mutex
+	batches []int
+	deleted []string
+}
+
+func (s *testBatchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Messages []SendMessageRequest `xml:"Message"`
+		}
+		xml.Unmarshal(body, &req)
+		s.batches = append(s.batches, len(req.Messages))
+		fmt.Fprint(w, "<Messages>")
+		for _, msg := range req.Messages {
+			fmt.Fprintf(w, "<Message><MessageId>%s</MessageId><MessageBodyMD5>%s</MessageBodyMD5></Message>", msg.MessageBody, internal.MessageBodyMD5(msg.MessageBody))
+		}
+		fmt.Fprint(w, "</Messages>")
+	case http.MethodDelete:
+		var req struct {
+			ReceiptHandles []string `xml:"ReceiptHandle"`
+		}
+		xml.Unmarshal(body, &req)
+		s.batches = append(s.batches, len(req.ReceiptHandles))
+		var notExist []string
+		for _, receiptHandle := range req.ReceiptHandles {
+			if strings.HasPrefix(receiptHandle, "expired") {
+				notExist = append(notExist, receiptHandle)
+				continue
+			}
+			s.deleted = append(s.deleted, receiptHandle)
+		}
+		if len(notExist) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Errors>")
+		for _, receiptHandle := range notExist {
+			fmt.Fprintf(w, "<Error><ErrorCode>MessageNotExist</ErrorCode><ErrorMessage>Message not exist.</ErrorMessage><ReceiptHandle>%s</ReceiptHandle></Error>", receiptHandle)
+		}
+		fmt.Fprint(w, "</Errors>")
+	}
+}
+
+func TestBatchSendMessageAll(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	msgs := make([]SendMessageRequest, 40)
+	for i := range msgs {
+		msgs[i].MessageBody = []byte(fmt.Sprintf("%02d", i))
+	}
+	// 第 20 条消息很大, 和前后的消息不能放在同一批
+	msgs[20].MessageBody = append(msgs[20].MessageBody, bytes.Repeat([]byte("x"), MaxBatchMessageBytes-3)...)
+
+	resp, err := q.BatchSendMessageAll(msgs, &BatchOptions{Parallelism: 3})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(resp) != len(msgs) {
+		t.Errorf("have:%d, want:%d", len(resp), len(msgs))
+		return
+	}
+	for i := range resp {
+		if resp[i].MessageId != string(msgs[i].MessageBody) {
+			t.Errorf("resp[%d] mismatch", i)
+			return
+		}
+	}
+	sort.Ints(s.batches)
+	if have, want := fmt.Sprint(s.batches), "[1 3 4 16 16]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+func TestBatchSendMessageAllEscape(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	// 原始的消息体一共 40000 多字节, 但是 '"' 转义为 "&#34;" 之后每条消息都超过了 MaxBatchMessageBytes 的一半
+	msgs := make([]SendMessageRequest, 4)
+	for i := range msgs {
+		msgs[i].MessageBody = append([]byte(fmt.Sprintf("%02d", i)), bytes.Repeat([]byte(`"`), 10000)...)
+	}
+	if _, err := q.BatchSendMessageAll(msgs, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, want := fmt.Sprint(s.batches), "[1 1 1 1]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+func TestBatchSendMessageAllBase64(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret", Base64Enabled: true})
+	msgs := []SendMessageRequest{{MessageBody: []byte("a")}, {MessageBody: []byte("b")}}
+	if _, err := q.BatchSendMessageAll(msgs, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(msgs[0].MessageBody) != "a" || string(msgs[1].MessageBody) != "b" {
+		t.Error("msgs must not be modified")
+		return
+	}
+}
+
+func TestBatchDeleteMessageAll(t *testing.T) {
+	s := &testBatchServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	receiptHandles := make([]string, 35)
+	for i := range receiptHandles {
+		receiptHandles[i] = fmt.Sprintf("handle-%02d", i)
+	}
+	receiptHandles[3] = "expired-03"
+	receiptHandles[33] = "expired-33"
+
+	_errors, err := q.BatchDeleteMessageAll(receiptHandles, &BatchOptions{Parallelism: 2})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(_errors) != 2 || _errors[0].ReceiptHandle != "expired-03" || _errors[1].ReceiptHandle != "expired-33" {
+		t.Errorf("unexpected errors: %+v", _errors)
+		return
+	}
+	if len(s.deleted) != 33 {
+		t.Errorf("have:%d, want:%d", len(s.deleted), 33)
+		return
+	}
+	sort.Ints(s.batches)
+	if have, want := fmt.Sprint(s.batches), "[3 16 16]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+// testFlakyBatchServer 对消息体为 "flaky" 的消息前 failures 次返回 InternalError, 对消息体为 "invalid" 的消息返回 InvalidArgument.
+type testFlakyBatchServer struct {
+	mu       sync.Mutex
+	failures int
+	requests int
+}
+
+func (s *testFlakyBatchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		Messages []SendMessageRequest `xml:"Message"`
+	}
+	xml.Unmarshal(body, &req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	var items bytes.Buffer
+	var failed bool
+	for _, msg := range req.Messages {
+		switch {
+		case string(msg.MessageBody) == "flaky" && s.failures > 0:
+			failed = true
+			items.WriteString("<Message><ErrorCode>InternalError</ErrorCode><ErrorMessage>internal error</ErrorMessage></Message>")
+		case string(msg.MessageBody) == "invalid":
+			failed = true
+			items.WriteString("<Message><ErrorCode>InvalidArgument</ErrorCode><ErrorMessage>invalid argument</ErrorMessage></Message>")
+		default:
+			fmt.Fprintf(&items, "<Message><MessageId>%s</MessageId><MessageBodyMD5>%s</MessageBodyMD5></Message>", msg.MessageBody, internal.MessageBodyMD5(msg.MessageBody))
+		}
+	}
+	if failed {
+		s.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	fmt.Fprintf(w, "<Messages>%s</Messages>", items.String())
+}
+
+func TestBatchSendMessageAllRetry(t *testing.T) {
+	s := &testFlakyBatchServer{failures: 2}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	msgs := []SendMessageRequest{
+		{MessageBody: []byte("a")},
+		{MessageBody: []byte("flaky")},
+		{MessageBody: []byte("invalid")},
+		{MessageBody: []byte("b")},
+	}
+	resp, err := q.BatchSendMessageAll(msgs, &BatchOptions{MaxRetries: 3, RetryBackoff: time.Millisecond})
+	batchErr, ok := err.(*BatchSendError)
+	if !ok {
+		t.Errorf("want *BatchSendError, have:%v", err)
+		return
+	}
+	if have, want := fmt.Sprint(batchErr.Indexes()), "[2]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if !batchErr.Items[0].Permanent || batchErr.Items[0].ErrorCode != "InvalidArgument" {
+		t.Errorf("unexpected item error: %+v", batchErr.Items[0])
+		return
+	}
+	if resp[1].MessageId != "flaky" || resp[0].MessageId != "a" || resp[3].MessageId != "b" {
+		t.Errorf("unexpected resp: %+v", resp)
+		return
+	}
+	// 第一次发送 4 条, 之后只重试 "flaky" 两次, "invalid" 不重试
+	if s.requests != 3 {
+		t.Errorf("have:%d, want:%d", s.requests, 3)
+		return
+	}
+}
+
+func TestBatchSendMessageAllRetryExhausted(t *testing.T) {
+	s := &testFlakyBatchServer{failures: 10}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	msgs := []SendMessageRequest{{MessageBody: []byte("flaky")}, {MessageBody: []byte("a")}}
+	_, err := q.BatchSendMessageAll(msgs, &BatchOptions{MaxRetries: 2, RetryBackoff: time.Millisecond})
+	batchErr, ok := err.(*BatchSendError)
+	if !ok {
+		t.Errorf("want *BatchSendError, have:%v", err)
+		return
+	}
+	if len(batchErr.Items) != 1 || batchErr.Items[0].Index != 0 || batchErr.Items[0].Permanent {
+		t.Errorf("unexpected error: %+v", batchErr)
+		return
+	}
+	if s.requests != 3 {
+		t.Errorf("have:%d, want:%d", s.requests, 3)
+		return
+	}
+}
+
+func TestBatchSendMessageAllRetryCanceled(t *testing.T) {
+	s := &testFlakyBatchServer{failures: 10}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	msgs := []SendMessageRequest{{MessageBody: []byte("flaky")}, {MessageBody: []byte("a")}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := q.BatchSendMessageAllContext(ctx, msgs, &BatchOptions{MaxRetries: 3, RetryBackoff: time.Second})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("have:%v, want:%v", err, context.DeadlineExceeded)
+		return
+	}
+	canceledErr, ok := err.(*BatchSendCanceledError)
+	if !ok {
+		t.Errorf("want *BatchSendCanceledError, have:%v", err)
+		return
+	}
+	if have, want := fmt.Sprint(canceledErr.Indexes()), "[0]"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+// 整批请求失败时只由 BatchSendMessageAll 重试, 不和 mns.Config.RetryPolicy 的重试次数相乘.
+func TestBatchSendMessageAllRetryBudget(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{
+		AccessKeyId:     "id",
+		AccessKeySecret: "secret",
+		RetryPolicy:     &mns.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	_, err := q.BatchSendMessageAll([]SendMessageRequest{{MessageBody: []byte("a")}}, &BatchOptions{MaxRetries: 2, RetryBackoff: time.Millisecond})
+	if _, ok := err.(*BatchSendError); !ok {
+		t.Errorf("want *BatchSendError, have:%v", err)
+		return
+	}
+	if requests != 3 {
+		t.Errorf("have:%d, want:%d", requests, 3)
+		return
+	}
+}
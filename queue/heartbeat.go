@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+// heartbeatRetryInterval 是延长不可见时间失败后再次尝试之前的等待时间.
+const heartbeatRetryInterval = time.Second
+
+// Heartbeat 在消息处理期间, 定期调用 ChangeMessageVisibility 延长消息的不可见时间,
+// 避免处理时间超过队列的 VisibilityTimeout 导致消息被重复消费.
+//
+// 每次延长不可见时间都会返回新的 ReceiptHandle, 之后删除消息必须使用 ReceiptHandle() 或者 Stop() 返回的 ReceiptHandle,
+// 或者直接使用 Lease().Ack.
+type Heartbeat struct {
+	lease             *Lease
+	visibilityTimeout int
+
+	mu  sync.Mutex
+	err error // 最近一次延长不可见时间的错误
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartHeartbeat 开始为 msg 续期, 等价于 q.NewLease(msg).StartHeartbeat(ctx, visibilityTimeout).
+func (q *Queue) StartHeartbeat(ctx context.Context, msg *Message, visibilityTimeout int) *Heartbeat {
+	return q.NewLease(msg).StartHeartbeat(ctx, visibilityTimeout)
+}
+
+// StartHeartbeat 开始为消息续期, 每次续期把不可见时间设置为 visibilityTimeout 秒, 1-43200.
+// 在 ctx 被取消, 调用 Stop 或者 Ack 之后停止续期, ctx 同时用于续期的请求.
+func (l *Lease) StartHeartbeat(ctx context.Context, visibilityTimeout int) *Heartbeat {
+	if visibilityTimeout < 1 {
+		visibilityTimeout = 1
+	}
+	if visibilityTimeout > MaxVisibilityTimeout {
+		visibilityTimeout = MaxVisibilityTimeout
+	}
+	h := &Heartbeat{
+		lease:             l,
+		visibilityTimeout: visibilityTimeout,
+		stop:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+	go h.run(ctx)
+	return h
+}
+
+func (h *Heartbeat) run(ctx context.Context) {
+	defer close(h.done)
+
+	timer := time.NewTimer(h.nextBeat())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stop:
+			return
+		case <-timer.C:
+		}
+
+		// 正在进行的续期不会被 Stop 打断, 否则服务端生效之后新的 ReceiptHandle 就丢失了.
+		err := h.lease.Extend(ctx, time.Duration(h.visibilityTimeout)*time.Second)
+		if err == ErrLeaseReleased || (err != nil && ctx.Err() != nil) {
+			return
+		}
+
+		h.mu.Lock()
+		h.err = err
+		h.mu.Unlock()
+
+		if err != nil {
+			if mns.IsReceiptHandleError(err) || mns.IsMessageNotExist(err) {
+				return // 消息已经重新可见或者被删除了, 续期没有意义
+			}
+			timer.Reset(heartbeatRetryInterval)
+			continue
+		}
+		timer.Reset(h.nextBeat())
+	}
+}
+
+// nextBeat 返回距离下一次续期的时间, 在消息重新可见之前预留 1/3 的 visibilityTimeout.
+func (h *Heartbeat) nextBeat() time.Duration {
+	margin := time.Duration(h.visibilityTimeout) * time.Second / 3
+	d := time.Until(h.lease.NextVisibleAt()) - margin
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// Lease 返回续期的消息对应的 Lease.
+func (h *Heartbeat) Lease() *Lease {
+	return h.lease
+}
+
+// ReceiptHandle 返回消息最新的 ReceiptHandle.
+func (h *Heartbeat) ReceiptHandle() string {
+	return h.lease.ReceiptHandle()
+}
+
+// NextVisibleTime 返回消息下次可见的时间, 单位为毫秒.
+func (h *Heartbeat) NextVisibleTime() int64 {
+	return h.lease.nextVisibleTimeMillisecond()
+}
+
+// Err 返回最近一次续期的错误, 续期成功后会被清除.
+func (h *Heartbeat) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Stop 停止续期并等待正在进行的续期结束, 返回消息最新的 ReceiptHandle 和最近一次续期的错误.
+// Stop 可以被多次调用.
+func (h *Heartbeat) Stop() (receiptHandle string, err error) {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+	return h.lease.ReceiptHandle(), h.Err()
+}
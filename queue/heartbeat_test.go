@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var (
+		mu              sync.Mutex
+		beats           int
+		nextVisibleTime int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if have, want := r.URL.Query().Get("receiptHandle"), fmt.Sprintf("handle-%d", beats); have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		beats++
+		nextVisibleTime = time.Now().Add(time.Second).UnixNano() / int64(time.Millisecond)
+		fmt.Fprintf(w, "<ChangeVisibility><ReceiptHandle>handle-%d</ReceiptHandle><NextVisibleTime>%d</NextVisibleTime></ChangeVisibility>", beats, nextVisibleTime)
+	}))
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	msg := &Message{
+		ReceiptHandle:   "handle-0",
+		NextVisibleTime: time.Now().Add(100*time.Millisecond).UnixNano() / int64(time.Millisecond),
+	}
+	heartbeat := q.StartHeartbeat(context.Background(), msg, 1)
+	time.Sleep(time.Second)
+	receiptHandle, err := heartbeat.Stop()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if beats < 2 {
+		t.Errorf("have:%d beats, want at least 2", beats)
+		return
+	}
+	if want := fmt.Sprintf("handle-%d", beats); receiptHandle != want {
+		t.Errorf("have:%s, want:%s", receiptHandle, want)
+		return
+	}
+	if have := heartbeat.ReceiptHandle(); have != receiptHandle {
+		t.Errorf("have:%s, want:%s", have, receiptHandle)
+		return
+	}
+	if have, want := heartbeat.NextVisibleTime(), nextVisibleTime; have != want {
+		t.Errorf("have:%d, want:%d", have, want)
+		return
+	}
+}
+
+func TestHeartbeatStopsOnReceiptHandleError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Error><Code>ReceiptHandleError</Code><Message>The receipt handle you provide is not valid.</Message></Error>`)
+	}))
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	heartbeat := q.StartHeartbeat(context.Background(), &Message{ReceiptHandle: "handle-0"}, 30)
+	select {
+	case <-heartbeat.done:
+	case <-time.After(time.Second):
+		t.Error("heartbeat did not stop")
+		return
+	}
+	receiptHandle, err := heartbeat.Stop()
+	if !mns.IsReceiptHandleError(err) {
+		t.Errorf("want ReceiptHandleError, have:%v", err)
+		return
+	}
+	if receiptHandle != "handle-0" {
+		t.Errorf("have:%s, want:%s", receiptHandle, "handle-0")
+		return
+	}
+}
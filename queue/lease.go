@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+// ErrLeaseReleased 表示消息已经通过 Lease.Ack 删除了.
+var ErrLeaseReleased = errors.New("the lease has been released")
+
+// Lease 表示从队列中接收到的一条消息, 绑定了消息所在的 Queue 并持有消息最新的 ReceiptHandle.
+//
+// 每次修改消息的不可见时间都会返回新的 ReceiptHandle, Lease 在内部更新, 调用方不需要自己维护.
+// Lease 的方法可以并发调用, 修改 ReceiptHandle 的操作会依次执行.
+type Lease struct {
+	queue API
+	msg   Message // ReceiptHandle 和 NextVisibleTime 以下面的字段为准
+
+	opMu sync.Mutex // 保证 Ack, Nack 和 Extend 依次执行
+
+	mu              sync.Mutex
+	receiptHandle   string
+	nextVisibleTime int64
+	released        bool
+}
+
+// NewLease 返回 msg 对应的 Lease, msg 必须是从 q 接收到的消息.
+func (q *Queue) NewLease(msg *Message) *Lease {
+	return NewLease(q, msg)
+}
+
+// NewLease 返回 msg 对应的 Lease, msg 必须是从 q 接收到的消息, q 可以是 Decorator 等任意的 API.
+func NewLease(q API, msg *Message) *Lease {
+	return &Lease{
+		queue:           q,
+		msg:             *msg,
+		receiptHandle:   msg.ReceiptHandle,
+		nextVisibleTime: msg.NextVisibleTime,
+	}
+}
+
+// Message 返回接收到的消息, 其中的 ReceiptHandle 和 NextVisibleTime 是接收时的值,
+// 最新的值请使用 ReceiptHandle 和 NextVisibleAt.
+func (l *Lease) Message() *Message {
+	msg := l.msg
+	return &msg
+}
+
+// ReceiptHandle 返回消息最新的 ReceiptHandle.
+func (l *Lease) ReceiptHandle() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.receiptHandle
+}
+
+// EnqueuedAt 返回消息发送到队列的时间.
+func (l *Lease) EnqueuedAt() time.Time {
+	return mns.TimeUnixMillisecond(l.msg.EnqueueTime)
+}
+
+// FirstDequeuedAt 返回消息第一次被消费的时间.
+func (l *Lease) FirstDequeuedAt() time.Time {
+	return mns.TimeUnixMillisecond(l.msg.FirstDequeueTime)
+}
+
+// NextVisibleAt 返回消息下次可见的时间.
+func (l *Lease) NextVisibleAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return mns.TimeUnixMillisecond(l.nextVisibleTime)
+}
+
+func (l *Lease) nextVisibleTimeMillisecond() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextVisibleTime
+}
+
+// Ack 删除消息, 表示消息已经处理成功, 之后 Lease 的其他操作都返回 ErrLeaseReleased.
+func (l *Lease) Ack(ctx context.Context) error {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+
+	l.mu.Lock()
+	receiptHandle, released := l.receiptHandle, l.released
+	l.mu.Unlock()
+	if released {
+		return ErrLeaseReleased
+	}
+
+	if _, err := l.queue.DeleteMessageContext(ctx, receiptHandle); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.released = true
+	l.mu.Unlock()
+	return nil
+}
+
+// Nack 表示消息处理失败, 消息在 delay 之后重新可见, delay 小于 1 秒按照 1 秒处理, 大于 12 小时返回错误.
+func (l *Lease) Nack(ctx context.Context, delay time.Duration) error {
+	return l.changeVisibility(ctx, delay)
+}
+
+// Extend 把消息的不可见时间重新设置为从现在开始的 d, d 小于 1 秒按照 1 秒处理, 大于 12 小时返回错误.
+func (l *Lease) Extend(ctx context.Context, d time.Duration) error {
+	return l.changeVisibility(ctx, d)
+}
+
+func (l *Lease) changeVisibility(ctx context.Context, d time.Duration) error {
+	visibilityTimeout := int((d + time.Second - 1) / time.Second) // 向上取整
+	if visibilityTimeout < 1 {
+		visibilityTimeout = 1
+	}
+	if visibilityTimeout > MaxVisibilityTimeout {
+		return fmt.Errorf("the visibility timeout %v is greater than %ds", d, MaxVisibilityTimeout)
+	}
+
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+
+	l.mu.Lock()
+	receiptHandle, released := l.receiptHandle, l.released
+	l.mu.Unlock()
+	if released {
+		return ErrLeaseReleased
+	}
+
+	_, resp, err := l.queue.ChangeMessageVisibilityContext(ctx, receiptHandle, visibilityTimeout)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.receiptHandle = resp.ReceiptHandle
+	l.nextVisibleTime = resp.NextVisibleTime
+	l.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+// testLeaseServer 模拟 ChangeMessageVisibility 和 DeleteMessage, 每次修改不可见时间都会生成新的 ReceiptHandle,
+// 使用过期的 ReceiptHandle 返回 ReceiptHandleError.
+type testLeaseServer struct {
+	mu                sync.Mutex
+	receiptHandle     int
+	visibilityTimeout string
+	deleted           bool
+}
+
+func (s *testLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	receiptHandle := query.Get("receiptHandle")
+	if r.Method == http.MethodDelete {
+		receiptHandle = query.Get("ReceiptHandle")
+	}
+	if s.deleted || receiptHandle != fmt.Sprintf("handle-%d", s.receiptHandle) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Error><Code>ReceiptHandleError</Code><Message>The receipt handle you provide is not valid.</Message></Error>`)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.receiptHandle++
+		s.visibilityTimeout = query.Get("visibilityTimeout")
+		fmt.Fprintf(w, "<ChangeVisibility><ReceiptHandle>handle-%d</ReceiptHandle><NextVisibleTime>1526000000000</NextVisibleTime></ChangeVisibility>", s.receiptHandle)
+	case http.MethodDelete:
+		s.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestLease(t *testing.T) {
+	s := &testLeaseServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	lease := q.NewLease(&Message{
+		ReceiptHandle: "handle-0",
+		EnqueueTime:   1525000000000,
+	})
+	if have, want := lease.EnqueuedAt(), mns.TimeUnixMillisecond(1525000000000); !have.Equal(want) {
+		t.Errorf("have:%v, want:%v", have, want)
+		return
+	}
+
+	ctx := context.Background()
+	if err := lease.Extend(ctx, 1500*time.Millisecond); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, want := s.visibilityTimeout, "2"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if err := lease.Nack(ctx, 0); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, want := s.visibilityTimeout, "1"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if err := lease.Extend(ctx, MaxVisibilityTimeout*time.Second+time.Second); err == nil {
+		t.Error("want error")
+		return
+	}
+	if have, want := lease.ReceiptHandle(), "handle-2"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if have, want := lease.ReceiptHandle(), "handle-2"; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+	if have, want := lease.NextVisibleAt(), mns.TimeUnixMillisecond(1526000000000); !have.Equal(want) {
+		t.Errorf("have:%v, want:%v", have, want)
+		return
+	}
+	if err := lease.Ack(ctx); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := lease.Ack(ctx); err != ErrLeaseReleased {
+		t.Errorf("have:%v, want:%v", err, ErrLeaseReleased)
+		return
+	}
+}
+
+func TestLeaseConcurrentExtend(t *testing.T) {
+	s := &testLeaseServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	q := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	lease := q.NewLease(&Message{ReceiptHandle: "handle-0"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := lease.Extend(context.Background(), time.Minute); err != nil {
+				t.Error(err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if err := lease.Ack(context.Background()); err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
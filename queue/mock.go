@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// MockAPI 是 API 的 mock 实现, 用于测试.
+//
+// 调用 XxxContext 时记录调用并执行对应的 XxxContextFunc, XxxContextFunc 为 nil 时 panic.
+type MockAPI struct {
+	SendMessageContextFunc             func(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error)
+	BatchSendMessageContextFunc        func(ctx context.Context, msgs []SendMessageRequest) (requestId string, resp []BatchSendMessageResponseItem, err error)
+	BatchSendMessageAllContextFunc     func(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error)
+	ReceiveMessageContextFunc          func(ctx context.Context, waitSeconds int) (requestId string, msg *Message, err error)
+	BatchReceiveMessageContextFunc     func(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []Message, err error)
+	PeekMessageContextFunc             func(ctx context.Context) (requestId string, msg *PeekMessageResponse, err error)
+	BatchPeekMessageContextFunc        func(ctx context.Context, numOfMessages int) (requestId string, msgs []PeekMessageResponse, err error)
+	DeleteMessageContextFunc           func(ctx context.Context, receiptHandle string) (requestId string, err error)
+	BatchDeleteMessageContextFunc      func(ctx context.Context, receiptHandles []string) (requestId string, _errors []BatchDeleteMessageErrorItem, err error)
+	BatchDeleteMessageAllContextFunc   func(ctx context.Context, receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error)
+	ChangeMessageVisibilityContextFunc func(ctx context.Context, receiptHandle string, visibilityTimeout int) (requestId string, resp *ChangeMessageVisibilityResponse, err error)
+
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+// MockCall 是 MockAPI 的一次调用.
+type MockCall struct {
+	Method string        // 方法名, 比如 SendMessageContext
+	Args   []interface{} // 除了 ctx 之外的参数
+}
+
+// Calls 按照调用的顺序返回所有的调用.
+func (m *MockAPI) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+func (m *MockAPI) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Method: method, Args: args})
+	m.mu.Unlock()
+}
+
+func (m *MockAPI) SendMessageContext(ctx context.Context, msg *SendMessageRequest) (requestId string, resp *SendMessageResponse, err error) {
+	m.record("SendMessageContext", msg)
+	if m.SendMessageContextFunc == nil {
+		panic("queue: MockAPI.SendMessageContextFunc is nil")
+	}
+	return m.SendMessageContextFunc(ctx, msg)
+}
+
+func (m *MockAPI) BatchSendMessageContext(ctx context.Context, msgs []SendMessageRequest) (requestId string, resp []BatchSendMessageResponseItem, err error) {
+	m.record("BatchSendMessageContext", msgs)
+	if m.BatchSendMessageContextFunc == nil {
+		panic("queue: MockAPI.BatchSendMessageContextFunc is nil")
+	}
+	return m.BatchSendMessageContextFunc(ctx, msgs)
+}
+
+func (m *MockAPI) BatchSendMessageAllContext(ctx context.Context, msgs []SendMessageRequest, opts *BatchOptions) (resp []BatchSendMessageResponseItem, err error) {
+	m.record("BatchSendMessageAllContext", msgs, opts)
+	if m.BatchSendMessageAllContextFunc == nil {
+		panic("queue: MockAPI.BatchSendMessageAllContextFunc is nil")
+	}
+	return m.BatchSendMessageAllContextFunc(ctx, msgs, opts)
+}
+
+func (m *MockAPI) ReceiveMessageContext(ctx context.Context, waitSeconds int) (requestId string, msg *Message, err error) {
+	m.record("ReceiveMessageContext", waitSeconds)
+	if m.ReceiveMessageContextFunc == nil {
+		panic("queue: MockAPI.ReceiveMessageContextFunc is nil")
+	}
+	return m.ReceiveMessageContextFunc(ctx, waitSeconds)
+}
+
+func (m *MockAPI) BatchReceiveMessageContext(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []Message, err error) {
+	m.record("BatchReceiveMessageContext", numOfMessages, waitSeconds)
+	if m.BatchReceiveMessageContextFunc == nil {
+		panic("queue: MockAPI.BatchReceiveMessageContextFunc is nil")
+	}
+	return m.BatchReceiveMessageContextFunc(ctx, numOfMessages, waitSeconds)
+}
+
+func (m *MockAPI) PeekMessageContext(ctx context.Context) (requestId string, msg *PeekMessageResponse, err error) {
+	m.record("PeekMessageContext")
+	if m.PeekMessageContextFunc == nil {
+		panic("queue: MockAPI.PeekMessageContextFunc is nil")
+	}
+	return m.PeekMessageContextFunc(ctx)
+}
+
+func (m *MockAPI) BatchPeekMessageContext(ctx context.Context, numOfMessages int) (requestId string, msgs []PeekMessageResponse, err error) {
+	m.record("BatchPeekMessageContext", numOfMessages)
+	if m.BatchPeekMessageContextFunc == nil {
+		panic("queue: MockAPI.BatchPeekMessageContextFunc is nil")
+	}
+	return m.BatchPeekMessageContextFunc(ctx, numOfMessages)
+}
+
+func (m *MockAPI) DeleteMessageContext(ctx context.Context, receiptHandle string) (requestId string, err error) {
+	m.record("DeleteMessageContext", receiptHandle)
+	if m.DeleteMessageContextFunc == nil {
+		panic("queue: MockAPI.DeleteMessageContextFunc is nil")
+	}
+	return m.DeleteMessageContextFunc(ctx, receiptHandle)
+}
+
+func (m *MockAPI) BatchDeleteMessageContext(ctx context.Context, receiptHandles []string) (requestId string, _errors []BatchDeleteMessageErrorItem, err error) {
+	m.record("BatchDeleteMessageContext", receiptHandles)
+	if m.BatchDeleteMessageContextFunc == nil {
+		panic("queue: MockAPI.BatchDeleteMessageContextFunc is nil")
+	}
+	return m.BatchDeleteMessageContextFunc(ctx, receiptHandles)
+}
+
+func (m *MockAPI) BatchDeleteMessageAllContext(ctx context.Context, receiptHandles []string, opts *BatchOptions) (_errors []BatchDeleteMessageErrorItem, err error) {
+	m.record("BatchDeleteMessageAllContext", receiptHandles, opts)
+	if m.BatchDeleteMessageAllContextFunc == nil {
+		panic("queue: MockAPI.BatchDeleteMessageAllContextFunc is nil")
+	}
+	return m.BatchDeleteMessageAllContextFunc(ctx, receiptHandles, opts)
+}
+
+func (m *MockAPI) ChangeMessageVisibilityContext(ctx context.Context, receiptHandle string, visibilityTimeout int) (requestId string, resp *ChangeMessageVisibilityResponse, err error) {
+	m.record("ChangeMessageVisibilityContext", receiptHandle, visibilityTimeout)
+	if m.ChangeMessageVisibilityContextFunc == nil {
+		panic("queue: MockAPI.ChangeMessageVisibilityContextFunc is nil")
+	}
+	return m.ChangeMessageVisibilityContextFunc(ctx, receiptHandle, visibilityTimeout)
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// Notification 是主题推送到队列的消息的属性, 发布的消息在 Message.MessageBody 中.
+type Notification struct {
+	Format           string // 订阅的 NotifyContentFormat, XML 或者 JSON
+	TopicOwner       string // 主题所有者的 AccountId
+	TopicName        string
+	Subscriber       string // 订阅者的 AccountId
+	SubscriptionName string
+	MessageId        string // 发布消息时返回的 MessageId, 不是队列消息的 MessageId
+	MessageTag       string
+	PublishTime      int64 // 消息的发布时间, 从 1970-1-1 00:00:00 到现在的毫秒值
+}
+
+// UnwrapNotification 解开主题推送到队列的 XML 或者 JSON 格式的消息,
+// msg.MessageBody 替换为发布的消息, msg.Notification 为主题名称, MessageTag, 发布时间等信息.
+//
+// msg 不是 XML 或者 JSON 格式的主题消息时返回 false, msg 保持不变, SIMPLIFIED 格式的订阅推送的消息即发布的消息, 不需要解开.
+// base64Enabled 和发布消息的 mns.Config.Base64Enabled 一致, 见 topic.DecodeNotification.
+func UnwrapNotification(msg *Message, base64Enabled bool) (ok bool, err error) {
+	n, err := internal.DecodeNotification(msg.MessageBody, false)
+	if err != nil {
+		return false, err
+	}
+	if n.Format == internal.NotifyContentFormatSimplified {
+		return false, nil
+	}
+	if base64Enabled && len(n.Message) > 0 {
+		if n.Message, err = internal.Base64Decode(n.Message); err != nil {
+			return false, err
+		}
+		n.MessageMD5 = internal.MessageBodyMD5(n.Message)
+	}
+	msg.MessageBody = n.Message
+	msg.MessageBodyMD5 = n.MessageMD5
+	msg.Notification = &Notification{
+		Format:           n.Format,
+		TopicOwner:       n.TopicOwner,
+		TopicName:        n.TopicName,
+		Subscriber:       n.Subscriber,
+		SubscriptionName: n.SubscriptionName,
+		MessageId:        n.MessageId,
+		MessageTag:       n.MessageTag,
+		PublishTime:      n.PublishTime,
+	}
+	return true, nil
+}
+
+type notificationUnwrapper struct {
+	Decorator
+	base64Enabled bool
+}
+
+// NewNotificationUnwrapper 返回对接收到的每一条消息调用 UnwrapNotification 的 API, 用于消费订阅了主题的队列.
+// 解开失败不影响接收的结果, 消息保持不变, 错误记录在 Message.NotificationError 中,
+// 调用方可以通过 ReceiptHandle 删除无法解开的消息.
+//
+//  q := queue.NewNotificationUnwrapper(queue.New(endpoint, queueName, config), false)
+func NewNotificationUnwrapper(next API, base64Enabled bool) API {
+	return &notificationUnwrapper{
+		Decorator:     Decorator{Next: next},
+		base64Enabled: base64Enabled,
+	}
+}
+
+func (q *notificationUnwrapper) ReceiveMessageContext(ctx context.Context, waitSeconds int) (requestId string, msg *Message, err error) {
+	requestId, msg, err = q.Next.ReceiveMessageContext(ctx, waitSeconds)
+	if err != nil {
+		return
+	}
+	q.unwrap(msg)
+	return
+}
+
+func (q *notificationUnwrapper) BatchReceiveMessageContext(ctx context.Context, numOfMessages, waitSeconds int) (requestId string, msgs []Message, err error) {
+	requestId, msgs, err = q.Next.BatchReceiveMessageContext(ctx, numOfMessages, waitSeconds)
+	if err != nil {
+		return
+	}
+	for i := range msgs {
+		q.unwrap(&msgs[i])
+	}
+	return
+}
+
+func (q *notificationUnwrapper) unwrap(msg *Message) {
+	if _, err := UnwrapNotification(msg, q.base64Enabled); err != nil {
+		msg.NotificationError = err
+	}
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/mnstest"
+	"github.com/chanxuehong/mns.aliyun.v20150606/topic"
+)
+
+func TestNotificationUnwrapper(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateTopic("test")
+	config := s.Config()
+	tp := topic.New(s.URL, "test", config)
+	for _, format := range []topic.NotifyContentFormat{topic.NotifyContentFormatXML, topic.NotifyContentFormatJSON, topic.NotifyContentFormatSimplified} {
+		name := string(format)
+		s.CreateQueue(name, nil)
+		if _, err := tp.Subscribe(name, &topic.SubscribeRequest{Endpoint: topic.QueueEndpoint("cn-hangzhou", "1234567890123456", name), NotifyContentFormat: format}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+	_, resp, err := tp.PublishMessage(&topic.PublishMessageRequest{MessageBody: []byte("hello"), MessageTag: "tag"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, format := range []topic.NotifyContentFormat{topic.NotifyContentFormatXML, topic.NotifyContentFormatJSON} {
+		q := NewNotificationUnwrapper(New(s.URL, string(format), config), false)
+		_, msg, err := q.ReceiveMessageContext(context.Background(), 1)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if string(msg.MessageBody) != "hello" || msg.Notification == nil {
+			t.Errorf("%s: have:%q/%v, want:%q", format, msg.MessageBody, msg.Notification, "hello")
+			return
+		}
+		if n := msg.Notification; n.Format != string(format) || n.TopicName != "test" || n.MessageId != resp.MessageId || n.MessageTag != "tag" || n.PublishTime == 0 {
+			t.Errorf("%s: unexpected notification: %+v", format, n)
+			return
+		}
+	}
+
+	// SIMPLIFIED 格式的消息保持不变
+	_, msgs, err := NewNotificationUnwrapper(New(s.URL, string(topic.NotifyContentFormatSimplified), config), false).BatchReceiveMessageContext(context.Background(), 16, 1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(msgs) != 1 || string(msgs[0].MessageBody) != "hello" || msgs[0].Notification != nil {
+		t.Errorf("unexpected messages: %+v", msgs)
+		return
+	}
+}
+
+func TestNotificationUnwrapperError(t *testing.T) {
+	s := mnstest.NewServer(nil)
+	defer s.Close()
+	s.CreateQueue("test", nil)
+	q := New(s.URL, "test", s.Config())
+	bodies := []string{
+		`{"TopicName":"test","MessageId":"1","MessageMD5":"00000000000000000000000000000000","Message":"hello"}`,
+		"plain",
+	}
+	for _, body := range bodies {
+		if _, _, err := q.SendMessage(&SendMessageRequest{MessageBody: []byte(body)}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+
+	// 解开失败的消息和其他消息一起返回, 错误记录在 NotificationError 中
+	_, msgs, err := NewNotificationUnwrapper(q, false).BatchReceiveMessageContext(context.Background(), 16, 1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(msgs) != 2 {
+		t.Errorf("have:%d, want:%d", len(msgs), 2)
+		return
+	}
+	for i := range msgs {
+		switch msg := &msgs[i]; string(msg.MessageBody) {
+		case bodies[0]:
+			if msg.Notification != nil || msg.NotificationError == nil {
+				t.Errorf("unexpected message: %+v", msg)
+				return
+			}
+		case bodies[1]:
+			if msg.Notification != nil || msg.NotificationError != nil {
+				t.Errorf("unexpected message: %+v", msg)
+				return
+			}
+		default:
+			t.Errorf("unexpected message: %+v", msg)
+			return
+		}
+	}
+}
+
+func TestUnwrapNotificationBase64(t *testing.T) {
+	// 发布消息时 Base64Enabled 为 true, "aGVsbG8=" 是 "hello" 的 base64 编码
+	msg := &Message{MessageBody: []byte(`{"TopicName":"test","MessageId":"1","MessageMD5":"0733351879B2FA9BD05C7CA3061529C0","Message":"aGVsbG8="}`)}
+	ok, err := UnwrapNotification(msg, true)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !ok || string(msg.MessageBody) != "hello" || msg.MessageBodyMD5 != "5D41402ABC4B2A76B9719D911017C592" {
+		t.Errorf("have:%v/%q/%s, want:%v/%q/%s", ok, msg.MessageBody, msg.MessageBodyMD5, true, "hello", "5D41402ABC4B2A76B9719D911017C592")
+		return
+	}
+}
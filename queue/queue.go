@@ -3,6 +3,7 @@ package queue
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -82,7 +83,7 @@ func (q *Queue) SendMessageContext(ctx context.Context, msg *SendMessageRequest)
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodPost, _url, nil, reqBody, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "SendMessage"}, http.MethodPost, _url, nil, reqBody, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -95,7 +96,7 @@ func (q *Queue) SendMessageContext(ctx context.Context, msg *SendMessageRequest)
 			return
 		}
 		if want := internal.MessageBodyMD5(msg.MessageBody); strings.ToUpper(result.MessageBodyMD5) != want {
-			err = internal.NewMessageBodyMD5MismatchError(msg.MessageBody, result.MessageBodyMD5, want)
+			err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(q.config, "SendMessage", _url, msg.MessageBody, result.MessageBodyMD5, want)
 			return
 		}
 		resp = &result
@@ -106,6 +107,32 @@ func (q *Queue) SendMessageContext(ctx context.Context, msg *SendMessageRequest)
 	}
 }
 
+const (
+	MaxBatchMessageCount = 16       // 批量接口单次请求的最大消息个数
+	MaxBatchMessageBytes = 64 << 10 // BatchSendMessage 单次请求的消息体的最大总字节数
+	MaxMessageBodyBytes  = 64 << 10 // 单条消息体的最大字节数, 即队列的 MaximumMessageSize 的最大值
+	MaxVisibilityTimeout = 43200    // ChangeMessageVisibility 的 visibilityTimeout 的最大值, 单位为秒, 即 12 小时
+)
+
+// MessageBodySize 返回 msg 发送给 MNS 时消息体的字节数, 开启 Base64Enabled 时为编码后的字节数.
+func (q *Queue) MessageBodySize(msg *SendMessageRequest) int {
+	if q.config.Base64Enabled {
+		return base64.StdEncoding.EncodedLen(len(msg.MessageBody))
+	}
+	return len(msg.MessageBody)
+}
+
+// EstimateMessageBodySize 返回 msg 通过 q 发送给 MNS 时消息体的字节数.
+// q 是 *Queue 时等于 q.MessageBodySize(msg); 否则不知道是否开启了 Base64Enabled, 按照 Base64 编码之后的字节数计算.
+func EstimateMessageBodySize(q API, msg *SendMessageRequest) int {
+	if v, ok := q.(interface {
+		MessageBodySize(msg *SendMessageRequest) int
+	}); ok {
+		return v.MessageBodySize(msg)
+	}
+	return base64.StdEncoding.EncodedLen(len(msg.MessageBody))
+}
+
 type BatchSendMessageResponseItem struct {
 	XMLName struct{} `xml:"Message"`
 
@@ -172,7 +199,7 @@ func (q *Queue) BatchSendMessageContext(ctx context.Context, msgs []SendMessageR
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodPost, _url, nil, reqBody, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "BatchSendMessage"}, http.MethodPost, _url, nil, reqBody, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -203,7 +230,7 @@ func (q *Queue) BatchSendMessageContext(ctx context.Context, msgs []SendMessageR
 			}
 			want := internal.MessageBodyMD5(reqMessages[i].MessageBody)
 			if strings.ToUpper(resultMessages[i].MessageBodyMD5) != want {
-				err = internal.NewMessageBodyMD5MismatchError(reqMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
+				err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(q.config, "BatchSendMessage", _url, reqMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
 				return
 			}
 		}
@@ -227,6 +254,9 @@ type Message struct {
 	FirstDequeueTime int64  `xml:"FirstDequeueTime"`
 	DequeueCount     int    `xml:"DequeueCount"`
 	Priority         int    `xml:"Priority"`
+
+	Notification      *Notification `xml:"-"` // 主题推送到队列的消息被 UnwrapNotification 解开之后不为 nil
+	NotificationError error         `xml:"-"` // NewNotificationUnwrapper 解开消息失败时的错误, 此时 Notification 为 nil, 消息保持不变
 }
 
 func (q *Queue) ReceiveMessage(waitSeconds int) (requestId string, msg *Message, err error) {
@@ -263,7 +293,7 @@ func (q *Queue) ReceiveMessageContext(ctx context.Context, waitSeconds int) (req
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodGet, _url, nil, nil, respBuffer, config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "ReceiveMessage"}, http.MethodGet, _url, nil, nil, respBuffer, config)
 	if err != nil {
 		return
 	}
@@ -276,7 +306,7 @@ func (q *Queue) ReceiveMessageContext(ctx context.Context, waitSeconds int) (req
 			return
 		}
 		if want := internal.MessageBodyMD5(result.MessageBody); strings.ToUpper(result.MessageBodyMD5) != want {
-			err = internal.NewMessageBodyMD5MismatchError(result.MessageBody, result.MessageBodyMD5, want)
+			err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(config, "ReceiveMessage", _url, result.MessageBody, result.MessageBodyMD5, want)
 			return
 		}
 		if q.config.Base64Enabled && len(result.MessageBody) > 0 {
@@ -337,7 +367,7 @@ func (q *Queue) BatchReceiveMessageContext(ctx context.Context, numOfMessages, w
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodGet, _url, nil, nil, respBuffer, config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "BatchReceiveMessage"}, http.MethodGet, _url, nil, nil, respBuffer, config)
 	if err != nil {
 		return
 	}
@@ -353,7 +383,7 @@ func (q *Queue) BatchReceiveMessageContext(ctx context.Context, numOfMessages, w
 		for i := range resultMessages {
 			want := internal.MessageBodyMD5(resultMessages[i].MessageBody)
 			if strings.ToUpper(resultMessages[i].MessageBodyMD5) != want {
-				err = internal.NewMessageBodyMD5MismatchError(resultMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
+				err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(config, "BatchReceiveMessage", _url, resultMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
 				return
 			}
 		}
@@ -404,7 +434,7 @@ func (q *Queue) PeekMessageContext(ctx context.Context) (requestId string, msg *
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodGet, _url, nil, nil, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "PeekMessage", Idempotent: true}, http.MethodGet, _url, nil, nil, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -417,7 +447,7 @@ func (q *Queue) PeekMessageContext(ctx context.Context) (requestId string, msg *
 			return
 		}
 		if want := internal.MessageBodyMD5(result.MessageBody); strings.ToUpper(result.MessageBodyMD5) != want {
-			err = internal.NewMessageBodyMD5MismatchError(result.MessageBody, result.MessageBodyMD5, want)
+			err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(q.config, "PeekMessage", _url, result.MessageBody, result.MessageBodyMD5, want)
 			return
 		}
 		if q.config.Base64Enabled && len(result.MessageBody) > 0 {
@@ -459,7 +489,7 @@ func (q *Queue) BatchPeekMessageContext(ctx context.Context, numOfMessages int)
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodGet, _url, nil, nil, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "BatchPeekMessage", Idempotent: true}, http.MethodGet, _url, nil, nil, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -475,7 +505,7 @@ func (q *Queue) BatchPeekMessageContext(ctx context.Context, numOfMessages int)
 		for i := range resultMessages {
 			want := internal.MessageBodyMD5(resultMessages[i].MessageBody)
 			if strings.ToUpper(resultMessages[i].MessageBodyMD5) != want {
-				err = internal.NewMessageBodyMD5MismatchError(resultMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
+				err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(q.config, "BatchPeekMessage", _url, resultMessages[i].MessageBody, resultMessages[i].MessageBodyMD5, want)
 				return
 			}
 		}
@@ -514,7 +544,7 @@ func (q *Queue) DeleteMessageContext(ctx context.Context, receiptHandle string)
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodDelete, _url, nil, nil, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "DeleteMessage", Idempotent: true, DoneErrorCode: mns.ErrorCodeReceiptHandleError}, http.MethodDelete, _url, nil, nil, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -578,7 +608,7 @@ func (q *Queue) BatchDeleteMessageContext(ctx context.Context, receiptHandles []
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodDelete, _url, nil, reqBody, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "BatchDeleteMessage", Idempotent: true}, http.MethodDelete, _url, nil, reqBody, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -625,7 +655,7 @@ func (q *Queue) ChangeMessageVisibilityContext(ctx context.Context, receiptHandl
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodPut, _url, nil, nil, respBuffer, q.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "ChangeMessageVisibility"}, http.MethodPut, _url, nil, nil, respBuffer, q.config)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,23 @@
+package mns
+
+import "time"
+
+// RetryPolicy 是请求失败之后的重试策略.
+//
+// 下面的情况会重试:
+//  1. 连接被服务端关闭等网络错误;
+//  2. 请求超时, 只针对幂等的接口, 比如 GetQueueAttributes, PeekMessage, DeleteMessage;
+//  3. MNS 返回错误并且 ShouldRetry 返回 true, 默认为 5xx 和限流的错误.
+type RetryPolicy struct {
+	MaxAttempts    int           // 最多请求的次数, 包括第一次请求, 默认为 3, 1 表示不重试
+	InitialBackoff time.Duration // 第一次重试之前的等待时间, 之后每次翻倍, 并加上随机抖动, 默认为 100ms
+	MaxBackoff     time.Duration // 重试之前的最长等待时间, 默认为 5s
+
+	// ShouldRetry 根据 MNS 返回的错误判断是否需要重试, 为 nil 时使用 DefaultShouldRetry.
+	ShouldRetry func(err *Error) bool
+}
+
+// DefaultShouldRetry 对服务端 5xx 的错误和限流的错误返回 true.
+func DefaultShouldRetry(err *Error) bool {
+	return err.HttpStatusCode/100 == 5 || IsRetryableErrorCode(err.Code)
+}
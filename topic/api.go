@@ -0,0 +1,70 @@
+package topic
+
+import (
+	"context"
+)
+
+// API 是 Topic 所有带 context.Context 参数的方法, 用于替换成测试用的 MockAPI 或者通过 Decorator 添加中间件.
+type API interface {
+	PublishMessageContext(ctx context.Context, msg *PublishMessageRequest) (requestId string, resp *PublishMessageResponse, err error)
+	CreateTopicContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error)
+	SetTopicAttributesContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error)
+	GetTopicAttributesContext(ctx context.Context) (requestId string, resp *GetTopicAttributesResponse, err error)
+	DeleteTopicContext(ctx context.Context) (requestId string, err error)
+	SubscribeContext(ctx context.Context, subscription string, req *SubscribeRequest) (requestId string, err error)
+	UnsubscribeContext(ctx context.Context, subscription string) (requestId string, err error)
+	SetSubscriptionAttributesContext(ctx context.Context, subscription string, attrs *SubscriptionAttributes) (requestId string, err error)
+	GetSubscriptionAttributesContext(ctx context.Context, subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error)
+	ListSubscriptionByTopicContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error)
+}
+
+var (
+	_ API = (*Topic)(nil)
+	_ API = (*MockAPI)(nil)
+	_ API = Decorator{}
+)
+
+// Decorator 把所有方法转发给 Next, 用于实现中间件, 用法见 queue.Decorator.
+type Decorator struct {
+	Next API
+}
+
+func (d Decorator) PublishMessageContext(ctx context.Context, msg *PublishMessageRequest) (requestId string, resp *PublishMessageResponse, err error) {
+	return d.Next.PublishMessageContext(ctx, msg)
+}
+
+func (d Decorator) CreateTopicContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	return d.Next.CreateTopicContext(ctx, attrs)
+}
+
+func (d Decorator) SetTopicAttributesContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	return d.Next.SetTopicAttributesContext(ctx, attrs)
+}
+
+func (d Decorator) GetTopicAttributesContext(ctx context.Context) (requestId string, resp *GetTopicAttributesResponse, err error) {
+	return d.Next.GetTopicAttributesContext(ctx)
+}
+
+func (d Decorator) DeleteTopicContext(ctx context.Context) (requestId string, err error) {
+	return d.Next.DeleteTopicContext(ctx)
+}
+
+func (d Decorator) SubscribeContext(ctx context.Context, subscription string, req *SubscribeRequest) (requestId string, err error) {
+	return d.Next.SubscribeContext(ctx, subscription, req)
+}
+
+func (d Decorator) UnsubscribeContext(ctx context.Context, subscription string) (requestId string, err error) {
+	return d.Next.UnsubscribeContext(ctx, subscription)
+}
+
+func (d Decorator) SetSubscriptionAttributesContext(ctx context.Context, subscription string, attrs *SubscriptionAttributes) (requestId string, err error) {
+	return d.Next.SetSubscriptionAttributesContext(ctx, subscription, attrs)
+}
+
+func (d Decorator) GetSubscriptionAttributesContext(ctx context.Context, subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error) {
+	return d.Next.GetSubscriptionAttributesContext(ctx, subscription)
+}
+
+func (d Decorator) ListSubscriptionByTopicContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error) {
+	return d.Next.ListSubscriptionByTopicContext(ctx, prefix, marker, retNumber)
+}
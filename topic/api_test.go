@@ -0,0 +1,30 @@
+package topic
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMockAPI(t *testing.T) {
+	mock := &MockAPI{
+		PublishMessageContextFunc: func(ctx context.Context, msg *PublishMessageRequest) (requestId string, resp *PublishMessageResponse, err error) {
+			return "request-id", &PublishMessageResponse{MessageId: "message-id"}, nil
+		},
+	}
+	var api API = Decorator{Next: mock}
+
+	_, resp, err := api.PublishMessageContext(context.Background(), &PublishMessageRequest{MessageBody: []byte("body"), MessageTag: "tag"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if resp.MessageId != "message-id" {
+		t.Errorf("have:%s, want:%s", resp.MessageId, "message-id")
+		return
+	}
+	calls := mock.Calls()
+	if len(calls) != 1 || calls[0].Method != "PublishMessageContext" || calls[0].Args[0].(*PublishMessageRequest).MessageTag != "tag" {
+		t.Errorf("unexpected calls: %+v", calls)
+		return
+	}
+}
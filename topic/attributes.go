@@ -0,0 +1,267 @@
+package topic
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+// MessageAttributes 是推送到邮件, 短信和移动推送的 Endpoint 时需要的消息属性, 用于 PublishMessageRequest.MessageAttributes.
+// 每个属性在 XML 中编码为 JSON 字符串:
+//  <MessageAttributes>
+//      <DirectMail>{"AccountName":"...","Subject":"...","AddressType":0,"IsHtml":0,"ReplyToAddress":0}</DirectMail>
+//      <DirectSMS>{"FreeSignName":"...","TemplateCode":"...","Type":"singleContent","Receiver":"...","SmsParams":"{...}"}</DirectSMS>
+//  </MessageAttributes>
+// PublishMessageRequest.MessageAttributes 也可以是其他能被 encoding/xml 编码的值, 此时不做校验.
+type MessageAttributes struct {
+	DirectMail *MailAttributes // 推送到 MailEndpoint
+	DirectSMS  *SMSAttributes  // 推送到 SMSEndpoint
+	Push       *PushAttributes // 推送到移动推送
+}
+
+var _ xml.Marshaler = MessageAttributes{}
+
+// Validate 校验所有不为 nil 的属性, PublishMessage 发送之前会调用.
+func (attrs MessageAttributes) Validate() error {
+	if attrs.DirectMail == nil && attrs.DirectSMS == nil && attrs.Push == nil {
+		return errors.New("the MessageAttributes must not be empty")
+	}
+	if attrs.DirectMail != nil {
+		if err := attrs.DirectMail.Validate(); err != nil {
+			return err
+		}
+	}
+	if attrs.DirectSMS != nil {
+		if err := attrs.DirectSMS.Validate(); err != nil {
+			return err
+		}
+	}
+	if attrs.Push != nil {
+		if err := attrs.Push.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (attrs MessageAttributes) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
+	if err = e.EncodeToken(start); err != nil {
+		return
+	}
+	if attrs.DirectMail != nil {
+		if err = encodeJSONElement(e, "DirectMail", attrs.DirectMail); err != nil {
+			return
+		}
+	}
+	if attrs.DirectSMS != nil {
+		if err = encodeJSONElement(e, "DirectSMS", attrs.DirectSMS); err != nil {
+			return
+		}
+	}
+	if attrs.Push != nil {
+		if err = encodeJSONElement(e, "Push", attrs.Push); err != nil {
+			return
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeJSONElement 把 v 编码为 JSON 字符串, 作为名称为 name 的元素的内容.
+func encodeJSONElement(e *xml.Encoder, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(string(b), xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+// MailAddressType 是邮件发信地址的类型.
+type MailAddressType int
+
+const (
+	MailAddressTypeRandom  MailAddressType = 0 // 随机账号
+	MailAddressTypeAccount MailAddressType = 1 // 发信地址, 即 AccountName
+)
+
+// MailAttributes 是推送到邮件 (DirectMail) 的消息属性, 消息体为邮件正文.
+type MailAttributes struct {
+	AccountName    string          // 发信地址, 必须是在邮件推送控制台配置的发信地址
+	Subject        string          // 邮件主题
+	AddressType    MailAddressType // 默认为 MailAddressTypeRandom
+	IsHtml         bool            // 邮件正文是否为 HTML
+	ReplyToAddress bool            // 是否使用控制台配置的回信地址
+}
+
+// Validate 校验必填的字段.
+func (attrs MailAttributes) Validate() error {
+	switch {
+	case attrs.AccountName == "":
+		return errors.New("the DirectMail.AccountName must not be empty")
+	case attrs.Subject == "":
+		return errors.New("the DirectMail.Subject must not be empty")
+	case attrs.AddressType != MailAddressTypeRandom && attrs.AddressType != MailAddressTypeAccount:
+		return fmt.Errorf("invalid DirectMail.AddressType %d", attrs.AddressType)
+	}
+	return nil
+}
+
+func (attrs MailAttributes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		AccountName    string `json:"AccountName"`
+		Subject        string `json:"Subject"`
+		AddressType    int    `json:"AddressType"`
+		IsHtml         int    `json:"IsHtml"`
+		ReplyToAddress int    `json:"ReplyToAddress"`
+	}{
+		AccountName:    attrs.AccountName,
+		Subject:        attrs.Subject,
+		AddressType:    int(attrs.AddressType),
+		IsHtml:         boolToInt(attrs.IsHtml),
+		ReplyToAddress: boolToInt(attrs.ReplyToAddress),
+	})
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// SMSType 是短信的发送方式.
+type SMSType string
+
+const (
+	SMSTypeSingleContent SMSType = "singleContent" // 所有的接收者使用相同的 SmsParams
+	SMSTypeMultiContent  SMSType = "multiContent"  // 每个接收者使用不同的参数, 见 SMSAttributes.MultiSmsParams
+)
+
+// SMSAttributes 是推送到短信 (DirectSMS) 的消息属性.
+type SMSAttributes struct {
+	FreeSignName string  // 短信签名
+	TemplateCode string  // 短信模板的 ID
+	Type         SMSType // 默认为 SMSTypeSingleContent
+
+	// 以下字段用于 SMSTypeSingleContent
+	Receiver  string            // 接收短信的手机号码, 多个号码用逗号分隔; 订阅的 Endpoint 为 sms:directsms:{Phone} 时可以为空
+	SmsParams map[string]string // 短信模板中的变量
+
+	// 以下字段用于 SMSTypeMultiContent
+	MultiSmsParams map[string]map[string]string // map[手机号码]短信模板中的变量
+}
+
+// Validate 校验必填的字段.
+func (attrs SMSAttributes) Validate() error {
+	switch {
+	case attrs.FreeSignName == "":
+		return errors.New("the DirectSMS.FreeSignName must not be empty")
+	case attrs.TemplateCode == "":
+		return errors.New("the DirectSMS.TemplateCode must not be empty")
+	}
+	switch attrs.Type {
+	case "", SMSTypeSingleContent:
+		if len(attrs.MultiSmsParams) > 0 {
+			return errors.New("the DirectSMS.MultiSmsParams must be empty when the Type is singleContent")
+		}
+	case SMSTypeMultiContent:
+		if len(attrs.MultiSmsParams) == 0 {
+			return errors.New("the DirectSMS.MultiSmsParams must not be empty when the Type is multiContent")
+		}
+		if attrs.Receiver != "" || len(attrs.SmsParams) > 0 {
+			return errors.New("the DirectSMS.Receiver and SmsParams must be empty when the Type is multiContent")
+		}
+	default:
+		return fmt.Errorf("invalid DirectSMS.Type %s", attrs.Type)
+	}
+	return nil
+}
+
+// MarshalJSON 和 MNS 一样把 SmsParams 编码为 JSON 字符串.
+func (attrs SMSAttributes) MarshalJSON() ([]byte, error) {
+	smsType := attrs.Type
+	if smsType == "" {
+		smsType = SMSTypeSingleContent
+	}
+	var params interface{} = attrs.SmsParams
+	if smsType == SMSTypeMultiContent {
+		params = attrs.MultiSmsParams
+	}
+	smsParams := "{}"
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		smsParams = string(b)
+	}
+	return json.Marshal(struct {
+		FreeSignName string  `json:"FreeSignName"`
+		TemplateCode string  `json:"TemplateCode"`
+		Type         SMSType `json:"Type"`
+		Receiver     string  `json:"Receiver,omitempty"`
+		SmsParams    string  `json:"SmsParams"`
+	}{
+		FreeSignName: attrs.FreeSignName,
+		TemplateCode: attrs.TemplateCode,
+		Type:         smsType,
+		Receiver:     attrs.Receiver,
+		SmsParams:    smsParams,
+	})
+}
+
+// PushAttributes 是推送到移动推送的消息属性, 字段和移动推送的 Push 接口的参数相同.
+type PushAttributes struct {
+	Target      string // DEVICE, ACCOUNT, ALIAS, TAG 或者 ALL
+	TargetValue string // 和 Target 对应的设备, 账号, 别名或者标签, 多个用逗号分隔; Target 为 ALL 时为空
+	DeviceType  string // ANDROID, iOS 或者 ALL
+	PushType    string // MESSAGE 或者 NOTICE
+	Title       string
+	Body        string
+
+	Params map[string]string // 其他的参数, 比如 iOSBadge, AndroidOpenType, 和上面的字段一起编码到 JSON 中
+}
+
+// Validate 校验必填的字段.
+func (attrs PushAttributes) Validate() error {
+	switch attrs.Target {
+	case "DEVICE", "ACCOUNT", "ALIAS", "TAG":
+		if attrs.TargetValue == "" {
+			return errors.New("the Push.TargetValue must not be empty")
+		}
+	case "ALL":
+	default:
+		return fmt.Errorf("invalid Push.Target %q", attrs.Target)
+	}
+	switch attrs.DeviceType {
+	case "ANDROID", "iOS", "ALL":
+	default:
+		return fmt.Errorf("invalid Push.DeviceType %q", attrs.DeviceType)
+	}
+	switch attrs.PushType {
+	case "MESSAGE", "NOTICE":
+	default:
+		return fmt.Errorf("invalid Push.PushType %q", attrs.PushType)
+	}
+	return nil
+}
+
+func (attrs PushAttributes) MarshalJSON() ([]byte, error) {
+	m := make(map[string]string, len(attrs.Params)+6)
+	for k, v := range attrs.Params {
+		m[k] = v
+	}
+	m["Target"] = attrs.Target
+	if attrs.TargetValue != "" {
+		m["TargetValue"] = attrs.TargetValue
+	}
+	m["DeviceType"] = attrs.DeviceType
+	m["PushType"] = attrs.PushType
+	if attrs.Title != "" {
+		m["Title"] = attrs.Title
+	}
+	if attrs.Body != "" {
+		m["Body"] = attrs.Body
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,99 @@
+package topic
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestMessageAttributesMarshalXML(t *testing.T) {
+	msg := &PublishMessageRequest{
+		MessageBody: []byte("body"),
+		MessageAttributes: &MessageAttributes{
+			DirectMail: &MailAttributes{AccountName: "sender@example.com", Subject: "subject", AddressType: MailAddressTypeAccount, IsHtml: true},
+			DirectSMS:  &SMSAttributes{FreeSignName: "sign", TemplateCode: "SMS_1", Receiver: "13800000000", SmsParams: map[string]string{"code": "1234"}},
+		},
+	}
+	b, err := xml.Marshal(msg)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	want := `<Message><MessageBody>body</MessageBody><MessageAttributes>` +
+		`<DirectMail>{&#34;AccountName&#34;:&#34;sender@example.com&#34;,&#34;Subject&#34;:&#34;subject&#34;,&#34;AddressType&#34;:1,&#34;IsHtml&#34;:1,&#34;ReplyToAddress&#34;:0}</DirectMail>` +
+		`<DirectSMS>{&#34;FreeSignName&#34;:&#34;sign&#34;,&#34;TemplateCode&#34;:&#34;SMS_1&#34;,&#34;Type&#34;:&#34;singleContent&#34;,&#34;Receiver&#34;:&#34;13800000000&#34;,&#34;SmsParams&#34;:&#34;{\&#34;code\&#34;:\&#34;1234\&#34;}&#34;}</DirectSMS>` +
+		`</MessageAttributes></Message>`
+	if have := string(b); have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+
+	// MessageAttributes 的值和指针的编码相同
+	msg.MessageAttributes = *msg.MessageAttributes.(*MessageAttributes)
+	if b, err = xml.Marshal(msg); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have := string(b); have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+
+	// interface{} 的其他值原样编码
+	msg.MessageAttributes = struct {
+		Custom string `xml:"Custom"`
+	}{"value"}
+	if b, err = xml.Marshal(msg); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if have, want := string(b), `<Message><MessageBody>body</MessageBody><MessageAttributes><Custom>value</Custom></MessageAttributes></Message>`; have != want {
+		t.Errorf("have:%s, want:%s", have, want)
+		return
+	}
+}
+
+func TestMessageAttributesValidate(t *testing.T) {
+	tests := []struct {
+		attrs *MessageAttributes
+		valid bool
+	}{
+		{&MessageAttributes{}, false},
+		{&MessageAttributes{DirectMail: &MailAttributes{AccountName: "sender@example.com", Subject: "subject"}}, true},
+		{&MessageAttributes{DirectMail: &MailAttributes{AccountName: "sender@example.com"}}, false},
+		{&MessageAttributes{DirectMail: &MailAttributes{AccountName: "sender@example.com", Subject: "subject", AddressType: 2}}, false},
+		{&MessageAttributes{DirectSMS: &SMSAttributes{FreeSignName: "sign", TemplateCode: "SMS_1"}}, true},
+		{&MessageAttributes{DirectSMS: &SMSAttributes{FreeSignName: "sign"}}, false},
+		{&MessageAttributes{DirectSMS: &SMSAttributes{FreeSignName: "sign", TemplateCode: "SMS_1", Type: SMSTypeMultiContent}}, false},
+		{&MessageAttributes{DirectSMS: &SMSAttributes{FreeSignName: "sign", TemplateCode: "SMS_1", Type: SMSTypeMultiContent, MultiSmsParams: map[string]map[string]string{"13800000000": {"code": "1234"}}}}, true},
+		{&MessageAttributes{DirectSMS: &SMSAttributes{FreeSignName: "sign", TemplateCode: "SMS_1", Type: "other"}}, false},
+		{&MessageAttributes{Push: &PushAttributes{Target: "ALL", DeviceType: "ALL", PushType: "NOTICE"}}, true},
+		{&MessageAttributes{Push: &PushAttributes{Target: "DEVICE", DeviceType: "ALL", PushType: "NOTICE"}}, false},
+		{&MessageAttributes{Push: &PushAttributes{Target: "ALL", DeviceType: "ALL"}}, false},
+	}
+	for i, v := range tests {
+		if err := v.attrs.Validate(); (err == nil) != v.valid {
+			t.Errorf("%d: have:%v, want valid:%v", i, err, v.valid)
+			return
+		}
+	}
+
+	// PublishMessage 在发送之前校验
+	_, _, err := New("http://127.0.0.1:1", "test", mns.Config{}).PublishMessage(&PublishMessageRequest{
+		MessageBody:       []byte("body"),
+		MessageAttributes: &MessageAttributes{DirectMail: &MailAttributes{}},
+	})
+	if err == nil || err.Error() != "the DirectMail.AccountName must not be empty" {
+		t.Errorf("have:%v, want:%s", err, "the DirectMail.AccountName must not be empty")
+		return
+	}
+	_, _, err = New("http://127.0.0.1:1", "test", mns.Config{}).PublishMessage(&PublishMessageRequest{
+		MessageBody:       []byte("body"),
+		MessageAttributes: MessageAttributes{DirectSMS: &SMSAttributes{}},
+	})
+	if err == nil || err.Error() != "the DirectSMS.FreeSignName must not be empty" {
+		t.Errorf("have:%v, want:%s", err, "the DirectSMS.FreeSignName must not be empty")
+		return
+	}
+}
@@ -0,0 +1,124 @@
+package topic
+
+import (
+	"context"
+	"sync"
+)
+
+// MockAPI 是 API 的 mock 实现, 用于测试.
+//
+// 调用 XxxContext 时记录调用并执行对应的 XxxContextFunc, XxxContextFunc 为 nil 时 panic.
+type MockAPI struct {
+	PublishMessageContextFunc            func(ctx context.Context, msg *PublishMessageRequest) (requestId string, resp *PublishMessageResponse, err error)
+	CreateTopicContextFunc               func(ctx context.Context, attrs *TopicAttributes) (requestId string, err error)
+	SetTopicAttributesContextFunc        func(ctx context.Context, attrs *TopicAttributes) (requestId string, err error)
+	GetTopicAttributesContextFunc        func(ctx context.Context) (requestId string, resp *GetTopicAttributesResponse, err error)
+	DeleteTopicContextFunc               func(ctx context.Context) (requestId string, err error)
+	SubscribeContextFunc                 func(ctx context.Context, subscription string, req *SubscribeRequest) (requestId string, err error)
+	UnsubscribeContextFunc               func(ctx context.Context, subscription string) (requestId string, err error)
+	SetSubscriptionAttributesContextFunc func(ctx context.Context, subscription string, attrs *SubscriptionAttributes) (requestId string, err error)
+	GetSubscriptionAttributesContextFunc func(ctx context.Context, subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error)
+	ListSubscriptionByTopicContextFunc   func(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error)
+
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+// MockCall 是 MockAPI 的一次调用.
+type MockCall struct {
+	Method string        // 方法名, 比如 PublishMessageContext
+	Args   []interface{} // 除了 ctx 之外的参数
+}
+
+// Calls 按照调用的顺序返回所有的调用.
+func (m *MockAPI) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+func (m *MockAPI) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Method: method, Args: args})
+	m.mu.Unlock()
+}
+
+func (m *MockAPI) PublishMessageContext(ctx context.Context, msg *PublishMessageRequest) (requestId string, resp *PublishMessageResponse, err error) {
+	m.record("PublishMessageContext", msg)
+	if m.PublishMessageContextFunc == nil {
+		panic("topic: MockAPI.PublishMessageContextFunc is nil")
+	}
+	return m.PublishMessageContextFunc(ctx, msg)
+}
+
+func (m *MockAPI) CreateTopicContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	m.record("CreateTopicContext", attrs)
+	if m.CreateTopicContextFunc == nil {
+		panic("topic: MockAPI.CreateTopicContextFunc is nil")
+	}
+	return m.CreateTopicContextFunc(ctx, attrs)
+}
+
+func (m *MockAPI) SetTopicAttributesContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	m.record("SetTopicAttributesContext", attrs)
+	if m.SetTopicAttributesContextFunc == nil {
+		panic("topic: MockAPI.SetTopicAttributesContextFunc is nil")
+	}
+	return m.SetTopicAttributesContextFunc(ctx, attrs)
+}
+
+func (m *MockAPI) GetTopicAttributesContext(ctx context.Context) (requestId string, resp *GetTopicAttributesResponse, err error) {
+	m.record("GetTopicAttributesContext")
+	if m.GetTopicAttributesContextFunc == nil {
+		panic("topic: MockAPI.GetTopicAttributesContextFunc is nil")
+	}
+	return m.GetTopicAttributesContextFunc(ctx)
+}
+
+func (m *MockAPI) DeleteTopicContext(ctx context.Context) (requestId string, err error) {
+	m.record("DeleteTopicContext")
+	if m.DeleteTopicContextFunc == nil {
+		panic("topic: MockAPI.DeleteTopicContextFunc is nil")
+	}
+	return m.DeleteTopicContextFunc(ctx)
+}
+
+func (m *MockAPI) SubscribeContext(ctx context.Context, subscription string, req *SubscribeRequest) (requestId string, err error) {
+	m.record("SubscribeContext", subscription, req)
+	if m.SubscribeContextFunc == nil {
+		panic("topic: MockAPI.SubscribeContextFunc is nil")
+	}
+	return m.SubscribeContextFunc(ctx, subscription, req)
+}
+
+func (m *MockAPI) UnsubscribeContext(ctx context.Context, subscription string) (requestId string, err error) {
+	m.record("UnsubscribeContext", subscription)
+	if m.UnsubscribeContextFunc == nil {
+		panic("topic: MockAPI.UnsubscribeContextFunc is nil")
+	}
+	return m.UnsubscribeContextFunc(ctx, subscription)
+}
+
+func (m *MockAPI) SetSubscriptionAttributesContext(ctx context.Context, subscription string, attrs *SubscriptionAttributes) (requestId string, err error) {
+	m.record("SetSubscriptionAttributesContext", subscription, attrs)
+	if m.SetSubscriptionAttributesContextFunc == nil {
+		panic("topic: MockAPI.SetSubscriptionAttributesContextFunc is nil")
+	}
+	return m.SetSubscriptionAttributesContextFunc(ctx, subscription, attrs)
+}
+
+func (m *MockAPI) GetSubscriptionAttributesContext(ctx context.Context, subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error) {
+	m.record("GetSubscriptionAttributesContext", subscription)
+	if m.GetSubscriptionAttributesContextFunc == nil {
+		panic("topic: MockAPI.GetSubscriptionAttributesContextFunc is nil")
+	}
+	return m.GetSubscriptionAttributesContextFunc(ctx, subscription)
+}
+
+func (m *MockAPI) ListSubscriptionByTopicContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error) {
+	m.record("ListSubscriptionByTopicContext", prefix, marker, retNumber)
+	if m.ListSubscriptionByTopicContextFunc == nil {
+		panic("topic: MockAPI.ListSubscriptionByTopicContextFunc is nil")
+	}
+	return m.ListSubscriptionByTopicContextFunc(ctx, prefix, marker, retNumber)
+}
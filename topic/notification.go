@@ -0,0 +1,53 @@
+package topic
+
+import "github.com/chanxuehong/mns.aliyun.v20150606/internal"
+
+// Notification 是主题推送给 HTTP Endpoint 或者队列的消息, 见 DecodeNotification.
+type Notification struct {
+	XMLName struct{} `xml:"Notification" json:"-"`
+
+	Format NotifyContentFormat `xml:"-" json:"-"` // 解码时识别出的格式, SIMPLIFIED 格式只有 Message 字段
+
+	TopicOwner       string `xml:"TopicOwner" json:"TopicOwner"` // 主题所有者的 AccountId
+	TopicName        string `xml:"TopicName" json:"TopicName"`
+	Subscriber       string `xml:"Subscriber" json:"Subscriber"` // 订阅者的 AccountId
+	SubscriptionName string `xml:"SubscriptionName" json:"SubscriptionName"`
+	MessageId        string `xml:"MessageId" json:"MessageId"`
+	MessageMD5       string `xml:"MessageMD5" json:"MessageMD5"` // Message 的 MD5, 大写的 hex
+	MessageTag       string `xml:"MessageTag" json:"MessageTag"`
+	PublishTime      int64  `xml:"PublishTime" json:"PublishTime"` // 消息的发布时间, 从 1970-1-1 00:00:00 到现在的毫秒值
+	Message          []byte `xml:"Message" json:"-"`               // 消息体
+}
+
+// DecodeNotification 解码主题推送的消息, 自动识别订阅的 NotifyContentFormat:
+//  XML:        根元素为 Notification 并且包含 MessageId
+//  JSON:       JSON 对象并且包含 MessageId
+//  SIMPLIFIED: 其他的内容, body 即发布的消息
+// 所以 SIMPLIFIED 格式的订阅不要发布和 XML, JSON 格式的通知相同结构的消息.
+//
+// XML 和 JSON 格式的消息会校验 MessageMD5, 和接收队列消息时一样, 不一致时返回错误.
+// base64Enabled 和发布消息的 mns.Config.Base64Enabled 一致, 为 true 时 Message 在校验之后被 base64 解码,
+// 并且 MessageMD5 更新为解码之后的 MD5, 和 queue.Queue 接收消息的行为相同.
+func DecodeNotification(body []byte, base64Enabled bool) (n *Notification, err error) {
+	v, err := internal.DecodeNotification(body, base64Enabled)
+	if err != nil {
+		return nil, err
+	}
+	return &Notification{
+		Format:           NotifyContentFormat(v.Format),
+		TopicOwner:       v.TopicOwner,
+		TopicName:        v.TopicName,
+		Subscriber:       v.Subscriber,
+		SubscriptionName: v.SubscriptionName,
+		MessageId:        v.MessageId,
+		MessageMD5:       v.MessageMD5,
+		MessageTag:       v.MessageTag,
+		PublishTime:      v.PublishTime,
+		Message:          v.Message,
+	}, nil
+}
+
+// DecodeNotification 使用 t 的 Base64Enabled 解码主题推送的消息, 见 DecodeNotification.
+func (t *Topic) DecodeNotification(body []byte) (n *Notification, err error) {
+	return DecodeNotification(body, t.config.Base64Enabled)
+}
@@ -0,0 +1,61 @@
+package topic
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+func TestDecodeNotification(t *testing.T) {
+	const md5Hello = "5D41402ABC4B2A76B9719D911017C592"
+	encoded := base64.StdEncoding.EncodeToString([]byte("hello"))
+	md5Encoded := internal.MessageBodyMD5([]byte(encoded))
+
+	tests := []struct {
+		name          string
+		body          string
+		base64Enabled bool
+		format        NotifyContentFormat
+	}{
+		{"xml", testNotification, false, NotifyContentFormatXML},
+		{"json", `{"TopicOwner":"1234567890123456","TopicName":"test","Subscriber":"1234567890123456","SubscriptionName":"http","MessageId":"0000000000000001","MessageMD5":"` + md5Hello + `","MessageTag":"tag","Message":"hello","PublishTime":1449556920117}`, false, NotifyContentFormatJSON},
+		{"json base64", `{"TopicName":"test","MessageId":"0000000000000001","MessageMD5":"` + md5Encoded + `","Message":"` + encoded + `"}`, true, NotifyContentFormatJSON},
+		{"simplified", "hello", false, NotifyContentFormatSimplified},
+		{"simplified base64", encoded, true, NotifyContentFormatSimplified},
+	}
+	for _, v := range tests {
+		n, err := DecodeNotification([]byte(v.body), v.base64Enabled)
+		if err != nil {
+			t.Errorf("%s: %s", v.name, err.Error())
+			return
+		}
+		if n.Format != v.format || string(n.Message) != "hello" {
+			t.Errorf("%s: have:%s/%q, want:%s/%q", v.name, n.Format, n.Message, v.format, "hello")
+			return
+		}
+		if v.format != NotifyContentFormatSimplified && (n.MessageId != "0000000000000001" || n.TopicName != "test" || n.MessageMD5 != md5Hello) {
+			t.Errorf("%s: unexpected notification: %+v", v.name, n)
+			return
+		}
+	}
+
+	// 消息体是 JSON 或者 XML, 但是不是 Notification
+	for _, body := range []string{`{"key":"value"}`, `<?xml version="1.0"?><Order><Id>1</Id></Order>`} {
+		n, err := DecodeNotification([]byte(body), false)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if n.Format != NotifyContentFormatSimplified || string(n.Message) != body {
+			t.Errorf("have:%s/%q, want:%s/%q", n.Format, n.Message, NotifyContentFormatSimplified, body)
+			return
+		}
+	}
+
+	_, err := DecodeNotification([]byte(`{"MessageId":"1","MessageMD5":"00000000000000000000000000000000","Message":"hello"}`), false)
+	if _, ok := err.(*internal.MessageBodyMD5MismatchError); !ok {
+		t.Errorf("have:%T, want:%T", err, &internal.MessageBodyMD5MismatchError{})
+		return
+	}
+}
@@ -0,0 +1,261 @@
+package topic
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// NotificationHandler 处理主题推送的消息.
+//
+// 返回 nil 表示处理成功, PushHandler 返回 2xx; 返回错误时 PushHandler 返回 5xx, MNS 按照订阅的 NotifyStrategy 重试.
+type NotificationHandler interface {
+	HandleNotification(ctx context.Context, n *Notification) error
+}
+
+// NotificationHandlerFunc 把普通函数适配成 NotificationHandler.
+type NotificationHandlerFunc func(ctx context.Context, n *Notification) error
+
+func (fn NotificationHandlerFunc) HandleNotification(ctx context.Context, n *Notification) error {
+	return fn(ctx, n)
+}
+
+type PushHandlerConfig struct {
+	// Roots 是签名证书的信任根, 签名证书必须是 Roots 中的证书或者由 Roots 中的证书签发, 不使用系统的根证书.
+	// MNS 的签名证书是自签名的证书, 把它加入到 Roots 即固定了证书.
+	Roots *x509.CertPool
+
+	// following is optional
+
+	// CertHosts 是允许的 x-mns-signing-cert-url 的 host, 必须完全相同, 不支持通配符,
+	// 默认为 MNS 存放签名证书的 mnstest.oss-cn-hangzhou.aliyuncs.com, 不在 CertHosts 中的证书地址不会被请求, 推送请求返回 403.
+	CertHosts []string
+
+	// AllowHTTP 为 true 时允许 http 的证书地址, 默认只允许 https, 比如测试时接收 mns-local 的推送.
+	AllowHTTP bool
+
+	// MaxClockSkew 是推送请求的 Date 和当前时间的最大差值, 超过时推送请求返回 403, 防止截获的请求被重放, 默认为 15 分钟.
+	MaxClockSkew time.Duration
+
+	Base64Enabled bool // 发布消息的 mns.Config.Base64Enabled 为 true 时设置为 true, 见 DecodeNotification
+
+	HttpClient  *http.Client                     // 下载证书的 http.Client, 默认为超时 10 秒的 http.Client
+	MaxBodySize int64                            // 推送请求的请求体的最大字节数, 默认为 1MB
+	OnError     func(r *http.Request, err error) // 推送请求验证失败, 解码失败或者 NotificationHandler 返回错误时调用
+}
+
+const (
+	defaultPushCertHost     = "mnstest.oss-cn-hangzhou.aliyuncs.com"
+	defaultPushMaxClockSkew = 15 * time.Minute
+	defaultPushMaxBodySize  = 1 << 20
+	maxPushCerts            = 16 // 缓存的证书的最大个数
+)
+
+// PushHandler 是接收主题推送消息的 HTTP Endpoint, 实现了 http.Handler.
+//
+// PushHandler 通过 x-mns-signing-cert-url 下载证书, 使用 Roots 验证证书之后缓存, 使用证书的公钥验证 Authorization 中的 SHA1withRSA 签名,
+// 签名的原文和请求 MNS 时的签名原文格式相同, 验证通过并且 Date 没有过期之后用 DecodeNotification 解码消息并调用 NotificationHandler.
+//
+//  roots := x509.NewCertPool()
+//  roots.AppendCertsFromPEM(mnsSigningCertPEM) // MNS 的签名证书
+//  http.Handle("/notify", topic.NewPushHandler(topic.NotificationHandlerFunc(fn), &topic.PushHandlerConfig{Roots: roots}))
+type PushHandler struct {
+	handler NotificationHandler
+	config  PushHandlerConfig
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate // map[certURL]*x509.Certificate, certURL 不包含 query, 最多 maxPushCerts 个
+}
+
+// NewPushHandler 创建 PushHandler, config.Roots 不能为 nil, 否则 panic.
+func NewPushHandler(handler NotificationHandler, config *PushHandlerConfig) *PushHandler {
+	if config == nil || config.Roots == nil {
+		panic("nil PushHandlerConfig.Roots")
+	}
+	h := &PushHandler{
+		handler: handler,
+		config:  *config,
+		certs:   make(map[string]*x509.Certificate),
+	}
+	if len(h.config.CertHosts) == 0 {
+		h.config.CertHosts = []string{defaultPushCertHost}
+	}
+	if h.config.MaxClockSkew <= 0 {
+		h.config.MaxClockSkew = defaultPushMaxClockSkew
+	}
+	if h.config.HttpClient == nil {
+		h.config.HttpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if h.config.MaxBodySize <= 0 {
+		h.config.MaxBodySize = defaultPushMaxBodySize
+	}
+	return h
+}
+
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.fail(w, r, http.StatusMethodNotAllowed, fmt.Errorf("unsupported http method %s", r.Method))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.config.MaxBodySize+1))
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if int64(len(body)) > h.config.MaxBodySize {
+		h.fail(w, r, http.StatusRequestEntityTooLarge, errors.New("the request body is too large"))
+		return
+	}
+	if statusCode, err := h.verify(r, body); err != nil {
+		h.fail(w, r, statusCode, err)
+		return
+	}
+
+	n, err := DecodeNotification(body, h.config.Base64Enabled)
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = h.handler.HandleNotification(r.Context(), n); err != nil {
+		h.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PushHandler) fail(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	if h.config.OnError != nil {
+		h.config.OnError(r, err)
+	}
+	http.Error(w, http.StatusText(statusCode), statusCode)
+}
+
+// verify 验证推送请求的签名, 返回错误时 statusCode 是应该返回给 MNS 的状态码.
+func (h *PushHandler) verify(r *http.Request, body []byte) (statusCode int, err error) {
+	if contentMD5 := r.Header.Get("Content-Md5"); contentMD5 != "" && contentMD5 != internal.ContentMD5(body) {
+		return http.StatusBadRequest, errors.New("the Content-Md5 does not match the request body")
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("Authorization"))
+	if err != nil || len(signature) == 0 {
+		return http.StatusForbidden, errors.New("invalid Authorization")
+	}
+	rawCertURL, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Mns-Signing-Cert-Url"))
+	if err != nil || len(rawCertURL) == 0 {
+		return http.StatusForbidden, errors.New("invalid X-Mns-Signing-Cert-Url")
+	}
+	certURL, err := h.checkCertURL(string(rawCertURL))
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	cert, err := h.certificate(r.Context(), certURL)
+	if err != nil {
+		if errors.Is(err, errUntrustedCert) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusServiceUnavailable, err // 下载证书失败时让 MNS 重试
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return http.StatusForbidden, errors.New("the signing certificate does not contain a RSA public key")
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return http.StatusForbidden, errors.New("the signing certificate has expired or is not yet valid")
+	}
+	digest := sha1.Sum(internal.StringToSign(r.Method, r.Header, r.URL.RequestURI()))
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA1, digest[:], signature); err != nil {
+		return http.StatusForbidden, errors.New("the signature does not match")
+	}
+	// Date 参与了签名, 不能被修改
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return http.StatusForbidden, errors.New("invalid Date")
+	}
+	if skew := time.Since(date); skew > h.config.MaxClockSkew || skew < -h.config.MaxClockSkew {
+		return http.StatusForbidden, fmt.Errorf("the Date %s is out of the allowed clock skew %v", r.Header.Get("Date"), h.config.MaxClockSkew)
+	}
+	return 0, nil
+}
+
+// checkCertURL 检查证书地址的 scheme 和 host 是否被允许, 返回去掉 query 和 fragment 的证书地址, 作为下载和缓存的地址.
+func (h *PushHandler) checkCertURL(rawCertURL string) (certURL string, err error) {
+	u, err := url.Parse(rawCertURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && h.config.AllowHTTP) {
+		return "", fmt.Errorf("the signing certificate url %s is not allowed", rawCertURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range h.config.CertHosts {
+		if host == strings.ToLower(allowed) {
+			u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+			return u.String(), nil
+		}
+	}
+	return "", fmt.Errorf("the signing certificate url %s is not allowed", rawCertURL)
+}
+
+var errUntrustedCert = errors.New("untrusted signing certificate")
+
+// certificate 返回 certURL 的证书, 下载并且通过 Roots 验证的证书会被缓存.
+func (h *PushHandler) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	h.mu.Lock()
+	cert := h.certs[certURL]
+	h.mu.Unlock()
+	if cert != nil {
+		return cert, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.config.HttpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get signing certificate %s: http status code %d", certURL, resp.StatusCode)
+	}
+	certPEM, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("get signing certificate %s: invalid PEM", certURL)
+	}
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, err
+	}
+	if _, err = cert.Verify(x509.VerifyOptions{Roots: h.config.Roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", errUntrustedCert, certURL, err)
+	}
+
+	h.mu.Lock()
+	if len(h.certs) >= maxPushCerts {
+		for k := range h.certs {
+			delete(h.certs, k)
+			break
+		}
+	}
+	h.certs[certURL] = cert
+	h.mu.Unlock()
+	return cert, nil
+}
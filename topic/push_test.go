@@ -0,0 +1,246 @@
+package topic
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// newSigner 返回签名推送请求的函数 (请求中已经有 Date 或者 X-Mns-Signing-Cert-Url 时保留原来的值), 提供证书的测试服务器和只包含这个自签名证书的 CertPool.
+func newSigner(t *testing.T) (sign func(r *http.Request, body []byte), srv *httptest.Server, certRequests *int32, roots *x509.CertPool) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	roots = x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	certRequests = new(int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(certRequests, 1)
+		w.Write(certPEM)
+	}))
+
+	sign = func(r *http.Request, body []byte) {
+		r.Header.Set("Content-Md5", internal.ContentMD5(body))
+		r.Header.Set("Content-Type", internal.ContentType)
+		if r.Header.Get("Date") == "" {
+			r.Header.Set("Date", internal.FormatDate(time.Now()))
+		}
+		r.Header.Set("X-Mns-Request-Id", "request-id")
+		r.Header.Set("X-Mns-Version", internal.Version)
+		if r.Header.Get("X-Mns-Signing-Cert-Url") == "" {
+			r.Header.Set("X-Mns-Signing-Cert-Url", base64.StdEncoding.EncodeToString([]byte(srv.URL+"/cert.pem")))
+		}
+		digest := sha1.Sum(internal.StringToSign(r.Method, r.Header, r.URL.RequestURI()))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+		r.Header.Set("Authorization", base64.StdEncoding.EncodeToString(signature))
+	}
+	return
+}
+
+const testNotification = `<?xml version="1.0" encoding="UTF-8"?>
+<Notification xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <TopicOwner>1234567890123456</TopicOwner>
+  <TopicName>test</TopicName>
+  <Subscriber>1234567890123456</Subscriber>
+  <SubscriptionName>http</SubscriptionName>
+  <MessageId>0000000000000001</MessageId>
+  <MessageMD5>5D41402ABC4B2A76B9719D911017C592</MessageMD5>
+  <MessageTag>tag</MessageTag>
+  <Message>hello</Message>
+  <PublishTime>1449556920117</PublishTime>
+</Notification>`
+
+func TestPushHandler(t *testing.T) {
+	sign, certServer, certRequests, roots := newSigner(t)
+	defer certServer.Close()
+
+	var received []*Notification
+	var handleErr error
+	var errs []error
+	h := NewPushHandler(NotificationHandlerFunc(func(ctx context.Context, n *Notification) error {
+		received = append(received, n)
+		return handleErr
+	}), &PushHandlerConfig{
+		Roots:     roots,
+		CertHosts: []string{"127.0.0.1"},
+		AllowHTTP: true,
+		OnError:   func(r *http.Request, err error) { errs = append(errs, err) },
+	})
+
+	// prepare 在签名之前修改请求, mutate 在签名之后修改请求
+	pushWith := func(prepare, mutate func(r *http.Request)) int {
+		body := []byte(testNotification)
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/notify?a=b", bytes.NewReader(body))
+		if prepare != nil {
+			prepare(r)
+		}
+		sign(r, body)
+		if mutate != nil {
+			mutate(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	push := func(mutate func(r *http.Request)) int {
+		return pushWith(nil, mutate)
+	}
+
+	for i := 0; i < 2; i++ {
+		if have, want := push(nil), http.StatusNoContent; have != want {
+			t.Errorf("have:%d, want:%d, errors:%v", have, want, errs)
+			return
+		}
+	}
+	// 证书地址的 query 不同时使用同一个缓存, 不会重新下载
+	if have, want := pushWith(func(r *http.Request) {
+		r.Header.Set("X-Mns-Signing-Cert-Url", base64.StdEncoding.EncodeToString([]byte(certServer.URL+"/cert.pem?x=1")))
+	}, nil), http.StatusNoContent; have != want {
+		t.Errorf("have:%d, want:%d, errors:%v", have, want, errs)
+		return
+	}
+	if have, want := atomic.LoadInt32(certRequests), int32(1); have != want {
+		t.Errorf("the certificate should be cached, have:%d, want:%d", have, want)
+		return
+	}
+	n := received[0]
+	if n.TopicName != "test" || n.SubscriptionName != "http" || n.MessageId != "0000000000000001" || n.MessageTag != "tag" || string(n.Message) != "hello" || n.PublishTime != 1449556920117 {
+		t.Errorf("unexpected notification: %+v", n)
+		return
+	}
+
+	// handler 返回错误时返回 5xx, MNS 会重试
+	handleErr = errors.New("test")
+	if have, want := push(nil), http.StatusInternalServerError; have != want {
+		t.Errorf("have:%d, want:%d", have, want)
+		return
+	}
+	handleErr = nil
+
+	received = nil
+	tests := []struct {
+		name   string
+		mutate func(r *http.Request)
+		want   int
+	}{
+		{"tampered header", func(r *http.Request) { r.Header.Set("X-Mns-Request-Id", "other") }, http.StatusForbidden},
+		{"tampered path", func(r *http.Request) { r.URL.RawQuery = "a=c" }, http.StatusForbidden},
+		{"no signature", func(r *http.Request) { r.Header.Del("Authorization") }, http.StatusForbidden},
+		{"cert host not allowed", func(r *http.Request) {
+			r.Header.Set("X-Mns-Signing-Cert-Url", base64.StdEncoding.EncodeToString([]byte("http://evil.example.com/cert.pem")))
+		}, http.StatusForbidden},
+		{"get method", func(r *http.Request) { r.Method = http.MethodGet }, http.StatusMethodNotAllowed},
+	}
+	for _, v := range tests {
+		if have := push(v.mutate); have != v.want {
+			t.Errorf("%s: have:%d, want:%d", v.name, have, v.want)
+			return
+		}
+	}
+	// 过期的 Date, 比如截获之后重放的请求
+	if have, want := pushWith(func(r *http.Request) {
+		r.Header.Set("Date", internal.FormatDate(time.Now().Add(-time.Hour)))
+	}, nil), http.StatusForbidden; have != want {
+		t.Errorf("stale date: have:%d, want:%d", have, want)
+		return
+	}
+	if len(received) != 0 {
+		t.Errorf("the handler should not be called, have:%d", len(received))
+		return
+	}
+}
+
+func TestPushHandlerUntrustedCert(t *testing.T) {
+	sign, certServer, _, _ := newSigner(t)
+	defer certServer.Close()
+	_, _, _, otherRoots := newSigner(t)
+
+	var called bool
+	h := NewPushHandler(NotificationHandlerFunc(func(ctx context.Context, n *Notification) error {
+		called = true
+		return nil
+	}), &PushHandlerConfig{Roots: otherRoots, CertHosts: []string{"127.0.0.1"}, AllowHTTP: true}) // 不是 Roots 中的证书
+	body := []byte(testNotification)
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/notify", bytes.NewReader(body))
+	sign(r, body)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusForbidden; have != want {
+		t.Errorf("have:%d, want:%d", have, want)
+		return
+	}
+	if called {
+		t.Error("the handler should not be called")
+		return
+	}
+}
+
+// 没有 Roots 时不能回退到系统的根证书, NewPushHandler panic.
+func TestPushHandlerRequiresRoots(t *testing.T) {
+	for _, config := range []*PushHandlerConfig{nil, {CertHosts: []string{"127.0.0.1"}}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewPushHandler(%+v) should panic", config)
+				}
+			}()
+			NewPushHandler(nil, config)
+		}()
+	}
+}
+
+func TestPushHandlerCheckCertURL(t *testing.T) {
+	// 默认的配置
+	h := NewPushHandler(nil, &PushHandlerConfig{Roots: x509.NewCertPool()})
+	tests := []struct {
+		certURL   string
+		allowHTTP bool
+		want      string // 为空表示不允许
+	}{
+		{"https://mnstest.oss-cn-hangzhou.aliyuncs.com/x509_public_certificate.pem", false, "https://mnstest.oss-cn-hangzhou.aliyuncs.com/x509_public_certificate.pem"},
+		{"https://MNSTEST.oss-cn-hangzhou.aliyuncs.com/cert.pem?x=1#y", false, "https://MNSTEST.oss-cn-hangzhou.aliyuncs.com/cert.pem"},
+		{"https://evil.oss-cn-hangzhou.aliyuncs.com/cert.pem", false, ""},
+		{"https://aliyuncs.com/cert.pem", false, ""},
+		{"ftp://mnstest.oss-cn-hangzhou.aliyuncs.com/cert.pem", false, ""},
+		{"http://mnstest.oss-cn-hangzhou.aliyuncs.com/cert.pem", false, ""},
+		{"http://mnstest.oss-cn-hangzhou.aliyuncs.com/cert.pem", true, "http://mnstest.oss-cn-hangzhou.aliyuncs.com/cert.pem"},
+		{"ftp://mnstest.oss-cn-hangzhou.aliyuncs.com/cert.pem", true, ""},
+	}
+	for _, v := range tests {
+		h.config.AllowHTTP = v.allowHTTP
+		have, err := h.checkCertURL(v.certURL)
+		if (err == nil) != (v.want != "") || have != v.want {
+			t.Errorf("%s: have:%q, %v, want:%q", v.certURL, have, err, v.want)
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package topic
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606/internal"
+)
+
+// Endpoint 是订阅的接收端地址, 可以用下面的函数构造:
+//  HttpEndpoint:  http://host/path
+//  QueueEndpoint: acs:mns:{REGION}:{AccountID}:queues/{QueueName}
+//  MailEndpoint:  mail:directmail:{MailAddress}
+//  SMSEndpoint:   sms:directsms:anonymous 或者 sms:directsms:{Phone}
+type Endpoint string
+
+// HttpEndpoint 返回推送到 HTTP 服务器的 Endpoint, rawurl 必须以 http:// 开头.
+func HttpEndpoint(rawurl string) Endpoint {
+	return Endpoint(rawurl)
+}
+
+// QueueEndpoint 返回推送到队列的 Endpoint.
+func QueueEndpoint(region, accountId, queue string) Endpoint {
+	return Endpoint("acs:mns:" + region + ":" + accountId + ":queues/" + queue)
+}
+
+// MailEndpoint 返回推送到邮箱的 Endpoint.
+func MailEndpoint(address string) Endpoint {
+	return Endpoint("mail:directmail:" + address)
+}
+
+// SMSEndpoint 返回推送到短信的 Endpoint, phone 为空时表示接收号码由消息的 MessageAttributes 指定.
+func SMSEndpoint(phone string) Endpoint {
+	if phone == "" {
+		phone = "anonymous"
+	}
+	return Endpoint("sms:directsms:" + phone)
+}
+
+// NotifyStrategy 是向 Endpoint 推送消息出现错误时的重试策略.
+type NotifyStrategy string
+
+const (
+	NotifyStrategyBackoffRetry          NotifyStrategy = "BACKOFF_RETRY"           // 重试 3 次, 每次重试的间隔时间是 10 秒到 20 秒之间的随机值
+	NotifyStrategyExponentialDecayRetry NotifyStrategy = "EXPONENTIAL_DECAY_RETRY" // 重试 176 次, 每次重试的间隔时间指数递增至 512 秒, 总计重试时间为 1 天
+)
+
+// NotifyContentFormat 是推送给 Endpoint 的消息格式.
+type NotifyContentFormat string
+
+const (
+	NotifyContentFormatXML        NotifyContentFormat = "XML"
+	NotifyContentFormatJSON       NotifyContentFormat = "JSON"
+	NotifyContentFormatSimplified NotifyContentFormat = "SIMPLIFIED" // 消息体即用户发布的消息, 不包含任何属性信息
+)
+
+type SubscribeRequest struct {
+	XMLName struct{} `xml:"Subscription"`
+
+	Endpoint            Endpoint            `xml:"Endpoint"`
+	FilterTag           string              `xml:"FilterTag,omitempty"`           // 消息过滤的标签, 只有 MessageTag 相同的消息才会推送, 长度不超过 16
+	NotifyStrategy      NotifyStrategy      `xml:"NotifyStrategy,omitempty"`      // 默认为 BACKOFF_RETRY
+	NotifyContentFormat NotifyContentFormat `xml:"NotifyContentFormat,omitempty"` // 默认为 XML
+}
+
+func (t *Topic) Subscribe(subscription string, req *SubscribeRequest) (requestId string, err error) {
+	return t.SubscribeContext(context.Background(), subscription, req)
+}
+
+// SubscribeContext 创建订阅.
+// 如果同名订阅已经存在并且属性相同, 返回成功; 如果属性不同, 返回 SubscriptionAlreadyExist 错误.
+func (t *Topic) SubscribeContext(ctx context.Context, subscription string, req *SubscribeRequest) (requestId string, err error) {
+	if subscription == "" {
+		err = errors.New("the subscription must not be empty")
+		return
+	}
+	if req == nil || req.Endpoint == "" {
+		err = errors.New("the Endpoint must not be empty")
+		return
+	}
+	if len(req.FilterTag) > 16 {
+		err = errors.New("the length of FilterTag cannot be greater than 16")
+		return
+	}
+	return t.put(ctx, internal.Operation{Name: "Subscribe", Idempotent: true}, t.topic+"/subscriptions/"+subscription, req)
+}
+
+func (t *Topic) Unsubscribe(subscription string) (requestId string, err error) {
+	return t.UnsubscribeContext(context.Background(), subscription)
+}
+
+func (t *Topic) UnsubscribeContext(ctx context.Context, subscription string) (requestId string, err error) {
+	if subscription == "" {
+		err = errors.New("the subscription must not be empty")
+		return
+	}
+	return t.delete(ctx, internal.Operation{Name: "Unsubscribe", Idempotent: true}, t.topic+"/subscriptions/"+subscription)
+}
+
+// SubscriptionAttributes 是订阅可以修改的属性, 目前只能修改 NotifyStrategy.
+type SubscriptionAttributes struct {
+	XMLName struct{} `xml:"Subscription"`
+
+	NotifyStrategy NotifyStrategy `xml:"NotifyStrategy,omitempty"`
+}
+
+func (t *Topic) SetSubscriptionAttributes(subscription string, attrs *SubscriptionAttributes) (requestId string, err error) {
+	return t.SetSubscriptionAttributesContext(context.Background(), subscription, attrs)
+}
+
+func (t *Topic) SetSubscriptionAttributesContext(ctx context.Context, subscription string, attrs *SubscriptionAttributes) (requestId string, err error) {
+	if subscription == "" {
+		err = errors.New("the subscription must not be empty")
+		return
+	}
+	if attrs == nil {
+		err = errors.New("the attrs must not be nil")
+		return
+	}
+	return t.put(ctx, internal.Operation{Name: "SetSubscriptionAttributes", Idempotent: true}, t.topic+"/subscriptions/"+subscription+"?metaoverride=true", attrs)
+}
+
+// GetSubscriptionAttributesResponse 是 GetSubscriptionAttributes 返回的订阅属性.
+type GetSubscriptionAttributesResponse struct {
+	XMLName struct{} `xml:"Subscription"`
+
+	SubscriptionName    string              `xml:"SubscriptionName"`
+	Subscriber          string              `xml:"Subscriber"` // 订阅者的 AccountId
+	TopicOwner          string              `xml:"TopicOwner"` // 主题所有者的 AccountId
+	TopicName           string              `xml:"TopicName"`
+	Endpoint            Endpoint            `xml:"Endpoint"`
+	FilterTag           string              `xml:"FilterTag"`
+	NotifyStrategy      NotifyStrategy      `xml:"NotifyStrategy"`
+	NotifyContentFormat NotifyContentFormat `xml:"NotifyContentFormat"`
+	CreateTime          int64               `xml:"CreateTime"`     // 订阅的创建时间, 从 1970-1-1 00:00:00 到现在的秒值
+	LastModifyTime      int64               `xml:"LastModifyTime"` // 修改订阅属性信息最近时间, 从 1970-1-1 00:00:00 到现在的秒值
+}
+
+func (t *Topic) GetSubscriptionAttributes(subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error) {
+	return t.GetSubscriptionAttributesContext(context.Background(), subscription)
+}
+
+func (t *Topic) GetSubscriptionAttributesContext(ctx context.Context, subscription string) (requestId string, resp *GetSubscriptionAttributesResponse, err error) {
+	if subscription == "" {
+		err = errors.New("the subscription must not be empty")
+		return
+	}
+	var result GetSubscriptionAttributesResponse
+	requestId, err = t.get(ctx, internal.Operation{Name: "GetSubscriptionAttributes", Idempotent: true}, t.topic+"/subscriptions/"+subscription, nil, &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
+
+type ListSubscriptionResponseItem struct {
+	XMLName struct{} `xml:"Subscription"`
+
+	SubscriptionURL string `xml:"SubscriptionURL"` // http://$AccountId.mns.<Region>.aliyuncs.com/topics/$TopicName/subscriptions/$SubscriptionName
+}
+
+type ListSubscriptionResponse struct {
+	XMLName struct{} `xml:"Subscriptions"`
+
+	Subscriptions []ListSubscriptionResponseItem `xml:"Subscription"`
+	NextMarker    string                         `xml:"NextMarker"` // 为空表示没有更多的订阅了
+}
+
+func (t *Topic) ListSubscriptionByTopic(prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error) {
+	return t.ListSubscriptionByTopicContext(context.Background(), prefix, marker, retNumber)
+}
+
+// ListSubscriptionByTopicContext 列出主题下的订阅.
+//  prefix:    按照订阅名称的前缀过滤, 可以为空
+//  marker:    分页的起始位置, 为上一次返回的 NextMarker, 第一页为空
+//  retNumber: 单次返回的最大个数, 1-1000
+func (t *Topic) ListSubscriptionByTopicContext(ctx context.Context, prefix, marker string, retNumber int) (requestId string, resp *ListSubscriptionResponse, err error) {
+	var result ListSubscriptionResponse
+	requestId, err = t.get(ctx, internal.Operation{Name: "ListSubscriptionByTopic", Idempotent: true}, t.topic+"/subscriptions", internal.ListHeader(prefix, marker, retNumber), &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
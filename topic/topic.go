@@ -35,7 +35,7 @@ type PublishMessageRequest struct {
 
 	MessageBody       []byte      `xml:"MessageBody"`
 	MessageTag        string      `xml:"MessageTag,omitempty"`
-	MessageAttributes interface{} `xml:"MessageAttributes,omitempty"`
+	MessageAttributes interface{} `xml:"MessageAttributes,omitempty"` // 一般为 *MessageAttributes 或者 MessageAttributes
 }
 
 type PublishMessageResponse struct {
@@ -58,6 +58,18 @@ func (t *Topic) PublishMessageContext(ctx context.Context, msg *PublishMessageRe
 		err = errors.New("the length of MessageTag cannot be greater than 16")
 		return
 	}
+	switch attrs := msg.MessageAttributes.(type) {
+	case *MessageAttributes:
+		if attrs != nil {
+			if err = attrs.Validate(); err != nil {
+				return
+			}
+		}
+	case MessageAttributes:
+		if err = attrs.Validate(); err != nil {
+			return
+		}
+	}
 	if t.config.Base64Enabled {
 		msg.MessageBody = internal.Base64Encode(msg.MessageBody)
 	}
@@ -80,7 +92,7 @@ func (t *Topic) PublishMessageContext(ctx context.Context, msg *PublishMessageRe
 	respBuffer := pool.Get()
 	defer pool.Put(respBuffer)
 	respBuffer.Reset()
-	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, http.MethodPost, _url, nil, reqBody, respBuffer, t.config)
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, internal.Operation{Name: "PublishMessage"}, http.MethodPost, _url, nil, reqBody, respBuffer, t.config)
 	if err != nil {
 		return
 	}
@@ -93,7 +105,7 @@ func (t *Topic) PublishMessageContext(ctx context.Context, msg *PublishMessageRe
 			return
 		}
 		if want := internal.MessageBodyMD5(msg.MessageBody); strings.ToUpper(result.MessageBodyMD5) != want {
-			err = internal.NewMessageBodyMD5MismatchError(msg.MessageBody, result.MessageBodyMD5, want)
+			err = internal.NewMessageBodyMD5MismatchErrorWithMetrics(t.config, "PublishMessage", _url, msg.MessageBody, result.MessageBodyMD5, want)
 			return
 		}
 		resp = &result
@@ -103,3 +115,160 @@ func (t *Topic) PublishMessageContext(ctx context.Context, msg *PublishMessageRe
 		return
 	}
 }
+
+// TopicAttributes 是主题可以设置的属性, 用于 CreateTopic 和 SetTopicAttributes.
+// 零值的字段不会发送给 MNS, 创建主题时使用默认值, 设置属性时保持不变.
+type TopicAttributes struct {
+	XMLName struct{} `xml:"Topic"`
+
+	MaximumMessageSize int   `xml:"MaximumMessageSize,omitempty"` // 发送到该主题的消息体的最大长度, 单位为 byte, 1024-65536
+	LoggingEnabled     *bool `xml:"LoggingEnabled,omitempty"`     // 是否开启日志管理功能
+}
+
+// GetTopicAttributesResponse 是 GetTopicAttributes 返回的主题属性.
+type GetTopicAttributesResponse struct {
+	XMLName struct{} `xml:"Topic"`
+
+	TopicName              string `xml:"TopicName"`
+	CreateTime             int64  `xml:"CreateTime"`     // 主题的创建时间, 从 1970-1-1 00:00:00 到现在的秒值
+	LastModifyTime         int64  `xml:"LastModifyTime"` // 修改主题属性信息最近时间, 从 1970-1-1 00:00:00 到现在的秒值
+	MaximumMessageSize     int    `xml:"MaximumMessageSize"`
+	MessageRetentionPeriod int    `xml:"MessageRetentionPeriod"`
+	MessageCount           int64  `xml:"MessageCount"` // 主题中的消息数目
+	LoggingEnabled         bool   `xml:"LoggingEnabled"`
+}
+
+func (t *Topic) CreateTopic(attrs *TopicAttributes) (requestId string, err error) {
+	return t.CreateTopicContext(context.Background(), attrs)
+}
+
+// CreateTopicContext 创建主题, attrs 可以为 nil.
+// 如果同名主题已经存在并且属性相同, 返回成功; 如果属性不同, 返回 TopicAlreadyExist 错误.
+func (t *Topic) CreateTopicContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	if attrs == nil {
+		attrs = &TopicAttributes{}
+	}
+	return t.put(ctx, internal.Operation{Name: "CreateTopic", Idempotent: true}, t.topic, attrs)
+}
+
+func (t *Topic) SetTopicAttributes(attrs *TopicAttributes) (requestId string, err error) {
+	return t.SetTopicAttributesContext(context.Background(), attrs)
+}
+
+func (t *Topic) SetTopicAttributesContext(ctx context.Context, attrs *TopicAttributes) (requestId string, err error) {
+	if attrs == nil {
+		err = errors.New("the attrs must not be nil")
+		return
+	}
+	return t.put(ctx, internal.Operation{Name: "SetTopicAttributes", Idempotent: true}, t.topic+"?metaoverride=true", attrs)
+}
+
+func (t *Topic) GetTopicAttributes() (requestId string, resp *GetTopicAttributesResponse, err error) {
+	return t.GetTopicAttributesContext(context.Background())
+}
+
+func (t *Topic) GetTopicAttributesContext(ctx context.Context) (requestId string, resp *GetTopicAttributesResponse, err error) {
+	var result GetTopicAttributesResponse
+	requestId, err = t.get(ctx, internal.Operation{Name: "GetTopicAttributes", Idempotent: true}, t.topic, nil, &result)
+	if err != nil {
+		return
+	}
+	resp = &result
+	return
+}
+
+func (t *Topic) DeleteTopic() (requestId string, err error) {
+	return t.DeleteTopicContext(context.Background())
+}
+
+func (t *Topic) DeleteTopicContext(ctx context.Context) (requestId string, err error) {
+	return t.delete(ctx, internal.Operation{Name: "DeleteTopic", Idempotent: true}, t.topic)
+}
+
+// put 发送 PUT 请求, 请求体为 v 编码后的 xml, 成功时没有响应体.
+func (t *Topic) put(ctx context.Context, op internal.Operation, rawurl string, v interface{}) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	reqBuffer := pool.Get()
+	defer pool.Put(reqBuffer)
+	reqBuffer.Reset()
+	if err = xml.NewEncoder(reqBuffer).Encode(v); err != nil {
+		return
+	}
+	reqBody := reqBuffer.Bytes()
+
+	pool = mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodPut, _url, nil, reqBody, respBuffer, t.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
+
+// get 发送 GET 请求, 并把响应体解析到 result.
+func (t *Topic) get(ctx context.Context, op internal.Operation, rawurl string, header http.Header, result interface{}) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodGet, _url, header, nil, respBuffer, t.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		if err = xml.Unmarshal(respBody, result); err != nil {
+			err = internal.NewXMLUnmarshalError(respBody, result, err)
+			return
+		}
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
+
+// delete 发送 DELETE 请求, 成功时没有响应体.
+func (t *Topic) delete(ctx context.Context, op internal.Operation, rawurl string) (requestId string, err error) {
+	_url, err := internal.ParseURL(rawurl)
+	if err != nil {
+		return
+	}
+
+	pool := mns.GetBytesBufferPool()
+	respBuffer := pool.Get()
+	defer pool.Put(respBuffer)
+	respBuffer.Reset()
+	requestId, statusCode, respBody, err := internal.DoHTTP(ctx, op, http.MethodDelete, _url, nil, nil, respBuffer, t.config)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode/100 == 2:
+		return
+	default:
+		err = internal.UnmarshalErrorResponse(requestId, statusCode, respBody)
+		return
+	}
+}
@@ -0,0 +1,85 @@
+package topic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/mns.aliyun.v20150606"
+)
+
+func TestTopicSubscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/topics/test/subscriptions/sub" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		want := `<Subscription><Endpoint>acs:mns:cn-hangzhou:123:queues/q</Endpoint><FilterTag>tag</FilterTag><NotifyStrategy>EXPONENTIAL_DECAY_RETRY</NotifyStrategy><NotifyContentFormat>SIMPLIFIED</NotifyContentFormat></Subscription>`
+		if have := strings.TrimSpace(string(body)); have != want {
+			t.Errorf("have:%s, want:%s", have, want)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	tp := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, err := tp.Subscribe("sub", &SubscribeRequest{
+		Endpoint:            QueueEndpoint("cn-hangzhou", "123", "q"),
+		FilterTag:           "tag",
+		NotifyStrategy:      NotifyStrategyExponentialDecayRetry,
+		NotifyContentFormat: NotifyContentFormatSimplified,
+	})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+}
+
+func TestTopicGetSubscriptionAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/topics/test/subscriptions/sub" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`<Subscription xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <SubscriptionName>sub</SubscriptionName>
+  <Subscriber>123</Subscriber>
+  <TopicOwner>123</TopicOwner>
+  <TopicName>test</TopicName>
+  <Endpoint>http://example.com/notify</Endpoint>
+  <FilterTag>tag</FilterTag>
+  <NotifyStrategy>BACKOFF_RETRY</NotifyStrategy>
+  <NotifyContentFormat>JSON</NotifyContentFormat>
+  <CreateTime>1449554962</CreateTime>
+  <LastModifyTime>1449554962</LastModifyTime>
+</Subscription>`))
+	}))
+	defer srv.Close()
+
+	tp := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, resp, err := tp.GetSubscriptionAttributes("sub")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if resp.Endpoint != HttpEndpoint("http://example.com/notify") || resp.NotifyStrategy != NotifyStrategyBackoffRetry || resp.NotifyContentFormat != NotifyContentFormatJSON {
+		t.Errorf("unexpected response: %+v", resp)
+		return
+	}
+}
+
+func TestTopicNotExist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>TopicNotExist</Code><Message>The topic you provided is not exist.</Message><RequestId>request-id</RequestId></Error>`))
+	}))
+	defer srv.Close()
+
+	tp := New(srv.URL, "test", mns.Config{AccessKeyId: "id", AccessKeySecret: "secret"})
+	_, _, err := tp.GetTopicAttributes()
+	if !mns.IsTopicNotExist(err) {
+		t.Errorf("want TopicNotExist, have:%v", err)
+		return
+	}
+}